@@ -0,0 +1,31 @@
+package osquery
+
+import "github.com/Uptycs/basequery-go/gen/osquery"
+
+// AuthorizeFunc decides whether a plugin call is allowed. A non-nil error
+// denies the call.
+type AuthorizeFunc func(registry, item string, request osquery.ExtensionPluginRequest) error
+
+// ServerAuthorize sets the policy checked before every plugin call, eg. to
+// deny a sensitive table outside of incident response. A denied call fails
+// with the error without reaching the plugin. The function runs on every call
+// from osquery, including the "columns" calls of tables, so it must be fast
+// and safe for concurrent use.
+func ServerAuthorize(authorize AuthorizeFunc) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.authorize = authorize
+	}
+}
+
+// checkAuthorized returns the status of a call denied by the authorization
+// policy, or nil if the call is allowed.
+func (s *ExtensionManagerServer) checkAuthorized(registry, item string, request osquery.ExtensionPluginRequest) *osquery.ExtensionStatus {
+	if s.authorize == nil {
+		return nil
+	}
+	if err := s.authorize(registry, item, request); err != nil {
+		s.debugf("call %s/%s action=%q denied: %v", registry, item, request["action"], err)
+		return &osquery.ExtensionStatus{Code: 1, Message: "Call denied: " + err.Error()}
+	}
+	return nil
+}
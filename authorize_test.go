@@ -0,0 +1,60 @@
+package osquery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerAuthorize(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	generated := 0
+	gen := func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+		generated++
+		return []map[string]string{{"a": "1"}}, nil
+	}
+	server.RegisterPlugin(
+		table.NewPlugin("public", []table.ColumnDefinition{table.TextColumn("a")}, gen),
+		table.NewPlugin("sensitive", []table.ColumnDefinition{table.TextColumn("a")}, gen),
+	)
+
+	incident := false
+	var checked []string
+	ServerAuthorize(func(registry, item string, request osquery.ExtensionPluginRequest) error {
+		checked = append(checked, registry+"/"+item+"/"+request["action"])
+		if item == "sensitive" && !incident {
+			return errors.New("table only available during incident response")
+		}
+		return nil
+	})(server)
+	request := osquery.ExtensionPluginRequest{"action": "generate"}
+
+	resp, err := server.Call(context.Background(), "table", "public", request)
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, 1, generated)
+
+	resp, err = server.Call(context.Background(), "table", "sensitive", request)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Equal(t, "Call denied: table only available during incident response", resp.Status.Message)
+	assert.Empty(t, resp.Response)
+	assert.Equal(t, 1, generated)
+
+	incident = true
+	resp, err = server.Call(context.Background(), "table", "sensitive", request)
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, 2, generated)
+
+	// Unknown items are rejected before the policy is checked
+	resp, err = server.Call(context.Background(), "table", "missing", request)
+	require.NoError(t, err)
+	assert.Equal(t, "Unknown registry item: missing", resp.Status.Message)
+	assert.Equal(t, []string{"table/public/generate", "table/sensitive/generate", "table/sensitive/generate"}, checked)
+}
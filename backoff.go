@@ -0,0 +1,67 @@
+package osquery
+
+import (
+	"math"
+	"time"
+)
+
+// BackoffStrategy decides how long to wait before retrying an operation.
+type BackoffStrategy interface {
+	// Next returns the delay before the given retry, starting at 1, or a
+	// negative duration to stop retrying.
+	Next(attempt int) time.Duration
+}
+
+// ConstantBackoff waits the same delay before every retry.
+type ConstantBackoff struct {
+	Delay      time.Duration
+	MaxRetries int // Give up after this many retries, if > 0
+}
+
+// Next implements BackoffStrategy.
+func (b ConstantBackoff) Next(attempt int) time.Duration {
+	if b.MaxRetries > 0 && attempt > b.MaxRetries {
+		return -1
+	}
+	return b.Delay
+}
+
+// ExponentialBackoff multiplies the delay by Multiplier (2 by default) after
+// every retry, starting at Initial and capped at Max.
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Max        time.Duration // Cap on the delay, if > 0
+	Multiplier float64
+	MaxRetries int // Give up after this many retries, if > 0
+}
+
+// Next implements BackoffStrategy.
+func (b ExponentialBackoff) Next(attempt int) time.Duration {
+	if b.MaxRetries > 0 && attempt > b.MaxRetries {
+		return -1
+	}
+	multiplier := b.Multiplier
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+	delay := float64(b.Initial)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if b.Max > 0 && delay >= float64(b.Max) {
+			return b.Max
+		}
+		if delay >= math.MaxInt64 {
+			return math.MaxInt64
+		}
+	}
+	return time.Duration(delay)
+}
+
+// ServerReconnectBackoff makes Start retry registering the extension when it
+// fails (eg. because osquery is still starting up), waiting between attempts
+// as decided by the strategy. By default the registration is not retried.
+func ServerReconnectBackoff(strategy BackoffStrategy) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.backoff = strategy
+	}
+}
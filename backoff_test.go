@@ -0,0 +1,50 @@
+package osquery
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func delays(strategy BackoffStrategy, attempts int) []time.Duration {
+	var result []time.Duration
+	for attempt := 1; attempt <= attempts; attempt++ {
+		result = append(result, strategy.Next(attempt))
+	}
+	return result
+}
+
+func TestConstantBackoff(t *testing.T) {
+	assert.Equal(t, []time.Duration{time.Second, time.Second, time.Second},
+		delays(ConstantBackoff{Delay: time.Second}, 3))
+	assert.Equal(t, []time.Duration{time.Second, time.Second, -1},
+		delays(ConstantBackoff{Delay: time.Second, MaxRetries: 2}, 3))
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	ms := time.Millisecond
+	assert.Equal(t, []time.Duration{100 * ms, 200 * ms, 400 * ms, 800 * ms},
+		delays(ExponentialBackoff{Initial: 100 * ms}, 4))
+	assert.Equal(t, []time.Duration{100 * ms, 300 * ms, 900 * ms, time.Second, time.Second},
+		delays(ExponentialBackoff{Initial: 100 * ms, Max: time.Second, Multiplier: 3}, 5))
+	assert.Equal(t, []time.Duration{100 * ms, 200 * ms, -1},
+		delays(ExponentialBackoff{Initial: 100 * ms, MaxRetries: 2}, 3))
+	assert.Equal(t, time.Duration(1<<63-1), ExponentialBackoff{Initial: time.Second}.Next(100))
+}
+
+func TestStartRegistrationRetry(t *testing.T) {
+	calls := 0
+	mock := NewMockExtensionManager()
+	mock.RegisterExtensionFunc = func(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+		calls++
+		return nil, errors.New("connection refused")
+	}
+	server := newTestServer(mock, "")
+	ServerReconnectBackoff(ConstantBackoff{Delay: time.Millisecond, MaxRetries: 2})(server)
+
+	assert.Error(t, server.Start())
+	assert.Equal(t, 3, calls)
+}
@@ -0,0 +1,89 @@
+package osquery
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/internal/jsonutil"
+)
+
+// CallError describes a failed plugin call.
+type CallError struct {
+	Registry string    `json:"registry"`
+	Plugin   string    `json:"plugin"`
+	Action   string    `json:"action"`
+	Code     int32     `json:"code"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+}
+
+// ServerRecentErrors keeps the last n failed calls, including calls rejected
+// before reaching the plugin (eg. unknown or unauthorized), returned by
+// RecentErrors and served as JSON on the /errors path of the prometheus HTTP
+// server. By default no errors are kept.
+func ServerRecentErrors(n int) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		if n > 0 {
+			s.callErrors = &callErrors{errors: make([]CallError, n)}
+		} else {
+			s.callErrors = nil
+		}
+	}
+}
+
+// RecentErrors returns the last failed plugin calls kept by the server, oldest
+// first. It returns nil unless the ServerRecentErrors option is set.
+func (s *ExtensionManagerServer) RecentErrors() []CallError {
+	if s.callErrors == nil {
+		return nil
+	}
+	return s.callErrors.list()
+}
+
+func (s *ExtensionManagerServer) serveRecentErrors(w http.ResponseWriter, r *http.Request) {
+	recent := s.RecentErrors()
+	if recent == nil {
+		recent = []CallError{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonutil.NewEncoder(w).Encode(recent)
+}
+
+// callErrors is a ring buffer of the last failed calls.
+type callErrors struct {
+	mutex  sync.Mutex
+	errors []CallError
+	next   int
+	full   bool
+}
+
+func (c *callErrors) add(registry, item string, request osquery.ExtensionPluginRequest, status *osquery.ExtensionStatus) {
+	if status == nil || status.Code == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.errors[c.next] = CallError{
+		Registry: registry,
+		Plugin:   item,
+		Action:   request["action"],
+		Code:     status.Code,
+		Message:  status.Message,
+		Time:     time.Now(),
+	}
+	c.next = (c.next + 1) % len(c.errors)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+func (c *callErrors) list() []CallError {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.full {
+		return append([]CallError(nil), c.errors[:c.next]...)
+	}
+	return append(append([]CallError(nil), c.errors[c.next:]...), c.errors[:c.next]...)
+}
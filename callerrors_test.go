@@ -0,0 +1,81 @@
+package osquery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentErrors(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	server.RegisterPlugin(table.NewPlugin("failing", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return nil, errors.New("failure " + queryContext.Constraints["a"].Constraints[0].Expression)
+		}))
+	assert.Nil(t, server.RecentErrors())
+
+	ServerRecentErrors(2)(server)
+	for i := 1; i <= 3; i++ {
+		request := osquery.ExtensionPluginRequest{
+			"action":  "generate",
+			"context": `{"constraints":[{"name":"a","list":[{"op":2,"expr":"` + strconv.Itoa(i) + `"}]}]}`,
+		}
+		_, err := server.Call(context.Background(), "table", "failing", request)
+		require.NoError(t, err)
+	}
+	// Successful calls are not kept
+	_, err := server.Call(context.Background(), "table", "failing", osquery.ExtensionPluginRequest{"action": "columns"})
+	require.NoError(t, err)
+
+	recent := server.RecentErrors()
+	require.Len(t, recent, 2)
+	for i, callErr := range recent {
+		assert.Equal(t, "table", callErr.Registry)
+		assert.Equal(t, "failing", callErr.Plugin)
+		assert.Equal(t, "generate", callErr.Action)
+		assert.Equal(t, int32(1), callErr.Code)
+		assert.Contains(t, callErr.Message, "failure "+strconv.Itoa(i+2))
+		assert.False(t, callErr.Time.IsZero())
+	}
+
+	w := httptest.NewRecorder()
+	server.serveRecentErrors(w, httptest.NewRequest("GET", "/errors", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var served []CallError
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+	assert.Len(t, served, 2)
+	assert.Equal(t, recent[1].Message, served[1].Message)
+}
+
+func TestRecentErrorsRejectedCalls(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerRecentErrors(10)(server)
+	ServerAuthorize(func(registry, item string, request osquery.ExtensionPluginRequest) error {
+		return errors.New("not allowed")
+	})(server)
+	server.RegisterPlugin(table.NewPlugin("denied", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return nil, nil
+		}))
+
+	// Calls failing before reaching a plugin are recorded as well
+	_, err := server.Call(context.Background(), "table", "missing", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+	_, err = server.Call(context.Background(), "table", "denied", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+
+	recent := server.RecentErrors()
+	require.Len(t, recent, 2)
+	assert.Equal(t, "missing", recent[0].Plugin)
+	assert.Contains(t, recent[0].Message, "Unknown registry item")
+	assert.Equal(t, "denied", recent[1].Plugin)
+	assert.Contains(t, recent[1].Message, "Call denied: not allowed")
+}
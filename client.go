@@ -2,6 +2,10 @@ package osquery
 
 import (
 	"context"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/Uptycs/basequery-go/gen/osquery"
@@ -25,32 +29,157 @@ type ExtensionManager interface {
 	GetNodeKey() (string, error)
 }
 
+// ExtensionDeregisterer can optionally be implemented by ExtensionManager
+// clients able to remove an extension registration from osquery, such as
+// ExtensionManagerClient. The server needs it to re-register (see ReRegister).
+type ExtensionDeregisterer interface {
+	DeregisterExtension(uuid osquery.ExtensionRouteUUID) (*osquery.ExtensionStatus, error)
+}
+
 // ExtensionManagerClient is a wrapper for the osquery Thrift extensions API.
 type ExtensionManagerClient struct {
-	Client    osquery.ExtensionManager
-	transport thrift.TTransport
+	Client          osquery.ExtensionManager
+	transport       thrift.TTransport
+	path            string
+	connectTimeout  time.Duration // Timeout waiting for and connecting to the socket
+	readTimeout     time.Duration // Timeout of the reads and writes on the socket, none if 0
+	connectAttempts int           // Number of attempts to open the socket
+	connectBackoff  time.Duration // Wait before the first retry, doubled after each attempt
+	autoReconnect   bool          // Reopen the socket when a query fails on a lost connection
+	events          *eventBuffer  // Buffer of streamed events, if enabled
+	queryCache      *queryCache   // Cache of query results, if enabled
+	mutex           sync.Mutex    // Serializes the calls to osquery
+	eventMetrics    EventMetricsSink
+}
+
+// ClientOption is function for setting extension manager client options.
+type ClientOption func(*ExtensionManagerClient)
+
+// ClientConnectRetry makes NewClient retry opening the socket up to attempts
+// times in total, for example when the extension starts before osquery has
+// created the socket. The wait between attempts starts at backoff and doubles
+// after each failed attempt.
+func ClientConnectRetry(attempts int, backoff time.Duration) ClientOption {
+	return func(c *ExtensionManagerClient) {
+		c.connectAttempts = attempts
+		c.connectBackoff = backoff
+	}
+}
+
+// ClientTimeouts sets separate timeouts for connecting to the socket and for
+// the calls (the reads and writes on the socket), eg. to fail fast when
+// osquery is not running while allowing queries to take several seconds. By
+// default the timeout of NewClient only bounds connecting, and the calls wait
+// for osquery without a timeout.
+func ClientTimeouts(connect, read time.Duration) ClientOption {
+	return func(c *ExtensionManagerClient) {
+		c.connectTimeout = connect
+		c.readTimeout = read
+	}
+}
+
+// ClientEventMetrics records the events streamed by the client, whether
+// buffered or not, to the sink. The server sets its Prometheus sink on its own
+// client when ServerPrometheusPort is set.
+func ClientEventMetrics(sink EventMetricsSink) ClientOption {
+	return func(c *ExtensionManagerClient) {
+		c.eventMetrics = sink
+	}
+}
+
+// ClientAutoReconnect makes the client reopen its socket when a query
+// (Query, QueryRows and the other query helpers, and GetQueryColumns) fails
+// because the connection to osquery was lost, eg. when osquery restarted, and
+// retry the query once. The socket is reopened like NewClient does, so set
+// ClientConnectRetry to wait for a restarting osquery to create it. Without
+// this option, a lost connection fails every following call.
+func ClientAutoReconnect(enabled bool) ClientOption {
+	return func(c *ExtensionManagerClient) {
+		c.autoReconnect = enabled
+	}
 }
 
 // NewClient creates a new client communicating to osquery over the socket at
 // the provided path. If resolving the address or connecting to the socket
-// fails, this function will error.
-func NewClient(path string, timeout time.Duration) (*ExtensionManagerClient, error) {
-	trans, err := transport.Open(path, timeout)
-	if err != nil {
+// fails, this function will error. See ClientConnectRetry for retrying the
+// connection.
+func NewClient(path string, timeout time.Duration, opts ...ClientOption) (*ExtensionManagerClient, error) {
+	c := &ExtensionManagerClient{path: path, connectTimeout: timeout, connectAttempts: 1}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.open(); err != nil {
 		return nil, err
 	}
+	c.startEvents()
 
-	client := osquery.NewExtensionManagerClientFactory(
+	return c, nil
+}
+
+// open opens the socket, retrying as set with ClientConnectRetry, and creates
+// the thrift client using it.
+func (c *ExtensionManagerClient) open() error {
+	trans, err := transport.OpenTimeouts(c.path, c.connectTimeout, c.readTimeout)
+	backoff := c.connectBackoff
+	for attempt := 1; err != nil && attempt < c.connectAttempts; attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		trans, err = transport.OpenTimeouts(c.path, c.connectTimeout, c.readTimeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Client = osquery.NewExtensionManagerClientFactory(
 		trans,
-		thrift.NewTBinaryProtocolFactoryConf(&thrift.TConfiguration{}),
+		// The configuration propagates to the socket, replacing its timeouts
+		thrift.NewTBinaryProtocolFactoryConf(&thrift.TConfiguration{
+			ConnectTimeout: c.connectTimeout,
+			SocketTimeout:  c.readTimeout,
+		}),
 	)
+	c.transport = trans
+	return nil
+}
 
-	return &ExtensionManagerClient{client, trans}, nil
+// reconnect reopens the socket if auto reconnection is enabled and err shows
+// that the connection was lost, returning whether the failed call can be
+// retried. The caller must hold the mutex.
+func (c *ExtensionManagerClient) reconnect(err error) bool {
+	if !c.autoReconnect || c.path == "" || !connectionLost(err) {
+		return false
+	}
+	if c.transport != nil {
+		c.transport.Close()
+	}
+	return c.open() == nil
+}
+
+// connectionLost returns whether the call error is due to the connection. The
+// errors of the socket reads are transport exceptions, while the errors of the
+// writes are only wrapped as protocol exceptions. Timeouts are not, as a
+// query timing out would likely time out again on a new connection.
+func connectionLost(err error) bool {
+	var transportErr thrift.TTransportException
+	if errors.As(err, &transportErr) {
+		switch transportErr.TypeId() {
+		case thrift.NOT_OPEN, thrift.END_OF_FILE:
+			return true
+		}
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
 }
 
 // Close should be called to close the transport when use of the client is
 // completed.
 func (c *ExtensionManagerClient) Close() {
+	if c.events != nil {
+		c.events.close()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	if c.transport != nil && c.transport.IsOpen() {
 		c.transport.Close()
 	}
@@ -58,26 +187,49 @@ func (c *ExtensionManagerClient) Close() {
 
 // Ping requests metadata from the extension manager.
 func (c *ExtensionManagerClient) Ping() (*osquery.ExtensionStatus, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.Client.Ping(context.Background())
 }
 
-// Call requests a call to an extension (or core) registry plugin.
+// Call requests a call to an extension (or core) registry plugin. osquery
+// routes the call to the extension providing the plugin, so this can be used
+// to invoke the plugins of other extensions directly, eg. to test a logger
+// plugin. It is a low-level API: the request and the response are the raw
+// plugin request and response, and a failure of the plugin is only reported
+// in the response status, not as an error.
 func (c *ExtensionManagerClient) Call(registry, item string, request osquery.ExtensionPluginRequest) (*osquery.ExtensionResponse, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.Client.Call(context.Background(), registry, item, request)
 }
 
 // Extensions requests the list of active registered extensions.
 func (c *ExtensionManagerClient) Extensions() (osquery.InternalExtensionList, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.Client.Extensions(context.Background())
 }
 
 // RegisterExtension registers the extension plugins with the osquery process.
 func (c *ExtensionManagerClient) RegisterExtension(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.Client.RegisterExtension(context.Background(), info, registry)
 }
 
+// DeregisterExtension removes the extension with the specified UUID from the
+// osquery process.
+func (c *ExtensionManagerClient) DeregisterExtension(uuid osquery.ExtensionRouteUUID) (*osquery.ExtensionStatus, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Client.DeregisterExtension(context.Background(), uuid)
+}
+
 // Options requests the list of bootstrap or configuration options.
 func (c *ExtensionManagerClient) Options() (osquery.InternalOptionList, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.Client.Options(context.Background())
 }
 
@@ -85,13 +237,38 @@ func (c *ExtensionManagerClient) Options() (osquery.InternalOptionList, error) {
 // Consider using the QueryRow or QueryRows helpers for a more friendly
 // interface.
 func (c *ExtensionManagerClient) Query(sql string) (*osquery.ExtensionResponse, error) {
-	return c.Client.Query(context.Background(), sql)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	res, err := c.Client.Query(context.Background(), sql)
+	if err != nil && c.reconnect(err) {
+		res, err = c.Client.Query(context.Background(), sql)
+	}
+	return res, err
 }
 
 // QueryRows is a helper that executes the requested query and returns the
 // results. It handles checking both the transport level errors and the osquery
-// internal errors by returning a normal Go error type.
+// internal errors by returning a normal Go error type. The results are cached
+// if the query cache is enabled using ClientQueryCache.
 func (c *ExtensionManagerClient) QueryRows(sql string) ([]map[string]string, error) {
+	if c.queryCache == nil {
+		return c.QueryRowsBypassCache(sql)
+	}
+
+	if rows, ok := c.queryCache.get(sql); ok {
+		return rows, nil
+	}
+	rows, err := c.QueryRowsBypassCache(sql)
+	if err != nil {
+		return nil, err
+	}
+	c.queryCache.put(sql, rows)
+	return rows, nil
+}
+
+// QueryRowsBypassCache behaves like QueryRows, but always runs the query in
+// osquery, without using or updating the query cache.
+func (c *ExtensionManagerClient) QueryRowsBypassCache(sql string) ([]map[string]string, error) {
 	res, err := c.Query(sql)
 	if err != nil {
 		return nil, errors.Wrap(err, "transport error in query")
@@ -103,7 +280,6 @@ func (c *ExtensionManagerClient) QueryRows(sql string) ([]map[string]string, err
 		return nil, errors.Errorf("query returned error: %s", res.Status.Message)
 	}
 	return res.Response, nil
-
 }
 
 // QueryRow behaves similarly to QueryRows, but it returns an error if the
@@ -119,17 +295,216 @@ func (c *ExtensionManagerClient) QueryRow(sql string) (map[string]string, error)
 	return res[0], nil
 }
 
+// QueryScalar behaves similarly to QueryRow, but it also returns an error if
+// the row does not have exactly one column, and returns the value of that
+// column. This is useful for queries like "SELECT count(*) FROM ...".
+func (c *ExtensionManagerClient) QueryScalar(sql string) (string, error) {
+	row, err := c.QueryRow(sql)
+	if err != nil {
+		return "", err
+	}
+	if len(row) != 1 {
+		return "", errors.Errorf("expected 1 column, got %d", len(row))
+	}
+	for _, value := range row {
+		return value, nil
+	}
+	return "", nil
+}
+
+// QueryIter behaves similarly to QueryRows, but returns an iterator over the
+// rows:
+//
+//	it, err := client.QueryIter("SELECT * FROM processes")
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		row := it.Row()
+//	}
+//	return it.Err()
+//
+// osquery returns all the rows of a query in a single response, so the rows
+// are received before QueryIter returns. Callers should still check Err and
+// call Close, which releases the rows (and would release a pooled connection
+// if the rows were ever streamed).
+func (c *ExtensionManagerClient) QueryIter(sql string) (*RowIterator, error) {
+	rows, err := c.QueryRows(sql)
+	if err != nil {
+		return nil, err
+	}
+	return &RowIterator{rows: rows, index: -1}, nil
+}
+
+// RowIterator iterates over the rows of a query. See QueryIter.
+type RowIterator struct {
+	rows  []map[string]string
+	index int
+	err   error
+}
+
+// Next advances to the next row, returning false when there are no more rows
+// or an error occurred.
+func (it *RowIterator) Next() bool {
+	if it.err != nil || it.index+1 >= len(it.rows) {
+		it.index = len(it.rows)
+		return false
+	}
+	it.index++
+	return true
+}
+
+// Row returns the current row. It must only be called after Next returned
+// true.
+func (it *RowIterator) Row() map[string]string {
+	return it.rows[it.index]
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *RowIterator) Err() error {
+	return it.err
+}
+
+// Close releases the rows. Next returns false after Close.
+func (it *RowIterator) Close() error {
+	it.rows = nil
+	it.index = 0
+	return nil
+}
+
+// QueryRowsOrdered behaves similarly to QueryRows, but returns the column
+// names in the order of the query (determined using GetQueryColumns) and the
+// values of each row ordered as the columns.
+func (c *ExtensionManagerClient) QueryRowsOrdered(sql string) ([]string, [][]string, error) {
+	res, err := c.GetQueryColumns(sql)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "transport error in query columns")
+	}
+	if res.Status == nil {
+		return nil, nil, errors.New("query columns returned nil status")
+	}
+	if res.Status.Code != 0 {
+		return nil, nil, errors.Errorf("query columns returned error: %s", res.Status.Message)
+	}
+
+	// Each column is returned as a single entry map from name to type
+	columns := make([]string, 0, len(res.Response))
+	for _, col := range res.Response {
+		for name := range col {
+			columns = append(columns, name)
+		}
+	}
+
+	rows, err := c.QueryRows(sql)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		vals := make([]string, len(columns))
+		for i, col := range columns {
+			vals[i] = row[col]
+		}
+		values = append(values, vals)
+	}
+	return columns, values, nil
+}
+
 // GetQueryColumns requests the columns returned by the parsed query.
 func (c *ExtensionManagerClient) GetQueryColumns(sql string) (*osquery.ExtensionResponse, error) {
-	return c.Client.GetQueryColumns(context.Background(), sql)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	res, err := c.Client.GetQueryColumns(context.Background(), sql)
+	if err != nil && c.reconnect(err) {
+		res, err = c.Client.GetQueryColumns(context.Background(), sql)
+	}
+	return res, err
+}
+
+// ErrNoSuchTable is returned by TableColumns for tables unknown to osquery.
+var ErrNoSuchTable = errors.New("no such table")
+
+// ColumnDefinition is the name and type (eg. "TEXT" or "BIGINT") of a column
+// of an osquery table.
+type ColumnDefinition struct {
+	Name string
+	Type string
+}
+
+// TableColumns returns the columns of the osquery table, which can be a core
+// table or a table of any extension, in the order of the table. The columns
+// are those of "SELECT *", so hidden columns are not included. An error
+// wrapping ErrNoSuchTable is returned if osquery does not know the table.
+func (c *ExtensionManagerClient) TableColumns(tableName string) ([]ColumnDefinition, error) {
+	res, err := c.GetQueryColumns("SELECT * FROM " + QuoteIdentifier(tableName) + " LIMIT 0")
+	if err != nil {
+		return nil, errors.Wrap(err, "transport error in query columns")
+	}
+	if res.Status == nil {
+		return nil, errors.New("query columns returned nil status")
+	}
+	if res.Status.Code != 0 {
+		if strings.Contains(res.Status.Message, "no such table") {
+			return nil, errors.Wrap(ErrNoSuchTable, tableName)
+		}
+		return nil, errors.Errorf("query columns returned error: %s", res.Status.Message)
+	}
+
+	// Each column is returned as a single entry map from name to type
+	columns := make([]ColumnDefinition, 0, len(res.Response))
+	for _, col := range res.Response {
+		for name, typ := range col {
+			columns = append(columns, ColumnDefinition{Name: name, Type: typ})
+		}
+	}
+	return columns, nil
 }
 
-// StreamEvents sends a batch of events for a event'ed table.
+// StreamEvents sends a batch of events for a event'ed table. If the event
+// buffer is enabled using ClientEventBuffer, the events are added to the
+// buffer and sent to osquery in the background.
 func (c *ExtensionManagerClient) StreamEvents(name string, events osquery.ExtensionPluginResponse) (*osquery.ExtensionStatus, error) {
-	return c.Client.StreamEvents(context.Background(), name, events)
+	if c.events != nil {
+		c.events.add(name, events)
+		return &osquery.ExtensionStatus{Code: 0, Message: "OK"}, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	status, err := c.Client.StreamEvents(context.Background(), name, events)
+	c.observeEvents(name, len(events), err == nil && (status == nil || status.Code == 0))
+	return status, err
+}
+
+// observeEvents records a batch of events streamed to osquery, if event
+// metrics are enabled. The caller must hold the mutex.
+func (c *ExtensionManagerClient) observeEvents(name string, events int, ok bool) {
+	if c.eventMetrics == nil {
+		return
+	}
+	if !ok {
+		c.eventMetrics.IncStreamError(name)
+		return
+	}
+	c.eventMetrics.AddEvents(name, events)
+	c.eventMetrics.IncBatch(name)
+}
+
+// setEventMetrics sets the sink of the event metrics, unless one was set with
+// ClientEventMetrics.
+func (c *ExtensionManagerClient) setEventMetrics(sink EventMetricsSink) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.eventMetrics == nil {
+		c.eventMetrics = sink
+	}
 }
 
 // GetNodeKey returns TLS node key when enroll plugin is set to "tls".
 func (c *ExtensionManagerClient) GetNodeKey() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.Client.GetNodeKey(context.Background())
 }
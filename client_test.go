@@ -3,11 +3,25 @@ package osquery
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
 
 	"github.com/Uptycs/basequery-go/gen/osquery"
 	"github.com/Uptycs/basequery-go/mock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestQueryRows(t *testing.T) {
@@ -77,3 +91,369 @@ func TestQueryRows(t *testing.T) {
 	_, err = client.QueryRow("select 1 union select 2")
 	assert.NotNil(t, err)
 }
+
+func TestClientDefaultMock(t *testing.T) {
+	mock := mock.NewExtensionManager()
+	client := &ExtensionManagerClient{Client: mock}
+
+	status, err := client.Ping()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), status.Code)
+	assert.True(t, mock.PingFuncInvoked)
+
+	_, err = client.Options()
+	assert.Nil(t, err)
+	assert.True(t, mock.OptionsFuncInvoked)
+
+	rows, err := client.QueryRows("select 1")
+	assert.Nil(t, err)
+	assert.Empty(t, rows)
+
+	// Overriding a single function keeps the remaining defaults
+	mock.RegisterExtensionFunc = func(ctx context.Context, info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+		return nil, errors.New("Boom")
+	}
+	_, err = client.RegisterExtension(&osquery.InternalExtensionInfo{}, osquery.ExtensionRegistry{})
+	assert.NotNil(t, err)
+	_, err = client.Extensions()
+	assert.Nil(t, err)
+}
+
+// MockExtensionManager is generated by mockimpl: methods beyond
+// ExtensionManager would be lost when it is regenerated, so they belong to a
+// separate type (eg. MockDeregisteringExtensionManager).
+func TestGeneratedMock(t *testing.T) {
+	methods := func(typ reflect.Type) []string {
+		var names []string
+		for i := 0; i < typ.NumMethod(); i++ {
+			names = append(names, typ.Method(i).Name)
+		}
+		return names
+	}
+	assert.Equal(t,
+		methods(reflect.TypeOf((*ExtensionManager)(nil)).Elem()),
+		methods(reflect.TypeOf(&MockExtensionManager{})))
+}
+
+func TestQueryRowsOrdered(t *testing.T) {
+	mock := mock.NewExtensionManager()
+	client := &ExtensionManagerClient{Client: mock}
+
+	mock.GetQueryColumnsFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		return &osquery.ExtensionResponse{
+			Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+			Response: []map[string]string{{"pid": "BIGINT"}, {"name": "TEXT"}, {"path": "TEXT"}},
+		}, nil
+	}
+	mock.QueryFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		return &osquery.ExtensionResponse{
+			Status: &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+			Response: []map[string]string{
+				{"name": "init", "path": "/sbin/init", "pid": "1"},
+				{"name": "bash", "path": "/bin/bash", "pid": "42"},
+			},
+		}, nil
+	}
+	columns, rows, err := client.QueryRowsOrdered("select pid, name, path from processes")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pid", "name", "path"}, columns)
+	assert.Equal(t, [][]string{{"1", "init", "/sbin/init"}, {"42", "bash", "/bin/bash"}}, rows)
+
+	// Query columns error
+	mock.GetQueryColumnsFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		return &osquery.ExtensionResponse{
+			Status: &osquery.ExtensionStatus{Code: 1, Message: "no such table"},
+		}, nil
+	}
+	_, _, err = client.QueryRowsOrdered("select * from bad")
+	assert.NotNil(t, err)
+}
+
+func TestTableColumns(t *testing.T) {
+	mock := mock.NewExtensionManager()
+	client := &ExtensionManagerClient{Client: mock}
+
+	var query string
+	mock.GetQueryColumnsFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		query = sql
+		if strings.Contains(sql, "missing") {
+			return &osquery.ExtensionResponse{
+				Status: &osquery.ExtensionStatus{Code: 1, Message: "Error running query: no such table: missing"},
+			}, nil
+		}
+		return &osquery.ExtensionResponse{
+			Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+			Response: []map[string]string{{"pid": "BIGINT"}, {"name": "TEXT"}, {"start_time": "BIGINT"}},
+		}, nil
+	}
+	columns, err := client.TableColumns("processes")
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM "processes" LIMIT 0`, query)
+	assert.Equal(t, []ColumnDefinition{
+		{Name: "pid", Type: "BIGINT"},
+		{Name: "name", Type: "TEXT"},
+		{Name: "start_time", Type: "BIGINT"},
+	}, columns)
+
+	_, err = client.TableColumns("missing")
+	assert.True(t, errors.Is(err, ErrNoSuchTable))
+	assert.EqualError(t, err, "missing: no such table")
+}
+
+func TestNewClientConnectRetry(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "osquery.em")
+	timeout := 250 * time.Millisecond
+
+	_, err := NewClient(sockPath, timeout, ClientConnectRetry(2, 10*time.Millisecond))
+	assert.Error(t, err)
+
+	listening := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(2 * timeout)
+		listener, err := net.Listen("unix", sockPath)
+		if err != nil {
+			close(listening)
+			return
+		}
+		listening <- listener
+	}()
+
+	// The socket only appears after the first attempt timed out
+	client, err := NewClient(sockPath, timeout, ClientConnectRetry(5, 50*time.Millisecond))
+	require.NoError(t, err)
+	client.Close()
+
+	listener, ok := <-listening
+	require.True(t, ok)
+	listener.Close()
+}
+
+func TestQueryScalar(t *testing.T) {
+	mock := mock.NewExtensionManager()
+	client := &ExtensionManagerClient{Client: mock}
+
+	var rows []map[string]string
+	mock.QueryFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		return &osquery.ExtensionResponse{
+			Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+			Response: rows,
+		}, nil
+	}
+
+	rows = []map[string]string{{"count(*)": "42"}}
+	value, err := client.QueryScalar("select count(*) from processes")
+	assert.Nil(t, err)
+	assert.Equal(t, "42", value)
+
+	rows = []map[string]string{}
+	_, err = client.QueryScalar("select count(*) from processes")
+	assert.EqualError(t, err, "expected 1 row, got 0")
+
+	rows = []map[string]string{{"count(*)": "1"}, {"count(*)": "2"}}
+	_, err = client.QueryScalar("select count(*) from processes")
+	assert.EqualError(t, err, "expected 1 row, got 2")
+
+	rows = []map[string]string{{"pid": "1", "name": "init"}}
+	_, err = client.QueryScalar("select pid, name from processes")
+	assert.EqualError(t, err, "expected 1 column, got 2")
+}
+
+func TestQueryIter(t *testing.T) {
+	mock := mock.NewExtensionManager()
+	client := &ExtensionManagerClient{Client: mock}
+
+	expectedRows := []map[string]string{{"pid": "1"}, {"pid": "42"}}
+	mock.QueryFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		return &osquery.ExtensionResponse{
+			Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+			Response: expectedRows,
+		}, nil
+	}
+	it, err := client.QueryIter("select pid from processes")
+	require.NoError(t, err)
+	var rows []map[string]string
+	for it.Next() {
+		rows = append(rows, it.Row())
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, expectedRows, rows)
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Close())
+	assert.False(t, it.Next())
+
+	mock.QueryFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		return &osquery.ExtensionResponse{
+			Status: &osquery.ExtensionStatus{Code: 1, Message: "no such table"},
+		}, nil
+	}
+	_, err = client.QueryIter("select * from bad")
+	assert.Error(t, err)
+}
+
+func TestClientCall(t *testing.T) {
+	mock := mock.NewExtensionManager()
+	client := &ExtensionManagerClient{Client: mock}
+
+	mock.CallFunc = func(ctx context.Context, registry string, item string, request osquery.ExtensionPluginRequest) (*osquery.ExtensionResponse, error) {
+		assert.Equal(t, "logger", registry)
+		assert.Equal(t, "other_logger", item)
+		assert.Equal(t, osquery.ExtensionPluginRequest{"string": "hello"}, request)
+		return &osquery.ExtensionResponse{Status: &osquery.ExtensionStatus{Code: 1, Message: "unknown log request"}}, nil
+	}
+	resp, err := client.Call("logger", "other_logger", osquery.ExtensionPluginRequest{"string": "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.True(t, mock.CallFuncInvoked)
+}
+
+// serveExtensionManager serves the handler on the socket, returning a function
+// closing the accepted connections (but not the listener).
+func serveExtensionManager(t *testing.T, sockPath string, handler osquery.ExtensionManager) func() {
+	listener, err := net.Listen("unix", sockPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	var mutex sync.Mutex
+	var conns []net.Conn
+	processor := osquery.NewExtensionManagerProcessor(handler)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mutex.Lock()
+			conns = append(conns, conn)
+			mutex.Unlock()
+			go func() {
+				prot := thrift.NewTBinaryProtocolConf(thrift.NewTSocketFromConnConf(conn, &thrift.TConfiguration{}), &thrift.TConfiguration{})
+				for {
+					if ok, err := processor.Process(context.Background(), prot, prot); !ok || err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		conns = nil
+	}
+}
+
+func TestClientAutoReconnect(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "osquery.em")
+	mock := mock.NewExtensionManager()
+	mock.QueryFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		return &osquery.ExtensionResponse{
+			Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+			Response: []map[string]string{{"1": "1"}},
+		}, nil
+	}
+	drop := serveExtensionManager(t, sockPath, mock)
+
+	client, err := NewClient(sockPath, time.Second, ClientAutoReconnect(true))
+	require.NoError(t, err)
+	defer client.Close()
+	plain, err := NewClient(sockPath, time.Second)
+	require.NoError(t, err)
+	defer plain.Close()
+
+	_, err = client.QueryRows("select 1")
+	require.NoError(t, err)
+
+	// As if osquery restarted
+	drop()
+	rows, err := client.QueryRows("select 1")
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"1": "1"}}, rows)
+	_, err = plain.QueryRows("select 1")
+	assert.Error(t, err)
+}
+
+func TestConnectionLost(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "unix", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	timeout := &net.OpError{Op: "read", Net: "unix", Err: os.ErrDeadlineExceeded}
+	tests := []struct {
+		err  error
+		lost bool
+	}{
+		{thrift.NewTTransportException(thrift.NOT_OPEN, "closed"), true},
+		{thrift.NewTTransportException(thrift.END_OF_FILE, "EOF"), true},
+		{thrift.NewTTransportExceptionFromError(io.EOF), true},
+		{thrift.NewTTransportExceptionFromError(reset), true},
+		{thrift.NewTProtocolExceptionWithType(thrift.UNKNOWN_PROTOCOL_EXCEPTION, &net.OpError{Op: "write", Net: "unix", Err: syscall.EPIPE}), true},
+		{thrift.NewTTransportException(thrift.TIMED_OUT, "i/o timeout"), false},
+		{thrift.NewTTransportExceptionFromError(timeout), false},
+		{errors.New("no such table"), false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.lost, connectionLost(tt.err), tt.err.Error())
+	}
+}
+
+func TestClientTimeouts(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "osquery.em")
+
+	// The connect timeout bounds the wait for the socket
+	start := time.Now()
+	_, err := NewClient(sockPath, 10*time.Second, ClientTimeouts(100*time.Millisecond, 10*time.Second))
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+
+	mock := mock.NewExtensionManager()
+	mock.QueryFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		time.Sleep(200 * time.Millisecond)
+		return &osquery.ExtensionResponse{
+			Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+			Response: []map[string]string{{"1": "1"}},
+		}, nil
+	}
+	serveExtensionManager(t, sockPath, mock)
+
+	// The read timeout bounds the calls
+	client, err := NewClient(sockPath, time.Second, ClientTimeouts(time.Second, 50*time.Millisecond))
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.QueryRows("select 1")
+	assert.Error(t, err)
+
+	// Without a read timeout by default
+	client, err = NewClient(sockPath, time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+	rows, err := client.QueryRows("select 1")
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"1": "1"}}, rows)
+}
+
+func TestClientAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract sockets are specific to Linux")
+	}
+	sockPath := fmt.Sprintf("@basequery-test-%d.em", os.Getpid())
+	mock := mock.NewExtensionManager()
+	mock.QueryFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		return &osquery.ExtensionResponse{
+			Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+			Response: []map[string]string{{"1": "1"}},
+		}, nil
+	}
+	serveExtensionManager(t, sockPath, mock)
+
+	client, err := NewClient(sockPath, time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+	rows, err := client.QueryRows("select 1")
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"1": "1"}}, rows)
+
+	// No file is created
+	_, err = os.Stat(sockPath)
+	assert.True(t, os.IsNotExist(err))
+}
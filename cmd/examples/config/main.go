@@ -2,52 +2,19 @@ package main
 
 import (
 	"context"
-	"flag"
 	"log"
-	"time"
 
 	osquery "github.com/Uptycs/basequery-go"
 	gen "github.com/Uptycs/basequery-go/gen/osquery"
 	"github.com/Uptycs/basequery-go/plugin/config"
 )
 
-var (
-	//lint:ignore U1000 Argument is required by basequery
-	verbose  = flag.Bool("verbose", false, "Log verbose")
-	socket   = flag.String("socket", "", "Path to the extensions UNIX domain socket")
-	timeout  = flag.Int("timeout", 5, "Seconds to wait for autoloaded extensions")
-	interval = flag.Int("interval", 5, "Seconds delay between connectivity checks")
-)
-
 func main() {
-	flag.Parse()
-
-	if *socket == "" {
-		log.Fatalln("Missing required --socket argument")
-	}
-
-	serverTimeout := osquery.ServerTimeout(
-		time.Second * time.Duration(*timeout),
-	)
-	serverPingInterval := osquery.ServerPingInterval(
-		time.Second * time.Duration(*interval),
-	)
-
-	server, err := osquery.NewExtensionManagerServer(
-		"example_extension",
-		*socket,
-		serverTimeout,
-		serverPingInterval,
-	)
-
-	if err != nil {
-		log.Fatalf("Error creating extension: %s\n", err)
-	}
-	server.RegisterPlugin(config.NewPlugin("example_config", GenerateConfigs, RefreshConfig))
-	log.Println("Starting config extension")
-	if err := server.Run(); err != nil {
-		log.Fatal(err)
-	}
+	osquery.Main("example_extension", func(server *osquery.ExtensionManagerServer) error {
+		server.RegisterPlugin(config.NewPlugin("example_config", GenerateConfigs, RefreshConfig))
+		log.Println("Starting config extension")
+		return nil
+	})
 }
 
 // RefreshConfig callback function invoked when config is refreshed.
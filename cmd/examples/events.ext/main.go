@@ -12,7 +12,6 @@ import (
 )
 
 var (
-	//lint:ignore U1000 Argument is required by basequery
 	verbose  = flag.Bool("verbose", false, "Verbose mode")
 	socket   = flag.String("socket", "", "Path to the extensions UNIX domain socket")
 	timeout  = flag.Int("timeout", 3, "Seconds to wait for autoloaded extensions")
@@ -38,6 +37,9 @@ func main() {
 		serverTimeout,
 		serverPingInterval,
 		serverPromPort,
+		osquery.ServerVerbose(*verbose),
+		// The server records the events streamed by its client
+		osquery.ServerClientOptions(osquery.ClientEventBuffer(10000, osquery.DropOldest)),
 	)
 
 	if err != nil {
@@ -47,7 +49,7 @@ func main() {
 
 	go func() {
 		time.Sleep(time.Second * 5)
-		client, _ := osquery.NewClient(*socket, time.Second*time.Duration(*timeout))
+		client := server.GetClient()
 
 		var index int64 = 0
 		for {
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"flag"
 	"log"
 
 	osquery "github.com/Uptycs/basequery-go"
@@ -10,19 +9,10 @@ import (
 )
 
 func main() {
-	socketPath := flag.String("socket", "", "path to osqueryd extensions socket")
-	flag.Int("timeout", 0, "")
-	flag.Int("interval", 0, "")
-	flag.Parse()
-
-	server, err := osquery.NewExtensionManagerServer("example_logger", *socketPath)
-	if err != nil {
-		log.Fatalf("Error creating extension: %s\n", err)
-	}
-	server.RegisterPlugin(logger.NewPlugin("example_logger", LogString))
-	if err := server.Run(); err != nil {
-		log.Fatal(err)
-	}
+	osquery.Main("example_logger", func(server *osquery.ExtensionManagerServer) error {
+		server.RegisterPlugin(logger.NewPlugin("example_logger", LogString))
+		return nil
+	})
 }
 
 // LogString logs the provided text to console.
@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"flag"
-	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -13,7 +12,6 @@ import (
 )
 
 var (
-	//lint:ignore U1000 Argument is required by basequery
 	verbose     = flag.Bool("verbose", false, "Verbose mode")
 	socket      = flag.String("socket", "", "Path to the extensions UNIX domain socket")
 	timeout     = flag.Int("timeout", 3, "Seconds to wait for autoloaded extensions")
@@ -56,13 +54,14 @@ func main() {
 		serverTimeout,
 		serverPingInterval,
 		serverPromPort,
+		osquery.ServerVerbose(*verbose),
 	)
 
 	if err != nil {
 		log.Fatalf("Error creating extension: %s\n", err)
 	}
 	server.RegisterPlugin(table.NewPlugin("example_table", ExampleColumns(), ExampleGenerate))
-	server.RegisterPlugin(table.NewMutablePlugin("mutable_table", MutableColumns(), MutableGenerate, MutableInsert, MutableUpdate, MutableDelete))
+	server.RegisterPlugin(table.NewMutablePlugin("mutable_table", MutableColumns(), MutableGenerate, MutableInsert, MutableUpdate, MutableDelete, table.UseNumber()))
 	if err := server.Run(); err != nil {
 		log.Fatal(err)
 	}
@@ -107,31 +106,31 @@ func MutableGenerate(ctx context.Context, queryContext table.QueryContext) ([]ma
 	return mutableData, nil
 }
 
-// MutableInsert is called when mutable table is inserted into
+// MutableInsert is called when mutable table is inserted into. The materialized row is returned to osquery.
 func MutableInsert(ctx context.Context, autoRowID bool, row []interface{}) ([]map[string]string, error) {
-	id := fmt.Sprintf("%d", int(row[0].(float64)))
+	inserted, err := mutableRow(row)
+	if err != nil {
+		return nil, err
+	}
 	lock.Lock()
-	mutableData = append(mutableData, map[string]string{
-		"i": id,
-		"b": fmt.Sprintf("%v", row[1]),
-		"d": fmt.Sprintf("%f", row[2]),
-		"t": fmt.Sprintf("%s", row[3]),
-	})
+	mutableData = append(mutableData, inserted)
 	lock.Unlock()
 
-	return []map[string]string{{"id": id, "status": "success"}}, nil
+	// The row ID is assigned by the SDK when osquery does not supply one
+	if id, ok := table.AutoRowID(ctx); ok {
+		return table.InsertedRow(id, inserted), nil
+	}
+	return []map[string]string{{"status": string(table.RowSuccess)}, inserted}, nil
 }
 
 // MutableUpdate is called when mutable tale is updated
 func MutableUpdate(ctx context.Context, rowID int64, row []interface{}) error {
-	id := fmt.Sprintf("%d", int(row[0].(float64)))
-	lock.Lock()
-	mutableData[rowID] = map[string]string{
-		"i": id,
-		"b": fmt.Sprintf("%v", row[1]),
-		"d": fmt.Sprintf("%f", row[2]),
-		"t": fmt.Sprintf("%s", row[3]),
+	updated, err := mutableRow(row)
+	if err != nil {
+		return err
 	}
+	lock.Lock()
+	mutableData[rowID] = updated
 	lock.Unlock()
 
 	return nil
@@ -145,3 +144,16 @@ func MutableDelete(ctx context.Context, rowID int64) error {
 
 	return nil
 }
+
+// mutableRow formats the values of an inserted or updated row.
+func mutableRow(row []interface{}) (map[string]string, error) {
+	formatted := map[string]string{}
+	for i, column := range MutableColumns() {
+		value, err := table.FormatValue(row[i])
+		if err != nil {
+			return nil, err
+		}
+		formatted[column.Name] = value
+	}
+	return formatted, nil
+}
@@ -0,0 +1,109 @@
+package osquery
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"io"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// zlibHeader is the first byte of a zlib stream using the default window.
+// Thrift binary (0x80 or 0x00) and compact (0x82) messages never start with
+// it, so it identifies clients sending compressed requests.
+const zlibHeader = 0x78
+
+// ServerCompression enables zlib compression of the responses sent to clients
+// that send zlib compressed requests (eg. using thrift.TZlibTransport). This
+// is detected from the first byte received on each connection, so clients not
+// using compression, such as osquery, are served as usual.
+func ServerCompression(enabled bool) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.compression = enabled
+	}
+}
+
+// compressionServerTransport wraps the accepted connections in transports
+// detecting and applying compression.
+type compressionServerTransport struct {
+	thrift.TServerTransport
+}
+
+// Accept waits for the next connection.
+func (t *compressionServerTransport) Accept() (thrift.TTransport, error) {
+	trans, err := t.TServerTransport.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &compressionTransport{TTransport: trans}, nil
+}
+
+// compressionTransport compresses the connection if its first byte is the
+// start of a zlib stream, and otherwise passes the data through.
+type compressionTransport struct {
+	thrift.TTransport
+	detected   bool
+	compressed bool
+	pending    []byte // Data read while detecting compression
+	reader     io.ReadCloser
+	writer     *zlib.Writer
+}
+
+func (t *compressionTransport) detect() error {
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(t.TTransport, first); err != nil {
+		return err
+	}
+	t.detected = true
+
+	if first[0] != zlibHeader {
+		t.pending = first
+		return nil
+	}
+
+	reader, err := zlib.NewReader(io.MultiReader(bytes.NewReader(first), t.TTransport))
+	if err != nil {
+		return thrift.NewTTransportExceptionFromError(err)
+	}
+	t.compressed = true
+	t.reader = reader
+	t.writer = zlib.NewWriter(t.TTransport)
+	return nil
+}
+
+// Read reads from the connection, decompressing if needed.
+func (t *compressionTransport) Read(p []byte) (int, error) {
+	if !t.detected {
+		if err := t.detect(); err != nil {
+			return 0, err
+		}
+	}
+	if t.compressed {
+		return t.reader.Read(p)
+	}
+	if len(t.pending) > 0 {
+		n := copy(p, t.pending)
+		t.pending = t.pending[n:]
+		return n, nil
+	}
+	return t.TTransport.Read(p)
+}
+
+// Write writes to the connection, compressing if needed.
+func (t *compressionTransport) Write(p []byte) (int, error) {
+	if t.compressed {
+		return t.writer.Write(p)
+	}
+	return t.TTransport.Write(p)
+}
+
+// Flush flushes the compressed data, if any, and the connection.
+func (t *compressionTransport) Flush(ctx context.Context) error {
+	if t.compressed {
+		if err := t.writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return t.TTransport.Flush(ctx)
+}
@@ -0,0 +1,130 @@
+package osquery
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/Uptycs/basequery-go/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingTransport counts the bytes read from the wrapped transport.
+type countingTransport struct {
+	thrift.TTransport
+	read int
+}
+
+func (t *countingTransport) Read(p []byte) (int, error) {
+	n, err := t.TTransport.Read(p)
+	t.read += n
+	return n, err
+}
+
+// startDocumentServer starts a server with the specified options, serving a
+// table of JSON documents, and returns the path of the extension socket.
+func startDocumentServer(tb testing.TB, rows int, opts ...ServerOption) string {
+	tempPath, err := ioutil.TempFile("", "")
+	require.NoError(tb, err)
+	tb.Cleanup(func() { os.Remove(tempPath.Name()) })
+
+	server := newTestServer(NewMockExtensionManager(), tempPath.Name())
+	for _, opt := range opts {
+		opt(server)
+	}
+	server.RegisterPlugin(table.NewPlugin("documents", []table.ColumnDefinition{table.IntegerColumn("id"), table.TextColumn("document")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			results := make([]map[string]string, 0, rows)
+			for i := 0; i < rows; i++ {
+				results = append(results, map[string]string{
+					"id":       strconv.Itoa(i),
+					"document": fmt.Sprintf(`{"id":%d,"name":"process","path":"/usr/bin/process","labels":{"env":"production","team":"security"}}`, i),
+				})
+			}
+			return results, nil
+		}))
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Start()
+	}()
+	server.waitStarted()
+	tb.Cleanup(func() {
+		server.Shutdown(context.Background())
+		select {
+		case <-completed:
+		case <-time.After(5 * time.Second):
+			tb.Error("hung on shutdown")
+		}
+	})
+
+	return tempPath.Name() + ".0"
+}
+
+// newCallClient connects to the extension socket, compressing the requests if
+// compress is true. Reads are buffered in both cases, like osquery does.
+func newCallClient(tb testing.TB, sockPath string, compress bool) (*osquery.ExtensionClient, *countingTransport) {
+	sock, err := transport.Open(sockPath, time.Second)
+	require.NoError(tb, err)
+	tb.Cleanup(func() { sock.Close() })
+
+	counting := &countingTransport{TTransport: sock}
+	var trans thrift.TTransport = thrift.NewTBufferedTransport(counting, 64*1024)
+	if compress {
+		trans, err = thrift.NewTZlibTransport(counting, -1)
+		require.NoError(tb, err)
+	}
+	return osquery.NewExtensionClientFactory(trans, thrift.NewTBinaryProtocolFactoryConf(&thrift.TConfiguration{})), counting
+}
+
+func TestServerCompression(t *testing.T) {
+	sockPath := startDocumentServer(t, 1000, ServerCompression(true))
+	request := osquery.ExtensionPluginRequest{"action": "generate"}
+
+	plain, plainTrans := newCallClient(t, sockPath, false)
+	compressed, compressedTrans := newCallClient(t, sockPath, true)
+
+	for i := 0; i < 2; i++ {
+		expected, err := plain.Call(context.Background(), "table", "documents", request)
+		require.NoError(t, err)
+		require.Equal(t, int32(0), expected.Status.Code)
+		require.Len(t, expected.Response, 1000)
+
+		resp, err := compressed.Call(context.Background(), "table", "documents", request)
+		require.NoError(t, err)
+		assert.Equal(t, expected, resp)
+	}
+	assert.Less(t, compressedTrans.read, plainTrans.read/4)
+}
+
+func benchmarkCompression(b *testing.B, compress bool) {
+	sockPath := startDocumentServer(b, 10000, ServerCompression(true))
+	client, trans := newCallClient(b, sockPath, compress)
+	request := osquery.ExtensionPluginRequest{"action": "generate"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := client.Call(context.Background(), "table", "documents", request)
+		if err != nil || len(resp.Response) != 10000 {
+			b.Fatalf("unexpected response: %v", err)
+		}
+	}
+	b.ReportMetric(float64(trans.read)/float64(b.N), "wire-B/op")
+}
+
+func BenchmarkCallUncompressed(b *testing.B) {
+	benchmarkCompression(b, false)
+}
+
+func BenchmarkCallCompressed(b *testing.B) {
+	benchmarkCompression(b, true)
+}
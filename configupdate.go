@@ -0,0 +1,83 @@
+package osquery
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/pkg/errors"
+)
+
+// defaultConfigTarget is the osquery config plugin the config updates are
+// sent to by default. The "update" action is implemented by the base config
+// plugin of osquery, so it is handled by any config plugin built into osquery,
+// and filesystem is always built in.
+const defaultConfigTarget = "filesystem"
+
+// ServerConfigUpdateTarget sets the osquery config plugin UpdateConfig sends
+// the configs to, eg. the plugin of --config_plugin when osquery is built
+// without the filesystem plugin. The plugins of the extension cannot be used,
+// as osquery routes their calls back to it. By default, the updates are sent
+// to the filesystem plugin.
+func ServerConfigUpdateTarget(plugin string) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.configTarget = plugin
+	}
+}
+
+// UpdateConfig pushes the configs generated by the config plugins of the
+// extension to osquery, eg. when the backing store changed, instead of waiting
+// for osquery to refresh its config (every --config_refresh seconds). Each
+// config source is sent with the "update" action (see
+// ServerConfigUpdateTarget), which makes osquery replace the source and reload
+// its config. Plugins registered under several names generate their configs
+// once.
+func (s *ExtensionManagerServer) UpdateConfig(ctx context.Context) error {
+	s.mutex.Lock()
+	names := make([]string, 0, len(s.registry["config"]))
+	for name := range s.registry["config"] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var plugins []Plugin
+	var pluginNames []string
+	seen := map[Plugin]bool{}
+	for _, name := range names {
+		plugin := s.registry["config"][name]
+		if reflect.TypeOf(plugin).Comparable() {
+			if seen[plugin] {
+				continue
+			}
+			seen[plugin] = true
+		}
+		plugins = append(plugins, plugin)
+		pluginNames = append(pluginNames, name)
+	}
+	target := s.configTarget
+	if target == "" {
+		target = defaultConfigTarget
+	}
+	client := s.serverClient
+	s.mutex.Unlock()
+
+	for i, plugin := range plugins {
+		response := plugin.Call(ctx, osquery.ExtensionPluginRequest{"action": "genConfig"})
+		if response.Status != nil && response.Status.Code != 0 {
+			return errors.Errorf("generating config of %s: %s", pluginNames[i], response.Status.Message)
+		}
+		for _, configs := range response.Response {
+			for source, data := range configs {
+				request := osquery.ExtensionPluginRequest{"action": "update", "source": source, "data": data}
+				resp, err := client.Call("config", target, request)
+				if err != nil {
+					return errors.Wrapf(err, "updating config source %s", source)
+				}
+				if resp.Status != nil && resp.Status.Code != 0 {
+					return errors.Errorf("updating config source %s: %s", source, resp.Status.Message)
+				}
+			}
+		}
+	}
+	return nil
+}
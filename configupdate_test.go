@@ -0,0 +1,66 @@
+package osquery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateConfig(t *testing.T) {
+	var requests []osquery.ExtensionPluginRequest
+	mock := NewMockExtensionManager()
+	mock.CallFunc = func(registry string, item string, req osquery.ExtensionPluginRequest) (*osquery.ExtensionResponse, error) {
+		assert.Equal(t, "config", registry)
+		assert.Equal(t, "filesystem", item)
+		requests = append(requests, req)
+		return &osquery.ExtensionResponse{Status: &osquery.ExtensionStatus{Code: 0}}, nil
+	}
+	server := newTestServer(mock, "")
+
+	var genErr error
+	server.RegisterPlugin(config.NewPlugin("store", func(ctx context.Context) (map[string]string, error) {
+		return map[string]string{"store": `{"options":{}}`}, genErr
+	}, nil))
+
+	require.NoError(t, server.UpdateConfig(context.Background()))
+	assert.Equal(t, []osquery.ExtensionPluginRequest{
+		{"action": "update", "source": "store", "data": `{"options":{}}`},
+	}, requests)
+
+	mock.CallFunc = func(registry string, item string, req osquery.ExtensionPluginRequest) (*osquery.ExtensionResponse, error) {
+		return &osquery.ExtensionResponse{Status: &osquery.ExtensionStatus{Code: 1, Message: "invalid config"}}, nil
+	}
+	assert.EqualError(t, server.UpdateConfig(context.Background()), "updating config source store: invalid config")
+
+	genErr = errors.New("store unavailable")
+	assert.EqualError(t, server.UpdateConfig(context.Background()), "generating config of store: error getting config: store unavailable")
+}
+
+func TestUpdateConfigTargetAndAliases(t *testing.T) {
+	var items []string
+	var sources []string
+	mock := NewMockExtensionManager()
+	mock.CallFunc = func(registry string, item string, req osquery.ExtensionPluginRequest) (*osquery.ExtensionResponse, error) {
+		items = append(items, item)
+		sources = append(sources, req["source"])
+		return &osquery.ExtensionResponse{Status: &osquery.ExtensionStatus{Code: 0}}, nil
+	}
+	server := newTestServer(mock, "")
+	ServerConfigUpdateTarget("tls")(server)
+
+	// Registered only under aliases, once per plugin
+	plugin := config.NewPlugin("store", func(ctx context.Context) (map[string]string, error) {
+		return map[string]string{"store": `{}`}, nil
+	}, nil)
+	server.RegisterPluginAs("primary", plugin)
+	server.RegisterPluginAs("secondary", plugin)
+
+	require.NoError(t, server.UpdateConfig(context.Background()))
+	assert.Equal(t, []string{"tls"}, items)
+	assert.Equal(t, []string{"store"}, sources)
+}
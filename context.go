@@ -0,0 +1,36 @@
+package osquery
+
+import "context"
+
+type clientKey struct{}
+
+// WithClient returns a copy of ctx carrying the client. The server uses it to
+// pass its client to the plugins, and tests can use it to call plugins with a
+// client backed by a mock.
+func WithClient(ctx context.Context, client *ExtensionManagerClient) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFromContext returns the client carried by ctx, or nil if there is
+// none. The context passed to plugin calls carries the client of the server,
+// so that eg. a table can query other tables while generating its rows:
+//
+//	rows, err := osquery.ClientFromContext(ctx).QueryRows("SELECT * FROM users")
+func ClientFromContext(ctx context.Context) *ExtensionManagerClient {
+	client, _ := ctx.Value(clientKey{}).(*ExtensionManagerClient)
+	return client
+}
+
+type registryKey struct{}
+
+func withRegistry(ctx context.Context, registry string) context.Context {
+	return context.WithValue(ctx, registryKey{}, registry)
+}
+
+// RegistryFromContext returns the registry a plugin call was made for (eg.
+// "table"), or an empty string if ctx is not the context of a plugin call.
+// Plugins implementing several registries use it to tell the calls apart.
+func RegistryFromContext(ctx context.Context) string {
+	registry, _ := ctx.Value(registryKey{}).(string)
+	return registry
+}
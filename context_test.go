@@ -0,0 +1,38 @@
+package osquery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/mock"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientFromContext(t *testing.T) {
+	assert.Nil(t, ClientFromContext(context.Background()))
+
+	mock := mock.NewExtensionManager()
+	mock.QueryFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		return &osquery.ExtensionResponse{
+			Status:   &osquery.ExtensionStatus{Code: 0},
+			Response: []map[string]string{{"username": "root"}},
+		}, nil
+	}
+	client := &ExtensionManagerClient{Client: mock}
+
+	// Plugins get the client of the server
+	server := newTestServer(client, "")
+	server.RegisterPlugin(table.NewPlugin("enriched", []table.ColumnDefinition{table.TextColumn("username")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return ClientFromContext(ctx).QueryRows("SELECT username FROM users")
+		}))
+	resp, err := server.Call(context.Background(), "table", "enriched", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"username": "root"}}, resp.Response)
+
+	assert.Equal(t, client, ClientFromContext(WithClient(context.Background(), client)))
+}
@@ -0,0 +1,204 @@
+package osquery
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/pkg/errors"
+)
+
+// DropPolicy determines what StreamEvents does when the event buffer of the
+// client is full.
+type DropPolicy int
+
+const (
+	// DropOldest discards the oldest buffered events to make room for the
+	// new ones.
+	DropOldest DropPolicy = iota
+
+	// Block waits until buffered events are sent to osquery.
+	Block
+)
+
+// ClientEventBuffer makes StreamEvents add the events to a buffer holding at
+// most capacity events, which are sent to osquery in the background. This
+// bounds the memory used when osquery consumes events slower than they are
+// produced. policy determines what happens to new events when the buffer is
+// full. A capacity <= 0 disables the buffer.
+func ClientEventBuffer(capacity int, policy DropPolicy) ClientOption {
+	return func(c *ExtensionManagerClient) {
+		if capacity > 0 {
+			c.events = newEventBuffer(capacity, policy)
+		} else {
+			c.events = nil
+		}
+	}
+}
+
+type bufferedEvent struct {
+	name  string
+	event map[string]string
+}
+
+// eventBuffer holds the events streamed by the client until they are sent.
+type eventBuffer struct {
+	capacity int
+	policy   DropPolicy
+	mutex    sync.Mutex
+	cond     *sync.Cond // Signalled when events are added, taken or the buffer is closed
+	events   []bufferedEvent
+	sending  bool  // Whether taken events are being sent to osquery
+	err      error // First error sending events since the last flush
+	closed   bool
+}
+
+func newEventBuffer(capacity int, policy DropPolicy) *eventBuffer {
+	b := &eventBuffer{capacity: capacity, policy: policy}
+	b.cond = sync.NewCond(&b.mutex)
+	return b
+}
+
+// add appends the events to the buffer, applying the drop policy when the
+// buffer is full. Events added after the buffer is closed are discarded.
+func (b *eventBuffer) add(name string, events []map[string]string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, event := range events {
+		for len(b.events) >= b.capacity && !b.closed {
+			if b.policy == DropOldest {
+				b.events = b.events[1:]
+				continue
+			}
+			b.cond.Wait()
+		}
+		if b.closed {
+			return
+		}
+		b.events = append(b.events, bufferedEvent{name, event})
+		b.cond.Broadcast()
+	}
+}
+
+// take waits for buffered events and removes the leading events of the same
+// table from the buffer. ok is false once the buffer is closed.
+func (b *eventBuffer) take() (name string, events osquery.ExtensionPluginResponse, ok bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for len(b.events) == 0 && !b.closed {
+		b.cond.Wait()
+	}
+	if b.closed {
+		return "", nil, false
+	}
+
+	name = b.events[0].name
+	n := 0
+	for n < len(b.events) && b.events[n].name == name {
+		events = append(events, b.events[n].event)
+		n++
+	}
+	b.events = b.events[n:]
+	b.sending = true
+	b.cond.Broadcast()
+	return name, events, true
+}
+
+// sent marks the events returned by take as sent, recording the error if the
+// send failed.
+func (b *eventBuffer) sent(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.sending = false
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	b.cond.Broadcast()
+}
+
+// flush waits until all the buffered events are sent or ctx is done.
+func (b *eventBuffer) flush(ctx context.Context) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.mutex.Lock()
+			b.cond.Broadcast()
+			b.mutex.Unlock()
+		case <-stop:
+		}
+	}()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for (len(b.events) > 0 || b.sending) && !b.closed && ctx.Err() == nil {
+		b.cond.Wait()
+	}
+
+	if len(b.events) > 0 || b.sending {
+		if b.closed {
+			return errors.Errorf("client closed with %d unsent events", len(b.events))
+		}
+		return ctx.Err()
+	}
+
+	err := b.err
+	b.err = nil
+	return err
+}
+
+func (b *eventBuffer) close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	b.cond.Broadcast()
+}
+
+// startEvents starts sending the buffered events, if the buffer is enabled.
+func (c *ExtensionManagerClient) startEvents() {
+	if c.events != nil {
+		go c.sendEvents()
+	}
+}
+
+// FlushEvents waits until all the events in the event buffer are sent to
+// osquery, or the context is done. It returns the first error sending events
+// since the previous flush, since events that osquery fails to accept are
+// discarded. Nothing is done if the event buffer is not enabled.
+func (c *ExtensionManagerClient) FlushEvents(ctx context.Context) error {
+	if c.events == nil {
+		return nil
+	}
+	return c.events.flush(ctx)
+}
+
+// sendEvents sends the buffered events to osquery until the buffer is closed.
+func (c *ExtensionManagerClient) sendEvents() {
+	for {
+		name, events, ok := c.events.take()
+		if !ok {
+			return
+		}
+		c.events.sent(c.streamEvents(name, events))
+	}
+}
+
+// streamEvents sends the events to osquery, returning an error if either the
+// call or osquery fails.
+func (c *ExtensionManagerClient) streamEvents(name string, events osquery.ExtensionPluginResponse) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	status, err := c.Client.StreamEvents(context.Background(), name, events)
+	c.observeEvents(name, len(events), err == nil && (status == nil || status.Code == 0))
+	if err != nil {
+		return errors.Wrap(err, "transport error streaming events")
+	}
+	if status != nil && status.Code != 0 {
+		return errors.Errorf("streaming events returned error: %s", status.Message)
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package osquery
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/mock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEventClient returns a buffering client whose streamed batches are
+// delivered on the returned channel once released.
+func newEventClient(capacity int, policy DropPolicy) (*ExtensionManagerClient, chan osquery.ExtensionPluginResponse, chan struct{}) {
+	batches := make(chan osquery.ExtensionPluginResponse, 100)
+	release := make(chan struct{})
+	mock := mock.NewExtensionManager()
+	mock.StreamEventsFunc = func(ctx context.Context, name string, events osquery.ExtensionPluginResponse) (*osquery.ExtensionStatus, error) {
+		batches <- events
+		<-release
+		return &osquery.ExtensionStatus{Code: 0, Message: "OK"}, nil
+	}
+
+	client := &ExtensionManagerClient{Client: mock}
+	ClientEventBuffer(capacity, policy)(client)
+	client.startEvents()
+	return client, batches, release
+}
+
+func events(from, to int) osquery.ExtensionPluginResponse {
+	var result osquery.ExtensionPluginResponse
+	for i := from; i < to; i++ {
+		result = append(result, map[string]string{"n": strconv.Itoa(i)})
+	}
+	return result
+}
+
+func receive(t *testing.T, batches chan osquery.ExtensionPluginResponse) osquery.ExtensionPluginResponse {
+	select {
+	case batch := <-batches:
+		return batch
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for events")
+		return nil
+	}
+}
+
+func TestEventBufferDropOldest(t *testing.T) {
+	client, batches, release := newEventClient(2, DropOldest)
+	defer client.Close()
+
+	status, err := client.StreamEvents("events", events(0, 1))
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), status.Code)
+	assert.Equal(t, events(0, 1), receive(t, batches))
+
+	// The sender is blocked in osquery, so only the newest events are kept
+	_, err = client.StreamEvents("events", events(1, 6))
+	require.NoError(t, err)
+	close(release)
+	assert.Equal(t, events(4, 6), receive(t, batches))
+}
+
+func TestEventBufferBlock(t *testing.T) {
+	client, batches, release := newEventClient(1, Block)
+	defer client.Close()
+
+	_, err := client.StreamEvents("events", events(0, 1))
+	require.NoError(t, err)
+	assert.Equal(t, events(0, 1), receive(t, batches))
+
+	done := make(chan struct{})
+	go func() {
+		client.StreamEvents("events", events(1, 3))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("StreamEvents did not block on a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	assert.Equal(t, events(1, 2), receive(t, batches))
+	assert.Equal(t, events(2, 3), receive(t, batches))
+	<-done
+}
+
+func TestEventBufferBatchesByTable(t *testing.T) {
+	buffer := newEventBuffer(10, Block)
+	buffer.add("a", events(0, 2))
+	buffer.add("b", events(2, 3))
+	buffer.add("a", events(3, 4))
+
+	name, batch, ok := buffer.take()
+	require.True(t, ok)
+	assert.Equal(t, "a", name)
+	assert.Equal(t, events(0, 2), batch)
+
+	name, batch, _ = buffer.take()
+	assert.Equal(t, "b", name)
+	assert.Equal(t, events(2, 3), batch)
+
+	buffer.close()
+	_, _, ok = buffer.take()
+	assert.False(t, ok)
+}
+
+func TestFlushEvents(t *testing.T) {
+	client, batches, release := newEventClient(10, Block)
+	defer client.Close()
+
+	_, err := client.StreamEvents("events", events(0, 1))
+	require.NoError(t, err)
+	assert.Equal(t, events(0, 1), receive(t, batches))
+	_, err = client.StreamEvents("events", events(1, 3))
+	require.NoError(t, err)
+
+	// The flush times out while osquery does not accept the events
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, client.FlushEvents(ctx))
+
+	close(release)
+	require.NoError(t, client.FlushEvents(context.Background()))
+	assert.Equal(t, events(1, 3), receive(t, batches))
+}
+
+func TestFlushEventsError(t *testing.T) {
+	mock := mock.NewExtensionManager()
+	mock.StreamEventsFunc = func(ctx context.Context, name string, events osquery.ExtensionPluginResponse) (*osquery.ExtensionStatus, error) {
+		return &osquery.ExtensionStatus{Code: 1, Message: "unknown table"}, nil
+	}
+	client := &ExtensionManagerClient{Client: mock}
+	ClientEventBuffer(10, Block)(client)
+	client.startEvents()
+
+	_, err := client.StreamEvents("events", events(0, 1))
+	require.NoError(t, err)
+	assert.EqualError(t, client.FlushEvents(context.Background()), "streaming events returned error: unknown table")
+	assert.NoError(t, client.FlushEvents(context.Background()))
+
+	client.Close()
+	client.events.add("events", events(0, 1))
+	assert.NoError(t, client.FlushEvents(context.Background()))
+
+	// Without a buffer there is nothing to flush
+	assert.NoError(t, (&ExtensionManagerClient{Client: mock}).FlushEvents(context.Background()))
+}
+
+func TestShutdownFlushesEvents(t *testing.T) {
+	client, batches, release := newEventClient(10, Block)
+	defer client.Close()
+	close(release)
+
+	server := newTestServer(client, "")
+	_, err := client.StreamEvents("events", events(0, 2))
+	require.NoError(t, err)
+	require.NoError(t, server.Shutdown(context.Background()))
+
+	select {
+	case batch := <-batches:
+		assert.Equal(t, events(0, 2), batch)
+	default:
+		t.Fatal("events were not sent before shutdown returned")
+	}
+}
+
+type eventSink struct {
+	mutex   sync.Mutex
+	events  map[string]int
+	batches map[string]int
+	errors  map[string]int
+}
+
+func newEventSink() *eventSink {
+	return &eventSink{events: map[string]int{}, batches: map[string]int{}, errors: map[string]int{}}
+}
+
+func (s *eventSink) AddEvents(table string, events int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events[table] += events
+}
+
+func (s *eventSink) IncBatch(table string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.batches[table]++
+}
+
+func (s *eventSink) IncStreamError(table string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.errors[table]++
+}
+
+func TestClientEventMetrics(t *testing.T) {
+	mock := mock.NewExtensionManager()
+	mock.StreamEventsFunc = func(ctx context.Context, name string, events osquery.ExtensionPluginResponse) (*osquery.ExtensionStatus, error) {
+		if name == "unknown" {
+			return &osquery.ExtensionStatus{Code: 1, Message: "unknown table"}, nil
+		}
+		return &osquery.ExtensionStatus{Code: 0, Message: "OK"}, nil
+	}
+
+	sink := newEventSink()
+	client := &ExtensionManagerClient{Client: mock}
+	ClientEventMetrics(sink)(client)
+	_, err := client.StreamEvents("events", events(0, 2))
+	require.NoError(t, err)
+	_, err = client.StreamEvents("unknown", events(0, 1))
+	require.NoError(t, err)
+
+	// Buffered events are recorded once sent
+	buffered := newEventSink()
+	bufferedClient := &ExtensionManagerClient{Client: mock}
+	ClientEventBuffer(10, Block)(bufferedClient)
+	ClientEventMetrics(buffered)(bufferedClient)
+	bufferedClient.startEvents()
+	defer bufferedClient.Close()
+	_, err = bufferedClient.StreamEvents("events", events(0, 3))
+	require.NoError(t, err)
+	_, err = bufferedClient.StreamEvents("unknown", events(0, 1))
+	require.NoError(t, err)
+	assert.Error(t, bufferedClient.FlushEvents(context.Background()))
+
+	for _, s := range []*eventSink{sink, buffered} {
+		assert.Equal(t, 1, s.batches["events"])
+		assert.Equal(t, 0, s.batches["unknown"])
+		assert.Equal(t, 0, s.errors["events"])
+		assert.Equal(t, 1, s.errors["unknown"])
+	}
+	assert.Equal(t, map[string]int{"events": 2}, sink.events)
+	assert.Equal(t, map[string]int{"events": 3}, buffered.events)
+}
+
+func TestPrometheusEventMetrics(t *testing.T) {
+	mock := mock.NewExtensionManager()
+	mock.StreamEventsFunc = func(ctx context.Context, name string, events osquery.ExtensionPluginResponse) (*osquery.ExtensionStatus, error) {
+		return nil, errors.New("broken pipe")
+	}
+	client := &ExtensionManagerClient{Client: mock}
+	registry := prometheus.NewRegistry()
+	client.setEventMetrics(newPrometheusSink(registry, "", "test"))
+	// A sink already set is kept
+	client.setEventMetrics(newEventSink())
+
+	_, err := client.StreamEvents("events", events(0, 1))
+	assert.Error(t, err)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	assert.Equal(t, "event_stream_errors", families[0].GetName())
+	metric := families[0].GetMetric()[0]
+	assert.Equal(t, float64(1), metric.GetCounter().GetValue())
+	labels := map[string]string{}
+	for _, label := range metric.GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+	assert.Equal(t, map[string]string{"extension": "test", "table_name": "events"}, labels)
+}
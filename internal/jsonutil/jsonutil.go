@@ -0,0 +1,31 @@
+// Package jsonutil encodes the JSON sent by the plugins, so that it is encoded
+// the same way everywhere.
+package jsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// NewEncoder returns an encoder writing to w. Unlike the default encoder, it
+// does not escape the HTML characters (&, < and >) of strings, which osquery
+// and the consumers of its results do not expect to be escaped in config
+// values or queries. Numbers are encoded as by encoding/json: json.Number
+// values are written as is, so integers decoded with UseNumber keep all their
+// digits.
+func NewEncoder(w io.Writer) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder
+}
+
+// Marshal returns the JSON encoding of v, as encoded by NewEncoder but without
+// the trailing newline.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
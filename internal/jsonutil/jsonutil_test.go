@@ -0,0 +1,29 @@
+package jsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshal(t *testing.T) {
+	data, err := Marshal(map[string]interface{}{
+		"query":  "SELECT * FROM users WHERE uid < 500 AND shell <> '' & 1",
+		"big":    json.Number("9007199254740993"),
+		"double": 1.5,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{"big":9007199254740993,"double":1.5,"query":"SELECT * FROM users WHERE uid < 500 AND shell <> '' & 1"}`, string(data))
+
+	_, err = Marshal(func() {})
+	assert.Error(t, err)
+}
+
+func TestNewEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewEncoder(&buf).Encode([]string{"<a>"}))
+	assert.Equal(t, "[\"<a>\"]\n", buf.String())
+}
@@ -0,0 +1,7 @@
+// Package null holds the value of the SQL NULL columns of table plugins,
+// shared by the table package (table.Null) and the server serializing the
+// rows, so that both always agree on it.
+package null
+
+// Value is the value of a column that is SQL NULL, see table.Null.
+const Value = "\x00NULL\x00"
@@ -0,0 +1,33 @@
+// Package stream holds the helpers shared by the streaming tables (see
+// table.NewStreamingPlugin) and the server writing their rows.
+package stream
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Func writes the rows of a streamed result with writeRow.
+type Func func(ctx context.Context, writeRow func(values []string) error) error
+
+// Collect runs the stream into columnar values, for the callers that need the
+// rows in memory. The rows must have a value for each column and their number
+// must match count.
+func Collect(ctx context.Context, columns []string, count int, write Func) ([][]string, error) {
+	values := make([][]string, 0, count)
+	err := write(ctx, func(row []string) error {
+		if len(row) != len(columns) {
+			return errors.Errorf("row %d has %d values, expected %d", len(values), len(row), len(columns))
+		}
+		if len(values) == count {
+			return errors.Errorf("more than the %d declared rows", count)
+		}
+		values = append(values, append([]string(nil), row...))
+		return nil
+	})
+	if err == nil && len(values) < count {
+		err = errors.Errorf("%d rows written, %d declared", len(values), count)
+	}
+	return values, err
+}
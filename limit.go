@@ -0,0 +1,62 @@
+package osquery
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// ServerMaxRequestBytes rejects requests larger than n bytes (after
+// decompression, see ServerCompression). Reading stops once the limit is
+// reached, so the oversized request is never fully decoded; the client gets an
+// error reply and the connection is closed. A n <= 0 removes the limit.
+func ServerMaxRequestBytes(n int) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.maxRequest = n
+	}
+}
+
+// limitServerTransport wraps the accepted connections in transports limiting
+// the size of the requests.
+type limitServerTransport struct {
+	thrift.TServerTransport
+	max int
+}
+
+// Accept waits for the next connection.
+func (t *limitServerTransport) Accept() (thrift.TTransport, error) {
+	trans, err := t.TServerTransport.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &limitTransport{TTransport: trans, max: t.max}, nil
+}
+
+// limitTransport fails reads once more than max bytes are read for a request.
+// The count is reset when the response is flushed.
+type limitTransport struct {
+	thrift.TTransport
+	max  int
+	read int
+}
+
+// Read reads from the connection, up to the request limit.
+func (t *limitTransport) Read(p []byte) (int, error) {
+	if t.read >= t.max {
+		return 0, thrift.NewTTransportException(thrift.UNKNOWN_TRANSPORT_EXCEPTION,
+			fmt.Sprintf("request exceeds the maximum size of %d bytes", t.max))
+	}
+	if len(p) > t.max-t.read {
+		p = p[:t.max-t.read]
+	}
+	n, err := t.TTransport.Read(p)
+	t.read += n
+	return n, err
+}
+
+// Flush flushes the response and resets the request size.
+func (t *limitTransport) Flush(ctx context.Context) error {
+	t.read = 0
+	return t.TTransport.Flush(ctx)
+}
@@ -0,0 +1,49 @@
+package osquery
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerMaxRequestBytes(t *testing.T) {
+	sockPath := startDocumentServer(t, 10, ServerMaxRequestBytes(1024))
+
+	// Requests under the limit are served, repeatedly on the same connection
+	client, _ := newCallClient(t, sockPath, false)
+	for i := 0; i < 3; i++ {
+		resp, err := client.Call(context.Background(), "table", "documents", osquery.ExtensionPluginRequest{
+			"action":  "generate",
+			"padding": strings.Repeat(" ", 512),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int32(0), resp.Status.Code)
+		assert.Len(t, resp.Response, 10)
+	}
+
+	// Oversized requests are rejected
+	client, _ = newCallClient(t, sockPath, false)
+	_, err := client.Call(context.Background(), "table", "documents", osquery.ExtensionPluginRequest{
+		"action":  "generate",
+		"padding": strings.Repeat(" ", 2048),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "request exceeds the maximum size of 1024 bytes")
+}
+
+func TestServerMaxRequestBytesCompressed(t *testing.T) {
+	sockPath := startDocumentServer(t, 10, ServerCompression(true), ServerMaxRequestBytes(1024))
+
+	// The limit applies to the decompressed request
+	client, _ := newCallClient(t, sockPath, true)
+	_, err := client.Call(context.Background(), "table", "documents", osquery.ExtensionPluginRequest{
+		"action":  "generate",
+		"padding": strings.Repeat(" ", 4096),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "request exceeds the maximum size of 1024 bytes")
+}
@@ -0,0 +1,107 @@
+package osquery
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Logger is the leveled logging interface used by the extension manager
+// server for diagnostics. Nothing is logged unless a logger is set using the
+// ServerLogger option.
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Warnf(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// StdLogger is a Logger that writes to a standard library logger.
+type StdLogger struct {
+	logger *log.Logger
+	debug  bool
+}
+
+// NewStdLogger returns a Logger writing to the specified standard library
+// logger. Debug messages are only written if debug is true.
+func NewStdLogger(logger *log.Logger, debug bool) *StdLogger {
+	return &StdLogger{logger: logger, debug: debug}
+}
+
+// Debugf logs a debug message, if debug logging is enabled.
+func (l *StdLogger) Debugf(format string, v ...interface{}) {
+	if l.debug {
+		l.output("DEBUG", format, v...)
+	}
+}
+
+// SetDebug enables or disables debug logging.
+func (l *StdLogger) SetDebug(debug bool) {
+	l.debug = debug
+}
+
+// Infof logs an informational message.
+func (l *StdLogger) Infof(format string, v ...interface{}) {
+	l.output("INFO", format, v...)
+}
+
+// Warnf logs a warning message.
+func (l *StdLogger) Warnf(format string, v ...interface{}) {
+	l.output("WARN", format, v...)
+}
+
+// Errorf logs an error message.
+func (l *StdLogger) Errorf(format string, v ...interface{}) {
+	l.output("ERROR", format, v...)
+}
+
+func (l *StdLogger) output(level string, format string, v ...interface{}) {
+	l.logger.Output(3, level+" "+fmt.Sprintf(format, v...))
+}
+
+func (s *ExtensionManagerServer) debugf(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Debugf(format, v...)
+	}
+}
+
+func (s *ExtensionManagerServer) infof(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Infof(format, v...)
+	}
+}
+
+func (s *ExtensionManagerServer) warnf(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Warnf(format, v...)
+	}
+}
+
+func (s *ExtensionManagerServer) errorf(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Errorf(format, v...)
+	}
+}
+
+// statusRecorder captures the status written by an HTTP handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// accessLog logs the requests to the handler at debug level, eg. to confirm
+// that prometheus is scraping the metrics.
+func (s *ExtensionManagerServer) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		s.debugf("http %s %s from %s status=%d duration=%s", r.Method, r.URL.Path, r.RemoteAddr, recorder.status, time.Since(start))
+	})
+}
@@ -0,0 +1,50 @@
+package osquery
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdLogger(log.New(&buf, "", 0), false)
+	logger.Debugf("debug %d", 1)
+	logger.Infof("info %d", 2)
+	logger.Warnf("warn %d", 3)
+	logger.Errorf("error %d", 4)
+	assert.Equal(t, "INFO info 2\nWARN warn 3\nERROR error 4\n", buf.String())
+
+	buf.Reset()
+	logger = NewStdLogger(log.New(&buf, "", 0), true)
+	logger.Debugf("debug %d", 1)
+	assert.Equal(t, "DEBUG debug 1\n", buf.String())
+}
+
+func TestAccessLog(t *testing.T) {
+	log := &testLogger{}
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerLogger(log)(server)
+	handler := server.accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+		}
+	}))
+
+	for _, path := range []string{"/metrics", "/missing"} {
+		request := httptest.NewRequest("GET", path, nil)
+		request.RemoteAddr = "10.0.0.1:1234"
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	messages := log.Messages()
+	require.Len(t, messages, 2)
+	assert.True(t, strings.HasPrefix(messages[0], "DEBUG http GET /metrics from 10.0.0.1:1234 status=200 duration="), messages[0])
+	assert.True(t, strings.HasPrefix(messages[1], "DEBUG http GET /missing from 10.0.0.1:1234 status=404 duration="), messages[1])
+}
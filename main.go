@@ -0,0 +1,60 @@
+package osquery
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Main runs an extension started by osquery, for extensions that only need to
+// register their plugins:
+//
+//	func main() {
+//		osquery.Main("my_extension", func(server *osquery.ExtensionManagerServer) error {
+//			server.RegisterPlugin(table.NewPlugin("my_table", columns, generate))
+//			return nil
+//		})
+//	}
+//
+// Main parses the flags osquery passes to the extensions (--socket, --timeout
+// and --interval in seconds, and --verbose) along with the flags defined by the
+// extension, which must not call flag.Parse itself. It creates the server with
+// these flags and opts, calls register to add the plugins and runs the server
+// until osquery shuts it down, or SIGINT or SIGTERM is received. An error is
+// logged and exits the process with status 1. Create the server with
+// NewExtensionManagerServer for other needs.
+func Main(name string, register func(*ExtensionManagerServer) error, opts ...ServerOption) {
+	if err := runMain(flag.CommandLine, os.Args[1:], name, register, opts...); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runMain(flags *flag.FlagSet, args []string, name string, register func(*ExtensionManagerServer) error, opts ...ServerOption) error {
+	socket := flags.String("socket", "", "Path to the extensions UNIX domain socket")
+	timeout := flags.Int("timeout", 3, "Seconds to wait for autoloaded extensions")
+	interval := flags.Int("interval", 3, "Seconds delay between connectivity checks")
+	verbose := flags.Bool("verbose", false, "Enable verbose informational messages")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *socket == "" {
+		return errors.New("missing required --socket argument")
+	}
+
+	opts = append([]ServerOption{
+		ServerTimeout(time.Duration(*timeout) * time.Second),
+		ServerPingInterval(time.Duration(*interval) * time.Second),
+		ServerVerbose(*verbose),
+	}, opts...)
+	server, err := NewExtensionManagerServer(name, *socket, opts...)
+	if err != nil {
+		return errors.Wrap(err, "creating extension")
+	}
+	if err := register(server); err != nil {
+		return errors.Wrap(err, "registering plugins")
+	}
+	return server.RunWithSignals()
+}
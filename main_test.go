@@ -0,0 +1,41 @@
+package osquery
+
+import (
+	"errors"
+	"flag"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMain(t *testing.T) {
+	register := func(server *ExtensionManagerServer) error {
+		t.Fatal("registering without a server")
+		return nil
+	}
+	err := runMain(flag.NewFlagSet("test", flag.ContinueOnError), nil, "test", register)
+	assert.EqualError(t, err, "missing required --socket argument")
+
+	sockPath := filepath.Join(t.TempDir(), "osquery.em")
+	listener, err := net.Listen("unix", sockPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	var registered *ExtensionManagerServer
+	register = func(server *ExtensionManagerServer) error {
+		registered = server
+		return errors.New("boom")
+	}
+	args := []string{"--socket", sockPath, "--timeout", "2", "--interval", "4", "--verbose"}
+	err = runMain(flag.NewFlagSet("test", flag.ContinueOnError), args, "test", register, ServerPrometheusPort(3000))
+	assert.EqualError(t, err, "registering plugins: boom")
+	require.NotNil(t, registered)
+	defer registered.serverClient.Close()
+	assert.Equal(t, "2s", registered.timeout.String())
+	assert.Equal(t, "4s", registered.pingInterval.String())
+	assert.True(t, registered.Verbose())
+	assert.Equal(t, uint16(3000), registered.prometheusPort)
+}
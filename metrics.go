@@ -0,0 +1,175 @@
+package osquery
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// MetricsSink records the metrics of the plugin calls. The server records to
+// Prometheus by default when ServerPrometheusPort is set; implement this
+// interface to record to another backend (eg. StatsD or OpenTelemetry) and set
+// it with ServerMetricsSink. The methods are called concurrently.
+type MetricsSink interface {
+	// IncCall counts a call to the plugin action.
+	IncCall(plugin, action string)
+	// ObserveDuration records how long the call took.
+	ObserveDuration(plugin, action string, d time.Duration)
+	// SetRows records the number of rows returned by the call, as a gauge
+	// holding the row count of the last call of the action (not a running
+	// total).
+	SetRows(plugin, action string, rows int)
+	// IncError counts a call that returned a failure status.
+	IncError(plugin, action string)
+}
+
+// ShutdownMetricsSink is optionally implemented by a MetricsSink to record how
+// long the server shutdown takes, eg. to find the plugin slow to stop. The
+// Prometheus sink sets the plugin_shutdown_seconds and shutdown_seconds gauges,
+// which are only scraped if the process outlives the server.
+type ShutdownMetricsSink interface {
+	// ObservePluginShutdown records how long the Shutdown of the plugin took.
+	ObservePluginShutdown(plugin string, d time.Duration)
+	// ObserveShutdown records how long the whole server shutdown took.
+	ObserveShutdown(d time.Duration)
+}
+
+// EventMetricsSink records the events streamed to osquery by a client, set
+// with ClientEventMetrics. The Prometheus sink of the server implements it,
+// and records the events of the server's client (see ServerClientOptions) as
+// the events_streamed, event_batches and event_stream_errors counters. The
+// methods are called concurrently.
+type EventMetricsSink interface {
+	// AddEvents counts the events of the table accepted by osquery.
+	AddEvents(table string, events int)
+	// IncBatch counts a batch of events of the table accepted by osquery.
+	IncBatch(table string)
+	// IncStreamError counts a batch of events of the table that failed to be
+	// streamed, which osquery did not receive.
+	IncStreamError(table string)
+}
+
+// ServerMetricsSink sets the sink recording the metrics of the plugin calls,
+// instead of Prometheus.
+func ServerMetricsSink(sink MetricsSink) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.metrics = sink
+	}
+}
+
+// prometheusSink is the default MetricsSink.
+type prometheusSink struct {
+	calls    *prometheus.CounterVec
+	results  *prometheus.GaugeVec
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	shutdown *prometheus.GaugeVec
+	total    *prometheus.GaugeVec
+	events   *prometheus.CounterVec
+	batches  *prometheus.CounterVec
+	streamEr *prometheus.CounterVec
+}
+
+// newPrometheusSink creates the plugin metrics, registering them with reg. The
+// metrics are labelled with the extension name, so that multiple extensions
+// can be scraped by the same prometheus.
+func newPrometheusSink(reg prometheus.Registerer, namespace string, extension string) *prometheusSink {
+	factory := promauto.With(reg)
+	labels := prometheus.Labels{"extension": extension}
+
+	return &prometheusSink{
+		calls: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "plugin_calls",
+			Help:        "Number of calls to a plugin action",
+			ConstLabels: labels,
+		}, []string{"plugin_name", "plugin_action"}),
+		results: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "plugin_results",
+			Help:        "Number of results returns by plugin action",
+			ConstLabels: labels,
+		}, []string{"plugin_name", "plugin_action"}),
+		duration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "plugin_duration_seconds",
+			Help:        "Histogram for plugin action duration in seconds",
+			ConstLabels: labels,
+		}, []string{"plugin_name", "plugin_action"}),
+		errors: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "plugin_errors",
+			Help:        "Number of failed calls to a plugin action",
+			ConstLabels: labels,
+		}, []string{"plugin_name", "plugin_action"}),
+		shutdown: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "plugin_shutdown_seconds",
+			Help:        "Duration of the plugin shutdown in seconds",
+			ConstLabels: labels,
+		}, []string{"plugin_name"}),
+		// Without labels, but a vector so that it is only exported once set
+		total: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "shutdown_seconds",
+			Help:        "Duration of the extension shutdown in seconds",
+			ConstLabels: labels,
+		}, nil),
+		events: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "events_streamed",
+			Help:        "Number of events streamed to osquery",
+			ConstLabels: labels,
+		}, []string{"table_name"}),
+		batches: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "event_batches",
+			Help:        "Number of batches of events streamed to osquery",
+			ConstLabels: labels,
+		}, []string{"table_name"}),
+		streamEr: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "event_stream_errors",
+			Help:        "Number of batches of events that failed to be streamed",
+			ConstLabels: labels,
+		}, []string{"table_name"}),
+	}
+}
+
+func (p *prometheusSink) IncCall(plugin, action string) {
+	p.calls.WithLabelValues(plugin, action).Inc()
+}
+
+func (p *prometheusSink) ObserveDuration(plugin, action string, d time.Duration) {
+	p.duration.WithLabelValues(plugin, action).Observe(d.Seconds())
+}
+
+// SetRows sets the gauge of the action to the row count of its last call.
+func (p *prometheusSink) SetRows(plugin, action string, rows int) {
+	p.results.WithLabelValues(plugin, action).Set(float64(rows))
+}
+
+func (p *prometheusSink) IncError(plugin, action string) {
+	p.errors.WithLabelValues(plugin, action).Inc()
+}
+
+func (p *prometheusSink) ObservePluginShutdown(plugin string, d time.Duration) {
+	p.shutdown.WithLabelValues(plugin).Set(d.Seconds())
+}
+
+func (p *prometheusSink) ObserveShutdown(d time.Duration) {
+	p.total.WithLabelValues().Set(d.Seconds())
+}
+
+func (p *prometheusSink) AddEvents(table string, events int) {
+	p.events.WithLabelValues(table).Add(float64(events))
+}
+
+func (p *prometheusSink) IncBatch(table string) {
+	p.batches.WithLabelValues(table).Inc()
+}
+
+func (p *prometheusSink) IncStreamError(table string) {
+	p.streamEr.WithLabelValues(table).Inc()
+}
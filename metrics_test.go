@@ -0,0 +1,104 @@
+package osquery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	mutex     sync.Mutex
+	calls     []string
+	rows      []int
+	durations int
+	errors    []string
+}
+
+func (r *recordingSink) IncCall(plugin, action string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = append(r.calls, plugin+"/"+action)
+}
+
+func (r *recordingSink) ObserveDuration(plugin, action string, d time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.durations++
+}
+
+func (r *recordingSink) SetRows(plugin, action string, rows int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.rows = append(r.rows, rows)
+}
+
+func (r *recordingSink) IncError(plugin, action string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.errors = append(r.errors, plugin+"/"+action)
+}
+
+func TestServerMetricsSink(t *testing.T) {
+	sink := &recordingSink{}
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerMetricsSink(sink)(server)
+
+	fail := false
+	server.RegisterPlugin(table.NewPlugin("test", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			if fail {
+				return nil, errors.New("boom")
+			}
+			return []map[string]string{{"a": "1"}, {"a": "2"}}, nil
+		}))
+
+	_, err := server.Call(context.Background(), "table", "test", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+	fail = true
+	_, err = server.Call(context.Background(), "table", "test", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"test/generate", "test/generate"}, sink.calls)
+	assert.Equal(t, []int{2, 0}, sink.rows)
+	assert.Equal(t, 2, sink.durations)
+	assert.Equal(t, []string{"test/generate"}, sink.errors)
+}
+
+type shutdownSink struct {
+	recordingSink
+	plugins []string
+	total   int
+}
+
+func (r *shutdownSink) ObservePluginShutdown(plugin string, d time.Duration) {
+	r.plugins = append(r.plugins, plugin)
+}
+
+func (r *shutdownSink) ObserveShutdown(d time.Duration) {
+	r.total++
+}
+
+func TestShutdownMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	sink := &shutdownSink{}
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerMetricsSink(sink)(server)
+	ServerLogger(NewStdLogger(log.New(&buf, "", 0), false))(server)
+	server.RegisterPlugin(table.NewPlugin("test", []table.ColumnDefinition{table.TextColumn("a")}, nil))
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	require.NoError(t, server.Shutdown(context.Background()))
+	assert.Equal(t, []string{"test"}, sink.plugins)
+	assert.Equal(t, 1, sink.total)
+	assert.Contains(t, buf.String(), "INFO plugin test shut down in ")
+	assert.Contains(t, buf.String(), "INFO extension test shut down in ")
+}
@@ -0,0 +1,58 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+)
+
+var statusOK = osquery.ExtensionStatus{Code: 0, Message: "OK"}
+
+// NewExtensionManager returns a mock extension manager with every function
+// field set to a default implementation that succeeds. Tests can override the
+// individual function fields they are interested in.
+func NewExtensionManager() *ExtensionManager {
+	return &ExtensionManager{
+		CloseFunc: func() {},
+		PingFunc: func(ctx context.Context) (*osquery.ExtensionStatus, error) {
+			status := statusOK
+			return &status, nil
+		},
+		CallFunc: func(ctx context.Context, registry string, item string, req osquery.ExtensionPluginRequest) (*osquery.ExtensionResponse, error) {
+			status := statusOK
+			return &osquery.ExtensionResponse{Status: &status, Response: osquery.ExtensionPluginResponse{}}, nil
+		},
+		ShutdownFunc: func(ctx context.Context) error {
+			return nil
+		},
+		ExtensionsFunc: func(ctx context.Context) (osquery.InternalExtensionList, error) {
+			return osquery.InternalExtensionList{}, nil
+		},
+		RegisterExtensionFunc: func(ctx context.Context, info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+			status := statusOK
+			return &status, nil
+		},
+		DeregisterExtensionFunc: func(ctx context.Context, uuid osquery.ExtensionRouteUUID) (*osquery.ExtensionStatus, error) {
+			status := statusOK
+			return &status, nil
+		},
+		OptionsFunc: func(ctx context.Context) (osquery.InternalOptionList, error) {
+			return osquery.InternalOptionList{}, nil
+		},
+		QueryFunc: func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+			status := statusOK
+			return &osquery.ExtensionResponse{Status: &status, Response: osquery.ExtensionPluginResponse{}}, nil
+		},
+		GetQueryColumnsFunc: func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+			status := statusOK
+			return &osquery.ExtensionResponse{Status: &status, Response: osquery.ExtensionPluginResponse{}}, nil
+		},
+		StreamEventsFunc: func(ctx context.Context, name string, events osquery.ExtensionPluginResponse) (*osquery.ExtensionStatus, error) {
+			status := statusOK
+			return &status, nil
+		},
+		GetNodeKeyFunc: func(ctx context.Context) (string, error) {
+			return "", nil
+		},
+	}
+}
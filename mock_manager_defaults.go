@@ -0,0 +1,84 @@
+package osquery
+
+import "github.com/Uptycs/basequery-go/gen/osquery"
+
+// NewMockExtensionManager returns a MockExtensionManager with every function
+// field set to a default implementation that succeeds. Tests can override the
+// individual function fields (eg. RegisterExtensionFunc or PingFunc) to
+// simulate failures.
+func NewMockExtensionManager() *MockExtensionManager {
+	return &MockExtensionManager{
+		CloseFunc: func() {},
+		PingFunc: func() (*osquery.ExtensionStatus, error) {
+			return &osquery.ExtensionStatus{Code: 0, Message: "OK"}, nil
+		},
+		CallFunc: func(registry string, item string, req osquery.ExtensionPluginRequest) (*osquery.ExtensionResponse, error) {
+			return &osquery.ExtensionResponse{
+				Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+				Response: osquery.ExtensionPluginResponse{},
+			}, nil
+		},
+		ExtensionsFunc: func() (osquery.InternalExtensionList, error) {
+			return osquery.InternalExtensionList{}, nil
+		},
+		RegisterExtensionFunc: func(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+			return &osquery.ExtensionStatus{Code: 0, Message: "OK"}, nil
+		},
+		OptionsFunc: func() (osquery.InternalOptionList, error) {
+			return osquery.InternalOptionList{}, nil
+		},
+		QueryFunc: func(sql string) (*osquery.ExtensionResponse, error) {
+			return &osquery.ExtensionResponse{
+				Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+				Response: osquery.ExtensionPluginResponse{},
+			}, nil
+		},
+		GetQueryColumnsFunc: func(sql string) (*osquery.ExtensionResponse, error) {
+			return &osquery.ExtensionResponse{
+				Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+				Response: osquery.ExtensionPluginResponse{},
+			}, nil
+		},
+		StreamEventsFunc: func(name string, events osquery.ExtensionPluginResponse) (*osquery.ExtensionStatus, error) {
+			return &osquery.ExtensionStatus{Code: 0, Message: "OK"}, nil
+		},
+		GetNodeKeyFunc: func() (string, error) {
+			return "", nil
+		},
+	}
+}
+
+// DeregisterExtensionFunc is the implementation of
+// MockDeregisteringExtensionManager.DeregisterExtension.
+type DeregisterExtensionFunc func(uuid osquery.ExtensionRouteUUID) (*osquery.ExtensionStatus, error)
+
+// MockDeregisteringExtensionManager is a MockExtensionManager that also
+// implements ExtensionDeregisterer, which the server needs to re-register.
+// MockExtensionManager is generated from ExtensionManager only, so the
+// additional method lives here.
+type MockDeregisteringExtensionManager struct {
+	*MockExtensionManager
+
+	DeregisterExtensionFunc        DeregisterExtensionFunc
+	DeregisterExtensionFuncInvoked bool
+}
+
+var _ ExtensionDeregisterer = (*MockDeregisteringExtensionManager)(nil)
+
+// NewMockDeregisteringExtensionManager returns a
+// MockDeregisteringExtensionManager with every function field set to a
+// default implementation that succeeds, as NewMockExtensionManager.
+func NewMockDeregisteringExtensionManager() *MockDeregisteringExtensionManager {
+	return &MockDeregisteringExtensionManager{
+		MockExtensionManager: NewMockExtensionManager(),
+		DeregisterExtensionFunc: func(uuid osquery.ExtensionRouteUUID) (*osquery.ExtensionStatus, error) {
+			return &osquery.ExtensionStatus{Code: 0, Message: "OK"}, nil
+		},
+	}
+}
+
+// DeregisterExtension calls DeregisterExtensionFunc.
+func (m *MockDeregisteringExtensionManager) DeregisterExtension(uuid osquery.ExtensionRouteUUID) (*osquery.ExtensionStatus, error) {
+	m.DeregisterExtensionFuncInvoked = true
+	return m.DeregisterExtensionFunc(uuid)
+}
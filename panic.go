@@ -0,0 +1,79 @@
+package osquery
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/internal/stream"
+	"github.com/pkg/errors"
+)
+
+// ServerPanicFormatter sets the message returned to osquery when a plugin call
+// panics, eg. a generic "internal error" with a correlation ID, since osquery
+// may log the failures of queries centrally. The panic and its stack trace are
+// logged by the server (see ServerLogger) whatever the message. By default the
+// message includes the recovered value.
+func ServerPanicFormatter(format func(recovered interface{}) string) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.panicFormat = format
+	}
+}
+
+// defaultPanicFormat is the message of a panicking call by default.
+func defaultPanicFormat(recovered interface{}) string {
+	return fmt.Sprintf("Plugin panicked: %v", recovered)
+}
+
+// invoke calls the plugin, recovering from a panic of the plugin as a failure
+// status so that a bug of a plugin does not crash the extension.
+func (s *ExtensionManagerServer) invoke(ctx context.Context, registry string, item string, plugin Plugin, request osquery.ExtensionPluginRequest) (result *callResult) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			s.errorf("plugin %s/%s panicked: %v\n%s", registry, item, recovered, debug.Stack())
+			format := s.panicFormat
+			if format == nil {
+				format = defaultPanicFormat
+			}
+			result = &callResult{status: &osquery.ExtensionStatus{Code: 1, Message: format(recovered)}}
+		}
+	}()
+
+	if streaming, ok := plugin.(StreamingPlugin); ok {
+		status, columns, count, write, handled := streaming.CallStreaming(ctx, request)
+		if handled {
+			result := &callResult{status: &status, columns: columns, columnar: true}
+			if status.Code == 0 {
+				result.stream = &rowStream{count: count, write: s.recoverStream(registry, item, write)}
+			}
+			return result
+		}
+	}
+	if columnar, ok := plugin.(ColumnarPlugin); ok {
+		status, columns, values, handled := columnar.CallColumnar(ctx, request)
+		if handled {
+			return &callResult{status: &status, columns: columns, values: values, columnar: true}
+		}
+	}
+	response := plugin.Call(ctx, request)
+	return &callResult{status: response.Status, rows: response.Response}
+}
+
+// recoverStream wraps the function writing the rows of a streaming plugin,
+// which runs after invoke returns, to recover from its panics as well.
+func (s *ExtensionManagerServer) recoverStream(registry string, item string, write stream.Func) stream.Func {
+	return func(ctx context.Context, writeRow func(values []string) error) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				s.errorf("plugin %s/%s panicked: %v\n%s", registry, item, recovered, debug.Stack())
+				format := s.panicFormat
+				if format == nil {
+					format = defaultPanicFormat
+				}
+				err = errors.New(format(recovered))
+			}
+		}()
+		return write(ctx, writeRow)
+	}
+}
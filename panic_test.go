@@ -0,0 +1,40 @@
+package osquery
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPanicRecovered(t *testing.T) {
+	var buf bytes.Buffer
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerLogger(NewStdLogger(log.New(&buf, "", 0), false))(server)
+	server.RegisterPlugin(table.NewPlugin("test", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			var rows []map[string]string
+			return []map[string]string{{"a": rows[1]["a"]}}, nil
+		}))
+	request := osquery.ExtensionPluginRequest{"action": "generate"}
+
+	resp, err := server.Call(context.Background(), "table", "test", request)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Equal(t, "Plugin panicked: runtime error: index out of range [1] with length 0", resp.Status.Message)
+	assert.Contains(t, buf.String(), "ERROR plugin table/test panicked: runtime error: index out of range")
+	assert.Contains(t, buf.String(), "panic_test.go")
+
+	ServerPanicFormatter(func(recovered interface{}) string {
+		return "internal error (id 42)"
+	})(server)
+	resp, err = server.Call(context.Background(), "table", "test", request)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Equal(t, "internal error (id 42)", resp.Status.Message)
+}
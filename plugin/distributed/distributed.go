@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/internal/jsonutil"
 )
 
 // GetQueriesResult contains the information about which queries the
@@ -235,7 +236,7 @@ func (t *Plugin) Call(ctx context.Context, request osquery.ExtensionPluginReques
 			}
 		}
 
-		queryJSON, err := json.Marshal(queries)
+		queryJSON, err := jsonutil.Marshal(queries)
 		if err != nil {
 			return osquery.ExtensionResponse{
 				Status: &osquery.ExtensionStatus{
@@ -206,3 +206,21 @@ func TestHandleResults(t *testing.T) {
 	assert.Len(t, results, 8)
 	assert.Equal(t, &StatusOK, resp.Status)
 }
+
+func TestDistributedPluginQueriesNotEscaped(t *testing.T) {
+	plugin := NewPlugin(
+		"mock",
+		func(context.Context) (*GetQueriesResult, error) {
+			return &GetQueriesResult{
+				Queries: map[string]string{"query1": "select * from users where uid < 500 and shell <> ''"},
+			}, nil
+		},
+		func(ctx context.Context, res []Result) error {
+			return nil
+		},
+	)
+
+	resp := plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "getQueries"})
+	assert.Equal(t, &StatusOK, resp.Status)
+	assert.Equal(t, `{"queries":{"query1":"select * from users where uid < 500 and shell <> ''"}}`, resp.Response[0]["results"])
+}
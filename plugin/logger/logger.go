@@ -7,8 +7,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"strconv"
+	"strings"
 
 	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/pkg/errors"
 )
 
 // LogFunc is the logger function used by an osquery Logger plugin.
@@ -19,18 +22,60 @@ import (
 // for cancellation in long-running operations.
 type LogFunc func(ctx context.Context, typ LogType, log string) error
 
+// StatusFunc is the function used to log parsed status logs. It can be set
+// using the StatusHandler option to get access to the status log severity.
+type StatusFunc func(ctx context.Context, status StatusLog) error
+
 // Plugin is an osquery logger plugin.
 // The Plugin struct implements the OsqueryPlugin interface.
 type Plugin struct {
-	name  string
-	logFn LogFunc
+	name        string
+	logFn       LogFunc
+	statusFn    StatusFunc
+	minSeverity Severity
+	logTypes    map[LogType]bool
+}
+
+// Option is function for setting logger plugin options.
+type Option func(*Plugin)
+
+// MinSeverity drops status logs with a severity lower than the specified one.
+func MinSeverity(severity Severity) Option {
+	return func(p *Plugin) {
+		p.minSeverity = severity
+	}
+}
+
+// LogTypes restricts the plugin to the specified log types. Logs of other
+// types are acknowledged without being logged. This can be used to register
+// distinct logger plugins for different purposes, eg. one for status logs and
+// another one for results.
+func LogTypes(types ...LogType) Option {
+	return func(p *Plugin) {
+		p.logTypes = make(map[LogType]bool, len(types))
+		for _, typ := range types {
+			p.logTypes[typ] = true
+		}
+	}
+}
+
+// StatusHandler sets the function used to log status logs. It is called with
+// the parsed status log instead of calling the LogFunc.
+func StatusHandler(fn StatusFunc) Option {
+	return func(p *Plugin) {
+		p.statusFn = fn
+	}
 }
 
 // NewPlugin takes a value that implements LoggerPlugin and wraps it with
 // the appropriate methods to satisfy the OsqueryPlugin interface. Use this to
 // easily create plugins implementing osquery loggers.
-func NewPlugin(name string, fn LogFunc) *Plugin {
-	return &Plugin{name: name, logFn: fn}
+func NewPlugin(name string, fn LogFunc, opts ...Option) *Plugin {
+	plugin := &Plugin{name: name, logFn: fn}
+	for _, opt := range opts {
+		opt(plugin)
+	}
+	return plugin
 }
 
 // Name returns the logger plugin name.
@@ -58,13 +103,13 @@ func (t *Plugin) Ping() osquery.ExtensionStatus {
 func (t *Plugin) Call(ctx context.Context, request osquery.ExtensionPluginRequest) osquery.ExtensionResponse {
 	var err error
 	if log, ok := request["string"]; ok {
-		err = t.logFn(ctx, LogTypeString, log)
+		err = t.log(ctx, LogTypeString, log)
 	} else if log, ok := request["snapshot"]; ok {
-		err = t.logFn(ctx, LogTypeSnapshot, log)
+		err = t.log(ctx, LogTypeSnapshot, log)
 	} else if log, ok := request["health"]; ok {
-		err = t.logFn(ctx, LogTypeHealth, log)
+		err = t.log(ctx, LogTypeHealth, log)
 	} else if log, ok := request["init"]; ok {
-		err = t.logFn(ctx, LogTypeInit, log)
+		err = t.log(ctx, LogTypeInit, log)
 	} else if _, ok := request["status"]; ok {
 		statusJSON := []byte(request["log"])
 		if len(statusJSON) == 0 {
@@ -75,6 +120,12 @@ func (t *Plugin) Call(ctx context.Context, request osquery.ExtensionPluginReques
 				},
 			}
 		}
+		if !t.accepts(LogTypeStatus) {
+			return osquery.ExtensionResponse{
+				Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+				Response: osquery.ExtensionPluginResponse{},
+			}
+		}
 
 		// Dirty hack because osquery gives us malformed JSON.
 		statusJSON = bytes.Replace(statusJSON, []byte(`"":`), []byte(``), -1)
@@ -92,7 +143,31 @@ func (t *Plugin) Call(ctx context.Context, request osquery.ExtensionPluginReques
 		}
 
 		for _, s := range parsedStatuses {
-			err = t.logFn(ctx, LogTypeStatus, string(s))
+			if t.statusFn == nil && t.minSeverity == SeverityInfo {
+				// Nothing requires parsing the status log
+				err = t.logFn(ctx, LogTypeStatus, string(s))
+				continue
+			}
+
+			var status StatusLog
+			if err := json.Unmarshal(s, &status); err != nil {
+				return osquery.ExtensionResponse{
+					Status: &osquery.ExtensionStatus{
+						Code:    1,
+						Message: "error parsing status log: " + err.Error(),
+					},
+				}
+			}
+			if status.Severity < t.minSeverity {
+				continue
+			}
+
+			if t.statusFn != nil {
+				status.Raw = string(s)
+				err = t.statusFn(ctx, status)
+			} else {
+				err = t.logFn(ctx, LogTypeStatus, string(s))
+			}
 		}
 	} else {
 		return osquery.ExtensionResponse{
@@ -118,6 +193,19 @@ func (t *Plugin) Call(ctx context.Context, request osquery.ExtensionPluginReques
 	}
 }
 
+// accepts returns true if the plugin logs the specified log type.
+func (t *Plugin) accepts(typ LogType) bool {
+	return t.logTypes == nil || t.logTypes[typ]
+}
+
+// log calls the LogFunc if the plugin accepts the log type.
+func (t *Plugin) log(ctx context.Context, typ LogType, log string) error {
+	if !t.accepts(typ) {
+		return nil
+	}
+	return t.logFn(ctx, typ, log)
+}
+
 // Shutdown is a no-op function for logger plugins.
 func (t *Plugin) Shutdown() {}
 
@@ -156,3 +244,85 @@ func (l LogType) String() string {
 	}
 	return typeString
 }
+
+// Severity is the severity of an osquery status log.
+type Severity int
+
+const (
+	// SeverityInfo for informational status logs
+	SeverityInfo Severity = iota
+	// SeverityWarning for warning status logs
+	SeverityWarning
+	// SeverityError for error status logs
+	SeverityError
+	// SeverityFatal for fatal status logs
+	SeverityFatal
+)
+
+// String implements the fmt.Stringer interface for Severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	case SeverityFatal:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+// StatusLog is a status log line emitted by osquery.
+type StatusLog struct {
+	// Severity of the status log.
+	Severity Severity
+	// Filename is the osquery source file that emitted the log.
+	Filename string
+	// Line is the line number in the source file.
+	Line int
+	// Message is the log message.
+	Message string
+	// Raw is the JSON status log as received from osquery.
+	Raw string
+}
+
+// UnmarshalJSON parses the status log JSON. osquery encodes the numeric
+// fields as strings or numbers depending on the version.
+func (s *StatusLog) UnmarshalJSON(buff []byte) error {
+	var parsed struct {
+		Severity json.RawMessage `json:"s"`
+		Filename string          `json:"f"`
+		Line     json.RawMessage `json:"i"`
+		Message  string          `json:"m"`
+	}
+	if err := json.Unmarshal(buff, &parsed); err != nil {
+		return err
+	}
+
+	severity, err := parseInt(parsed.Severity)
+	if err != nil {
+		return errors.Wrap(err, "invalid severity")
+	}
+	line, err := parseInt(parsed.Line)
+	if err != nil {
+		return errors.Wrap(err, "invalid line")
+	}
+
+	s.Severity = Severity(severity)
+	s.Filename = parsed.Filename
+	s.Line = line
+	s.Message = parsed.Message
+	return nil
+}
+
+// parseInt parses a JSON number, which can optionally be quoted.
+func parseInt(raw json.RawMessage) (int, error) {
+	str := strings.Trim(string(raw), `"`)
+	if str == "" || str == "null" {
+		return 0, nil
+	}
+	return strconv.Atoi(str)
+}
@@ -98,3 +98,64 @@ func TestLogPluginErrors(t *testing.T) {
 	assert.Equal(t, int32(1), resp.Status.Code)
 	assert.Equal(t, "error logging: foobar", resp.Status.Message)
 }
+
+func TestLoggerPluginStatusSeverity(t *testing.T) {
+	StatusOK := osquery.ExtensionStatus{Code: 0, Message: "OK"}
+	var statuses []StatusLog
+	var logged []string
+	plugin := NewPlugin(
+		"mock",
+		func(ctx context.Context, typ LogType, log string) error {
+			logged = append(logged, log)
+			return nil
+		},
+		MinSeverity(SeverityWarning),
+		StatusHandler(func(ctx context.Context, status StatusLog) error {
+			statuses = append(statuses, status)
+			return nil
+		}),
+	)
+
+	resp := plugin.Call(
+		context.Background(),
+		osquery.ExtensionPluginRequest{
+			"status": "true",
+			"log":    `{"":{"s":"0","f":"events.cpp","i":"828","m":"info"},"":{"s":1,"f":"config.cpp","i":12,"m":"warning"},"":{"s":"2","f":"scheduler.cpp","i":"74","m":"error"}}`,
+		},
+	)
+	assert.Equal(t, &StatusOK, resp.Status)
+	assert.Empty(t, logged)
+	assert.Equal(t, []StatusLog{
+		{Severity: SeverityWarning, Filename: "config.cpp", Line: 12, Message: "warning", Raw: `{"s":1,"f":"config.cpp","i":12,"m":"warning"}`},
+		{Severity: SeverityError, Filename: "scheduler.cpp", Line: 74, Message: "error", Raw: `{"s":"2","f":"scheduler.cpp","i":"74","m":"error"}`},
+	}, statuses)
+	assert.Equal(t, "warning", statuses[0].Severity.String())
+
+	// Invalid severity
+	resp = plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"status": "true", "log": `{"":{"s":"foo"}}`})
+	assert.Equal(t, int32(1), resp.Status.Code)
+}
+
+func TestLoggerPluginLogTypes(t *testing.T) {
+	StatusOK := osquery.ExtensionStatus{Code: 0, Message: "OK"}
+	var logged []LogType
+	plugin := NewPlugin(
+		"mock",
+		func(ctx context.Context, typ LogType, log string) error {
+			logged = append(logged, typ)
+			return nil
+		},
+		LogTypes(LogTypeSnapshot, LogTypeString),
+	)
+
+	for _, request := range []osquery.ExtensionPluginRequest{
+		{"string": "logged string"},
+		{"snapshot": "logged snapshot"},
+		{"health": "logged health"},
+		{"status": "true", "log": `{"":{"s":"0","f":"events.cpp","i":"828","m":"info"}}`},
+	} {
+		resp := plugin.Call(context.Background(), request)
+		assert.Equal(t, &StatusOK, resp.Status)
+	}
+	assert.Equal(t, []LogType{LogTypeString, LogTypeSnapshot}, logged)
+}
@@ -0,0 +1,57 @@
+package table
+
+import "context"
+
+// ChannelGenerateFunc is a GenerateFunc producing the rows on a channel, for
+// tables fed by a channel based pipeline. Once done, the producer closes the
+// row channel, and then either sends an error on the error channel or closes
+// it. A nil error channel means the producer cannot fail.
+type ChannelGenerateFunc func(ctx context.Context, queryContext QueryContext) (<-chan map[string]string, <-chan error)
+
+// NewChannelPlugin creates a table reading the rows produced by gen until the
+// row channel is closed, and then waiting for the error channel to be closed,
+// so that an error sent after the last row still fails the query. An error
+// received while reading the rows fails the query right away. The context
+// passed to gen is cancelled when the table stops reading, eg. on an error or
+// when the query is cancelled, so the producer must stop sending when it is
+// done.
+func NewChannelPlugin(name string, columns []ColumnDefinition, gen ChannelGenerateFunc, opts ...Option) *Plugin {
+	return NewPlugin(name, columns, func(ctx context.Context, queryContext QueryContext) ([]map[string]string, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		rowsCh, errCh := gen(ctx, queryContext)
+		rows := []map[string]string{}
+		for rowsCh != nil {
+			select {
+			case row, ok := <-rowsCh:
+				if !ok {
+					rowsCh = nil
+					break
+				}
+				rows = append(rows, row)
+			case err, ok := <-errCh:
+				if !ok {
+					errCh = nil
+				} else if err != nil {
+					return nil, err
+				}
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if errCh == nil {
+			return rows, nil
+		}
+		select {
+		case err := <-errCh:
+			if err != nil {
+				return nil, err
+			}
+			return rows, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}, opts...)
+}
@@ -0,0 +1,98 @@
+package table
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelPlugin(t *testing.T) {
+	var fail error
+	var stopped chan struct{}
+	plugin := NewChannelPlugin("numbers", []ColumnDefinition{IntegerColumn("n")},
+		func(ctx context.Context, queryContext QueryContext) (<-chan map[string]string, <-chan error) {
+			rows := make(chan map[string]string)
+			errs := make(chan error)
+			stopped = make(chan struct{})
+			go func() {
+				defer close(stopped)
+				defer close(errs)
+				for i := 0; i < 3; i++ {
+					select {
+					case rows <- map[string]string{"n": strconv.Itoa(i)}:
+					case <-ctx.Done():
+						return
+					}
+				}
+				close(rows)
+				// Sent after the last row
+				if fail != nil {
+					errs <- fail
+				}
+			}()
+			return rows, errs
+		})
+	request := osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"}
+
+	resp := plugin.Call(context.Background(), request)
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"n": "0"}, {"n": "1"}, {"n": "2"}}, resp.Response)
+
+	fail = errors.New("disk unreadable")
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "disk unreadable")
+	<-stopped
+}
+
+func TestChannelPluginCancelled(t *testing.T) {
+	stopped := make(chan struct{})
+	plugin := NewChannelPlugin("forever", []ColumnDefinition{IntegerColumn("n")},
+		func(ctx context.Context, queryContext QueryContext) (<-chan map[string]string, <-chan error) {
+			rows := make(chan map[string]string)
+			go func() {
+				defer close(stopped)
+				for {
+					select {
+					case rows <- map[string]string{"n": "1"}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return rows, nil
+		})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	resp := plugin.Call(ctx, osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"})
+	assert.NotEqual(t, int32(0), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, context.DeadlineExceeded.Error())
+
+	// The producer is stopped
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "producer not stopped")
+	}
+}
+
+func TestChannelPluginEarlyError(t *testing.T) {
+	plugin := NewChannelPlugin("failing", []ColumnDefinition{IntegerColumn("n")},
+		func(ctx context.Context, queryContext QueryContext) (<-chan map[string]string, <-chan error) {
+			errs := make(chan error, 1)
+			errs <- errors.New("access denied")
+			// The row channel is never closed
+			return make(chan map[string]string), errs
+		})
+
+	resp := plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"})
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "access denied")
+}
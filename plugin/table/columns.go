@@ -0,0 +1,87 @@
+package table
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ColumnsFromStruct returns the column definitions for the fields of the
+// struct (or pointer to struct) v, so that a table can be prototyped from a Go
+// type. The column name is taken from the `osquery` field tag, or else is the
+// lowercased field name. Fields tagged `osquery:"-"` and unexported fields are
+// skipped. The column type is inferred from the field kind: INTEGER for int,
+// bool and the smaller integer kinds, BIGINT for int64 and uint64, DOUBLE for
+// floats, TEXT for strings and BLOB for []byte. Other kinds return an error.
+func ColumnsFromStruct(v interface{}) ([]ColumnDefinition, error) {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.Errorf("expected a struct, got %v", t)
+	}
+
+	var columns []ColumnDefinition
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Tag.Get("osquery")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		columnType, ok := columnTypeOf(field.Type)
+		if !ok {
+			return nil, errors.Errorf("unsupported type %v of field %s", field.Type, field.Name)
+		}
+		columns = append(columns, ColumnDefinition{Name: name, Type: columnType, Op: DEFAULT})
+	}
+	return columns, nil
+}
+
+// MergeColumns concatenates the column definition sets, so that a table can be
+// composed from reusable column groups. A column name appearing more than once
+// returns an error, naming the conflicting types if they differ.
+func MergeColumns(sets ...[]ColumnDefinition) ([]ColumnDefinition, error) {
+	var columns []ColumnDefinition
+	seen := map[string]ColumnType{}
+	for _, set := range sets {
+		for _, column := range set {
+			if columnType, ok := seen[column.Name]; ok {
+				if columnType != column.Type {
+					return nil, errors.Errorf("column %s defined as both %s and %s", column.Name, columnType, column.Type)
+				}
+				return nil, errors.Errorf("duplicate column %s", column.Name)
+			}
+			seen[column.Name] = column.Type
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+func columnTypeOf(t reflect.Type) (ColumnType, bool) {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return ColumnTypeInteger, true
+	case reflect.Int64, reflect.Uint64:
+		return ColumnTypeBigInt, true
+	case reflect.Float32, reflect.Float64:
+		return ColumnTypeDouble, true
+	case reflect.String:
+		return ColumnTypeText, true
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return ColumnTypeBlob, true
+		}
+	}
+	return "", false
+}
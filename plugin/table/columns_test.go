@@ -0,0 +1,57 @@
+package table
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnsFromStruct(t *testing.T) {
+	type process struct {
+		PID      int     `osquery:"pid"`
+		Name     string  `osquery:"name"`
+		Start    int64   `osquery:"start_time"`
+		CPU      float64 `osquery:"cpu"`
+		Elevated bool
+		Cmdline  []byte `osquery:"cmdline"`
+		Ignored  string `osquery:"-"`
+		private  string
+	}
+
+	columns, err := ColumnsFromStruct(&process{})
+	require.NoError(t, err)
+	assert.Equal(t, []ColumnDefinition{
+		IntegerColumn("pid"),
+		TextColumn("name"),
+		BigIntColumn("start_time"),
+		DoubleColumn("cpu"),
+		IntegerColumn("elevated"),
+		{Name: "cmdline", Type: ColumnTypeBlob, Op: DEFAULT},
+	}, columns)
+
+	_, err = ColumnsFromStruct(struct {
+		Created time.Time `osquery:"created"`
+	}{})
+	assert.EqualError(t, err, "unsupported type time.Time of field Created")
+
+	_, err = ColumnsFromStruct("process")
+	assert.Error(t, err)
+	_, err = ColumnsFromStruct(nil)
+	assert.Error(t, err)
+}
+
+func TestMergeColumns(t *testing.T) {
+	metadata := []ColumnDefinition{TextColumn("host"), BigIntColumn("time")}
+
+	columns, err := MergeColumns(metadata, []ColumnDefinition{IntegerColumn("pid")})
+	require.NoError(t, err)
+	assert.Equal(t, []ColumnDefinition{TextColumn("host"), BigIntColumn("time"), IntegerColumn("pid")}, columns)
+
+	_, err = MergeColumns(metadata, []ColumnDefinition{TextColumn("host")})
+	assert.EqualError(t, err, "duplicate column host")
+
+	_, err = MergeColumns(metadata, []ColumnDefinition{IntegerColumn("time")})
+	assert.EqualError(t, err, "column time defined as both BIGINT and INTEGER")
+}
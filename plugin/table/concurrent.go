@@ -0,0 +1,73 @@
+package table
+
+import (
+	"context"
+	"sync"
+)
+
+// GenerateConcurrently runs the tasks with at most maxConcurrency of them
+// running at the same time, and returns the rows of all the tasks in task
+// order. If a task fails, the context passed to the other tasks is cancelled
+// and the first error is returned. A maxConcurrency <= 0 runs all the tasks
+// at once. Tables that can partition their work (eg. per account) can use
+// this from their generate function.
+func GenerateConcurrently(ctx context.Context, tasks []func(ctx context.Context) ([]map[string]string, error), maxConcurrency int) ([]map[string]string, error) {
+	if maxConcurrency <= 0 || maxConcurrency > len(tasks) {
+		maxConcurrency = len(tasks)
+	}
+
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	results := make([][]map[string]string, len(tasks))
+	sem := make(chan struct{}, maxConcurrency)
+
+dispatch:
+	for i, task := range tasks {
+		if taskCtx.Err() != nil {
+			break
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-taskCtx.Done():
+			break dispatch
+		}
+
+		wg.Add(1)
+		go func(i int, task func(ctx context.Context) ([]map[string]string, error)) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			rows, err := task(taskCtx)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = rows
+		}(i, task)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for _, rows := range results {
+		count += len(rows)
+	}
+	all := make([]map[string]string, 0, count)
+	for _, rows := range results {
+		all = append(all, rows...)
+	}
+	return all, nil
+}
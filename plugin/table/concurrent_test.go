@@ -0,0 +1,86 @@
+package table
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateConcurrently(t *testing.T) {
+	var running, maxRunning int32
+	var tasks []func(ctx context.Context) ([]map[string]string, error)
+	for i := 0; i < 10; i++ {
+		i := i
+		tasks = append(tasks, func(ctx context.Context) ([]map[string]string, error) {
+			current := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return []map[string]string{{"id": strconv.Itoa(i)}, {"id": strconv.Itoa(i) + "b"}}, nil
+		})
+	}
+
+	rows, err := GenerateConcurrently(context.Background(), tasks, 3)
+	require.NoError(t, err)
+	require.Len(t, rows, 20)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, strconv.Itoa(i), rows[2*i]["id"])
+		assert.Equal(t, strconv.Itoa(i)+"b", rows[2*i+1]["id"])
+	}
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(3))
+
+	rows, err = GenerateConcurrently(context.Background(), nil, 3)
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+}
+
+func TestGenerateConcurrentlyError(t *testing.T) {
+	var cancelled int32
+	tasks := []func(ctx context.Context) ([]map[string]string, error){
+		func(ctx context.Context) ([]map[string]string, error) {
+			return nil, errors.New("boom")
+		},
+	}
+	for i := 0; i < 3; i++ {
+		tasks = append(tasks, func(ctx context.Context) ([]map[string]string, error) {
+			select {
+			case <-ctx.Done():
+				atomic.AddInt32(&cancelled, 1)
+				return nil, ctx.Err()
+			case <-time.After(5 * time.Second):
+				return nil, nil
+			}
+		})
+	}
+
+	_, err := GenerateConcurrently(context.Background(), tasks, 0)
+	require.Error(t, err)
+	assert.Equal(t, "boom", err.Error())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&cancelled))
+}
+
+func TestGenerateConcurrentlyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	_, err := GenerateConcurrently(ctx, []func(ctx context.Context) ([]map[string]string, error){
+		func(ctx context.Context) ([]map[string]string, error) {
+			called = true
+			return nil, nil
+		},
+	}, 1)
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, called)
+}
@@ -0,0 +1,56 @@
+package table
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// Dedup returns the rows without exact duplicates, keeping the first
+// occurrence of each row in order. Rows are compared by a hash of their
+// sorted columns, so the cost is linear in the total size of the rows plus
+// sorting the columns of each row, and the memory used is one hash per
+// distinct row. The rows are not copied.
+func Dedup(rows []map[string]string) []map[string]string {
+	seen := make(map[uint64][]map[string]string, len(rows))
+	result := make([]map[string]string, 0, len(rows))
+	var keys []string
+
+outer:
+	for _, row := range rows {
+		keys = keys[:0]
+		for key := range row {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		h := fnv.New64a()
+		for _, key := range keys {
+			h.Write([]byte(key))
+			h.Write([]byte{0})
+			h.Write([]byte(row[key]))
+			h.Write([]byte{0})
+		}
+		sum := h.Sum64()
+
+		for _, other := range seen[sum] {
+			if equalRows(row, other) {
+				continue outer
+			}
+		}
+		seen[sum] = append(seen[sum], row)
+		result = append(result, row)
+	}
+	return result
+}
+
+func equalRows(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
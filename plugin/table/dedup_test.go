@@ -0,0 +1,29 @@
+package table
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedup(t *testing.T) {
+	rows := []map[string]string{
+		{"name": "init", "pid": "1"},
+		{"name": "bash", "pid": "42"},
+		{"pid": "1", "name": "init"},
+		{"name": "init"},
+		{"name": "init", "pid": "1", "path": ""},
+		{"name": "bash", "pid": "42"},
+		// The separators keep these apart from the first row
+		{"name": "init\x00pid", "pid": "1"},
+	}
+	assert.Equal(t, []map[string]string{
+		{"name": "init", "pid": "1"},
+		{"name": "bash", "pid": "42"},
+		{"name": "init"},
+		{"name": "init", "pid": "1", "path": ""},
+		{"name": "init\x00pid", "pid": "1"},
+	}, Dedup(rows))
+
+	assert.Empty(t, Dedup(nil))
+}
@@ -0,0 +1,58 @@
+package table
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ComputeFunc computes the value of a lazy column for a generated row.
+type ComputeFunc func(ctx context.Context, row map[string]string) (string, error)
+
+type lazyColumn struct {
+	name    string
+	compute ComputeFunc
+}
+
+// LazyColumn computes the column only if the query uses it (see
+// QueryContext.WantsColumn), calling compute for each generated row, so that
+// the generate function can leave out expensive columns (eg. hashes or
+// lookups). The column must be one of the columns of the table. The rows are
+// copied before the computed values are set, so cached rows can be returned
+// by the generate function. A compute error fails the query. Lazy columns are
+// not supported by columnar tables.
+func LazyColumn(name string, compute ComputeFunc) Option {
+	return func(t *Plugin) {
+		t.lazyColumns = append(t.lazyColumns, lazyColumn{name, compute})
+	}
+}
+
+// computeLazyColumns returns the rows with the lazy columns used by the query.
+func (t *Plugin) computeLazyColumns(ctx context.Context, queryContext QueryContext, rows []map[string]string) ([]map[string]string, error) {
+	var wanted []lazyColumn
+	for _, column := range t.lazyColumns {
+		if queryContext.WantsColumn(column.name) {
+			wanted = append(wanted, column)
+		}
+	}
+	if len(wanted) == 0 {
+		return rows, nil
+	}
+
+	result := make([]map[string]string, len(rows))
+	for i, row := range rows {
+		computed := make(map[string]string, len(row)+len(wanted))
+		for key, value := range row {
+			computed[key] = value
+		}
+		for _, column := range wanted {
+			value, err := column.compute(ctx, row)
+			if err != nil {
+				return nil, errors.Wrapf(err, "computing column %s", column.name)
+			}
+			computed[column.name] = value
+		}
+		result[i] = computed
+	}
+	return result, nil
+}
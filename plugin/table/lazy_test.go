@@ -0,0 +1,57 @@
+package table
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazyColumn(t *testing.T) {
+	rows := []map[string]string{{"path": "/a"}, {"path": "/b"}}
+	computed := 0
+	plugin := NewPlugin("files", []ColumnDefinition{TextColumn("path"), TextColumn("sha256")},
+		func(ctx context.Context, queryContext QueryContext) ([]map[string]string, error) {
+			return rows, nil
+		},
+		LazyColumn("sha256", func(ctx context.Context, row map[string]string) (string, error) {
+			computed++
+			if row["path"] == "/fail" {
+				return "", errors.New("permission denied")
+			}
+			return "hash of " + row["path"], nil
+		}))
+
+	// Not computed when the query does not use the column
+	resp := plugin.Call(context.Background(), osquery.ExtensionPluginRequest{
+		"action":  "generate",
+		"context": `{"colsUsed":["path"]}`,
+	})
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"path": "/a"}, {"path": "/b"}}, resp.Response)
+	assert.Equal(t, 0, computed)
+
+	resp = plugin.Call(context.Background(), osquery.ExtensionPluginRequest{
+		"action":  "generate",
+		"context": `{"colsUsed":["path","sha256"]}`,
+	})
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"path": "/a", "sha256": "hash of /a"},
+		{"path": "/b", "sha256": "hash of /b"},
+	}, resp.Response)
+	assert.Equal(t, 2, computed)
+	// The generated rows are not modified
+	assert.Equal(t, map[string]string{"path": "/a"}, rows[0])
+
+	// Computed when osquery does not supply the used columns
+	resp = plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"})
+	assert.Equal(t, "hash of /b", resp.Response[1]["sha256"])
+
+	rows = []map[string]string{{"path": "/fail"}}
+	resp = plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"})
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "computing column sha256: permission denied")
+}
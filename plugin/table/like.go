@@ -0,0 +1,21 @@
+package table
+
+import "strings"
+
+// LikeToPrefix returns the literal prefix of a LIKE pattern, before its first
+// % or _ wildcard, so that a path table can scan a directory instead of
+// enumerating everything, eg. "/var/log/" for LIKE '/var/log/%'. exact is true
+// if the pattern has no wildcard, ie. it only matches the prefix. A backslash
+// is an ordinary character: SQLite LIKE has no escape character unless the
+// query has an ESCAPE clause, which osquery does not pass to the extension.
+//
+// osquery filters the returned rows on the complete pattern, so the scan can
+// return more rows than matched. Note that SQLite matches LIKE patterns
+// case-insensitively for ASCII letters, so a case-sensitive prefix scan misses
+// the paths differing from the pattern only in case.
+func LikeToPrefix(pattern string) (prefix string, exact bool) {
+	if i := strings.IndexAny(pattern, "%_"); i >= 0 {
+		return pattern[:i], false
+	}
+	return pattern, true
+}
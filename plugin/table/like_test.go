@@ -0,0 +1,30 @@
+package table
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLikeToPrefix(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		prefix  string
+		exact   bool
+	}{
+		{"/var/log/%", "/var/log/", false},
+		{"/var/log/syslog", "/var/log/syslog", true},
+		{"/var/log/sys_og", "/var/log/sys", false},
+		{"%.log", "", false},
+		{"", "", true},
+		{`/a\%`, `/a\`, false},
+		{`/tmp/a\_b`, `/tmp/a\`, false},
+		{`C:\Windows\%`, `C:\Windows\`, false},
+		{`C:\Windows`, `C:\Windows`, true},
+		{`trailing\`, `trailing\`, true},
+	} {
+		prefix, exact := LikeToPrefix(test.pattern)
+		assert.Equal(t, test.prefix, prefix, test.pattern)
+		assert.Equal(t, test.exact, exact, test.pattern)
+	}
+}
@@ -0,0 +1,203 @@
+package table
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MemoryTable is a mutable table storing its rows in memory. It is safe for
+// concurrent use, and can be used as a scratch table or filled from the code
+// of the extension (eg. from its configuration) with Insert.
+type MemoryTable struct {
+	*Plugin
+
+	mutex      sync.RWMutex
+	columns    []ColumnDefinition
+	primaryKey string
+	rows       map[int64]map[string]string
+	keys       map[string]int64 // Row ID of each primary key value
+	lastID     int64
+	size       *SizeTracker
+}
+
+// NewMemoryTable creates an in-memory mutable table. If primaryKey is not
+// empty, it names the column whose values must be unique: inserts and updates
+// that would duplicate a value are rejected with a RowConstraint error. The
+// generated rows carry their row ID in the "rowid" column, so that osquery
+// updates and deletes target the right rows. The options are applied after
+// the ones of the table (AutoID and UseNumber), which they should not change.
+func NewMemoryTable(name string, columns []ColumnDefinition, primaryKey string, opts ...Option) *MemoryTable {
+	m := &MemoryTable{
+		columns:    columns,
+		primaryKey: primaryKey,
+		rows:       map[int64]map[string]string{},
+		keys:       map[string]int64{},
+		size:       NewSizeTracker(0),
+	}
+	opts = append([]Option{AutoID(m.nextID), UseNumber()}, opts...)
+	m.Plugin = NewMutablePlugin(name, columns, m.generate, m.insert, m.update, m.delete, opts...)
+	return m
+}
+
+// nextID is the AutoIDFunc of the table.
+func (m *MemoryTable) nextID() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lastID++
+	return m.lastID
+}
+
+// Insert adds the row to the table, and returns its row ID.
+func (m *MemoryTable) Insert(row map[string]string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lastID++
+	if err := m.store(m.lastID, row); err != nil {
+		return 0, err
+	}
+	return m.lastID, nil
+}
+
+// Rows returns a copy of the rows of the table, ordered by row ID.
+func (m *MemoryTable) Rows() []map[string]string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	ids := make([]int64, 0, len(m.rows))
+	for id := range m.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	rows := make([]map[string]string, 0, len(ids))
+	for _, id := range ids {
+		row := make(map[string]string, len(m.rows[id])+1)
+		for k, v := range m.rows[id] {
+			row[k] = v
+		}
+		row["rowid"] = strconv.FormatInt(id, 10)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// SetSizeLimit caps the approximate size of the rows of the table (see
+// RowSize): inserts and updates growing the table beyond limit bytes fail. A
+// limit <= 0, the default, does not cap the size.
+func (m *MemoryTable) SetSizeLimit(limit int64) {
+	m.size.SetLimit(limit)
+}
+
+// Size returns the approximate size in bytes of the rows of the table (see
+// RowSize).
+func (m *MemoryTable) Size() int64 {
+	return m.size.Size()
+}
+
+// SizeCollector returns a Prometheus gauge of the size of the table, see
+// SizeTracker.Collector.
+func (m *MemoryTable) SizeCollector() prometheus.Collector {
+	return m.size.Collector(m.Name())
+}
+
+// store sets the row with the specified ID, enforcing the primary key and the
+// size limit. The caller must hold the mutex.
+func (m *MemoryTable) store(rowID int64, row map[string]string) error {
+	old, exists := m.rows[rowID]
+	key := row[m.primaryKey]
+	if m.primaryKey != "" {
+		if id, ok := m.keys[key]; ok && id != rowID {
+			return &RowError{Status: RowConstraint, Message: "duplicate " + m.primaryKey + ": " + key}
+		}
+	}
+
+	delta := RowSize(row)
+	if exists {
+		delta -= RowSize(old)
+	}
+	if err := m.size.Add(delta); err != nil {
+		return err
+	}
+
+	if m.primaryKey != "" {
+		if exists {
+			delete(m.keys, old[m.primaryKey])
+		}
+		m.keys[key] = rowID
+	}
+	m.rows[rowID] = row
+	return nil
+}
+
+// formatRow maps the values of a row sent by osquery to the columns.
+func (m *MemoryTable) formatRow(values []interface{}) (map[string]string, error) {
+	if len(values) != len(m.columns) {
+		return nil, errors.Errorf("row has %d values, expected %d", len(values), len(m.columns))
+	}
+	row := make(map[string]string, len(values))
+	for i, column := range m.columns {
+		value, err := FormatValue(values[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "column %s", column.Name)
+		}
+		row[column.Name] = value
+	}
+	return row, nil
+}
+
+func (m *MemoryTable) generate(ctx context.Context, queryContext QueryContext) ([]map[string]string, error) {
+	return m.Rows(), nil
+}
+
+func (m *MemoryTable) insert(ctx context.Context, autoRowID bool, values []interface{}) ([]map[string]string, error) {
+	row, err := m.formatRow(values)
+	if err != nil {
+		return nil, err
+	}
+
+	rowID, ok := AutoRowID(ctx)
+	if !ok {
+		rowID = m.nextID()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := m.store(rowID, row); err != nil {
+		return nil, err
+	}
+	return InsertedRow(rowID, row), nil
+}
+
+func (m *MemoryTable) update(ctx context.Context, rowID int64, values []interface{}) error {
+	row, err := m.formatRow(values)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.rows[rowID]; !ok {
+		return errors.Errorf("no row with id %d", rowID)
+	}
+	return m.store(rowID, row)
+}
+
+func (m *MemoryTable) delete(ctx context.Context, rowID int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	row, ok := m.rows[rowID]
+	if !ok {
+		return errors.Errorf("no row with id %d", rowID)
+	}
+	if m.primaryKey != "" {
+		delete(m.keys, row[m.primaryKey])
+	}
+	delete(m.rows, rowID)
+	m.size.Add(-RowSize(row))
+	return nil
+}
@@ -0,0 +1,114 @@
+package table
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryTable(t *testing.T) {
+	memory := NewMemoryTable("users", []ColumnDefinition{TextColumn("name"), IntegerColumn("uid")}, "name")
+	call := func(request osquery.ExtensionPluginRequest) osquery.ExtensionResponse {
+		resp := memory.Call(context.Background(), request)
+		require.Equal(t, int32(0), resp.Status.Code, resp.Status.Message)
+		return resp
+	}
+
+	id, err := memory.Insert(map[string]string{"name": "root", "uid": "0"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+
+	resp := call(osquery.ExtensionPluginRequest{"action": "insert", "auto_rowid": "true", "json_value_array": `["alice", 1000]`})
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"id": "2", "status": "success"}, {"name": "alice", "uid": "1000"}}, resp.Response)
+
+	// Duplicate primary keys are rejected
+	resp = call(osquery.ExtensionPluginRequest{"action": "insert", "auto_rowid": "true", "json_value_array": `["root", 1]`})
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"status": "constraint", "message": "duplicate name: root"}}, resp.Response)
+	resp = call(osquery.ExtensionPluginRequest{"action": "update", "id": "2", "json_value_array": `["root", 1000]`})
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"status": "constraint", "message": "duplicate name: root"}}, resp.Response)
+
+	// The primary key of a row can change
+	call(osquery.ExtensionPluginRequest{"action": "update", "id": "2", "json_value_array": `["bob", 1001]`})
+	_, err = memory.Insert(map[string]string{"name": "alice", "uid": "1002"})
+	require.NoError(t, err)
+
+	call(osquery.ExtensionPluginRequest{"action": "delete", "id": "1"})
+	resp = call(osquery.ExtensionPluginRequest{"action": "generate"})
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"rowid": "2", "name": "bob", "uid": "1001"},
+		{"rowid": "4", "name": "alice", "uid": "1002"},
+	}, resp.Response)
+
+	resp = memory.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "delete", "id": "1"})
+	assert.Equal(t, int32(1), resp.Status.Code)
+	resp = memory.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "insert", "auto_rowid": "true", "json_value_array": `["carol"]`})
+	assert.Equal(t, int32(1), resp.Status.Code)
+}
+
+func TestMemoryTableConcurrency(t *testing.T) {
+	memory := NewMemoryTable("scratch", []ColumnDefinition{TextColumn("key"), TextColumn("value")}, "key")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				key := strconv.Itoa(i*100 + j)
+				resp := memory.Call(context.Background(), osquery.ExtensionPluginRequest{
+					"action":           "insert",
+					"auto_rowid":       "true",
+					"json_value_array": `["` + key + `", "v"]`,
+				})
+				assert.Equal(t, "success", resp.Response[0]["status"])
+				memory.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate"})
+				if j%2 == 0 {
+					id := resp.Response[0]["id"]
+					resp = memory.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "delete", "id": id})
+					assert.Equal(t, int32(0), resp.Status.Code)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	rows := memory.Rows()
+	assert.Len(t, rows, 8*25)
+	seen := map[string]bool{}
+	for _, row := range rows {
+		assert.False(t, seen[row["rowid"]])
+		seen[row["rowid"]] = true
+	}
+}
+
+func TestMemoryTableSizeLimit(t *testing.T) {
+	memory := NewMemoryTable("users", []ColumnDefinition{TextColumn("name"), IntegerColumn("uid")}, "name")
+	memory.SetSizeLimit(300)
+
+	_, err := memory.Insert(map[string]string{"name": "root", "uid": "0"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(140), memory.Size())
+	resp := memory.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "insert", "auto_rowid": "true", "json_value_array": `["alice", 1000]`})
+	assert.Equal(t, "success", resp.Response[0]["status"])
+	assert.Equal(t, int64(284), memory.Size())
+
+	resp = memory.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "insert", "auto_rowid": "true", "json_value_array": `["bob", 1]`})
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"status": "failure", "message": "size limit of 300 bytes exceeded"}}, resp.Response)
+	resp = memory.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "update", "id": "2", "json_value_array": `["alice-with-a-longer-name", 1000]`})
+	assert.Equal(t, "failure", resp.Response[0]["status"])
+	assert.Equal(t, int64(284), memory.Size())
+	assert.Len(t, memory.Rows(), 2)
+
+	// Deleting rows makes room
+	resp = memory.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "delete", "id": "1"})
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, int64(144), memory.Size())
+	_, err = memory.Insert(map[string]string{"name": "bob", "uid": "1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(283), memory.Size())
+}
@@ -0,0 +1,60 @@
+package table
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ErrTooManyPages is returned (wrapped) by GeneratePages when the source has
+// more than maxPages pages, rather than returning a truncated table that could
+// not be told apart from a complete one.
+var ErrTooManyPages = errors.New("too many pages")
+
+// PageGenerateFunc returns one page of the rows generated by a table backed by
+// a paginated source. cursor is empty for the first page and otherwise holds
+// the nextCursor returned for the previous page. An empty nextCursor marks the
+// last page.
+type PageGenerateFunc func(ctx context.Context, queryContext QueryContext, cursor string) (rows []map[string]string, nextCursor string, err error)
+
+// NewPaginatedPlugin is helper method to create plugin structure whose rows
+// are fetched page by page. See GeneratePages for the handling of maxPages.
+func NewPaginatedPlugin(name string, columns []ColumnDefinition, gen PageGenerateFunc, maxPages int, opts ...Option) *Plugin {
+	return NewPlugin(name, columns, GeneratePages(gen, maxPages), opts...)
+}
+
+// GeneratePages returns a GenerateFunc calling gen repeatedly with the cursor
+// of the previous page until it returns no next cursor, and returning the rows
+// of all the pages. At most maxPages pages are fetched: if the last allowed
+// page still has a next cursor, the query fails with ErrTooManyPages. A
+// maxPages <= 0 fetches all the pages. The context is checked for cancellation
+// before fetching each page.
+func GeneratePages(gen PageGenerateFunc, maxPages int) GenerateFunc {
+	return func(ctx context.Context, queryContext QueryContext) ([]map[string]string, error) {
+		var all []map[string]string
+		cursor := ""
+		for page := 0; ; page++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			rows, next, err := gen(ctx, queryContext, cursor)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, rows...)
+
+			if next == "" {
+				break
+			}
+			if maxPages > 0 && page+1 == maxPages {
+				return nil, errors.Wrapf(ErrTooManyPages, "more than %d pages", maxPages)
+			}
+			cursor = next
+		}
+		if all == nil {
+			all = []map[string]string{}
+		}
+		return all, nil
+	}
+}
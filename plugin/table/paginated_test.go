@@ -0,0 +1,90 @@
+package table
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pages returns a PageGenerateFunc serving count pages of two rows each,
+// recording the cursors it was called with.
+func pages(count int, cursors *[]string) PageGenerateFunc {
+	return func(ctx context.Context, queryContext QueryContext, cursor string) ([]map[string]string, string, error) {
+		*cursors = append(*cursors, cursor)
+		page := 0
+		if cursor != "" {
+			page, _ = strconv.Atoi(cursor)
+		}
+		rows := []map[string]string{{"id": strconv.Itoa(2 * page)}, {"id": strconv.Itoa(2*page + 1)}}
+		if page+1 == count {
+			return rows, "", nil
+		}
+		return rows, strconv.Itoa(page + 1), nil
+	}
+}
+
+func TestGeneratePages(t *testing.T) {
+	var cursors []string
+	rows, err := GeneratePages(pages(3, &cursors), 0)(context.Background(), QueryContext{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "1", "2"}, cursors)
+	require.Len(t, rows, 6)
+	for i, row := range rows {
+		assert.Equal(t, strconv.Itoa(i), row["id"])
+	}
+}
+
+func TestGeneratePagesMaxPages(t *testing.T) {
+	var cursors []string
+	_, err := GeneratePages(pages(10, &cursors), 2)(context.Background(), QueryContext{})
+	assert.True(t, errors.Is(err, ErrTooManyPages))
+	assert.EqualError(t, err, "more than 2 pages: too many pages")
+	assert.Equal(t, []string{"", "1"}, cursors)
+
+	// The cap is not hit when the last allowed page is the last page
+	cursors = nil
+	rows, err := GeneratePages(pages(2, &cursors), 2)(context.Background(), QueryContext{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "1"}, cursors)
+	assert.Len(t, rows, 4)
+
+	// The table fails instead of returning a partial result
+	plugin := NewPaginatedPlugin("paged", []ColumnDefinition{TextColumn("id")}, pages(10, &cursors), 2)
+	resp := plugin.Call(context.Background(), map[string]string{"action": "generate", "context": "{}"})
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "more than 2 pages")
+	assert.Empty(t, resp.Response)
+}
+
+func TestGeneratePagesErrors(t *testing.T) {
+	gen := func(ctx context.Context, queryContext QueryContext, cursor string) ([]map[string]string, string, error) {
+		if cursor == "" {
+			return []map[string]string{{"id": "0"}}, "next", nil
+		}
+		return nil, "", errors.New("backend unavailable")
+	}
+	_, err := GeneratePages(gen, 0)(context.Background(), QueryContext{})
+	assert.EqualError(t, err, "backend unavailable")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var cursors []string
+	cancelling := func(ctx context.Context, queryContext QueryContext, cursor string) ([]map[string]string, string, error) {
+		cancel()
+		return pages(10, &cursors)(ctx, queryContext, cursor)
+	}
+	_, err = GeneratePages(cancelling, 0)(ctx, QueryContext{})
+	assert.Equal(t, context.Canceled, err)
+	assert.Len(t, cursors, 1)
+}
+
+func TestPaginatedPlugin(t *testing.T) {
+	var cursors []string
+	plugin := NewPaginatedPlugin("paged", []ColumnDefinition{TextColumn("id")}, pages(2, &cursors), 0)
+	resp := plugin.Call(context.Background(), map[string]string{"action": "generate", "context": "{}"})
+	require.Equal(t, int32(0), resp.Status.Code)
+	assert.Len(t, resp.Response, 4)
+}
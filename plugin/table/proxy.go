@@ -0,0 +1,133 @@
+package table
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Uptycs/basequery-go/internal/jsonutil"
+	"github.com/pkg/errors"
+)
+
+// defaultProxyTimeout bounds the requests of proxy plugins created without a
+// client.
+const defaultProxyTimeout = 30 * time.Second
+
+// maxProxyErrorBody is how much of the body of a failed response is kept in
+// the error message.
+const maxProxyErrorBody = 512
+
+// proxyRequest is the body posted by HTTP proxy plugins.
+type proxyRequest struct {
+	Table       string            `json:"table"`
+	Constraints []proxyConstraint `json:"constraints"`
+	Limit       *int              `json:"limit,omitempty"`
+	Offset      int               `json:"offset,omitempty"`
+	Columns     []string          `json:"columns,omitempty"`
+}
+
+type proxyConstraint struct {
+	Column     string   `json:"column"`
+	Operator   Operator `json:"op"`
+	Expression string   `json:"expr"`
+}
+
+// NewHTTPProxyPlugin creates a table whose rows are generated by an HTTP
+// backend, so that services written in other languages can implement tables.
+// For every query, a JSON object describing the query is posted to endpoint:
+//
+//	{
+//	  "table": "users",
+//	  "constraints": [{"column": "uid", "op": 2, "expr": "1000"}],
+//	  "limit": 10,
+//	  "columns": ["uid", "name"]
+//	}
+//
+// The operators are the osquery operators (see Operator). "limit", "offset"
+// and "columns" are only present if osquery supplied them. The backend must
+// reply with a 2xx status and a JSON array of rows, each an object mapping
+// column names to strings, numbers, booleans or nulls. Other statuses fail
+// the query with an HTTPError, mapped as described by StatusFromError. The
+// client sets the timeout of the requests; a client with a 30s timeout is
+// used if it is nil.
+func NewHTTPProxyPlugin(name string, columns []ColumnDefinition, endpoint string, client *http.Client, opts ...Option) *Plugin {
+	if client == nil {
+		client = &http.Client{Timeout: defaultProxyTimeout}
+	}
+	return NewPlugin(name, columns, func(ctx context.Context, queryContext QueryContext) ([]map[string]string, error) {
+		return proxyGenerate(ctx, client, endpoint, name, queryContext)
+	}, opts...)
+}
+
+func proxyGenerate(ctx context.Context, client *http.Client, endpoint string, name string, queryContext QueryContext) ([]map[string]string, error) {
+	body, err := jsonutil.Marshal(newProxyRequest(name, queryContext))
+	if err != nil {
+		return nil, errors.Wrap(err, "marshaling proxy request")
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "creating proxy request")
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "posting proxy request")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxProxyErrorBody))
+		return nil, &HTTPError{StatusCode: response.StatusCode, Message: string(bytes.TrimSpace(message))}
+	}
+
+	var parsed []map[string]interface{}
+	decoder := json.NewDecoder(response.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling proxy response")
+	}
+
+	rows := make([]map[string]string, 0, len(parsed))
+	for i, values := range parsed {
+		row := make(map[string]string, len(values))
+		for column, value := range values {
+			formatted, err := FormatValue(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "row %d column %s", i, column)
+			}
+			row[column] = formatted
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func newProxyRequest(name string, queryContext QueryContext) proxyRequest {
+	request := proxyRequest{
+		Table:       name,
+		Constraints: []proxyConstraint{},
+		Limit:       queryContext.Limit,
+		Offset:      queryContext.Offset,
+		Columns:     queryContext.Columns,
+	}
+	for column, list := range queryContext.Constraints {
+		for _, constraint := range list.Constraints {
+			request.Constraints = append(request.Constraints, proxyConstraint{
+				Column:     column,
+				Operator:   constraint.Operator,
+				Expression: constraint.Expression,
+			})
+		}
+	}
+	// Sorted by column, since the constraints come from a map
+	sort.SliceStable(request.Constraints, func(i, j int) bool {
+		return request.Constraints[i].Column < request.Constraints[j].Column
+	})
+	return request
+}
@@ -0,0 +1,77 @@
+package table
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPProxyPlugin(t *testing.T) {
+	var received map[string]interface{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Write([]byte(`[{"name": "root", "uid": 0, "admin": true, "shell": null}, {"name": "alice", "uid": 9223372036854775807, "admin": false}]`))
+	}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handler(w, r) }))
+	defer backend.Close()
+
+	plugin := NewHTTPProxyPlugin("users", []ColumnDefinition{TextColumn("name"), BigIntColumn("uid")}, backend.URL, nil)
+	resp := plugin.Call(context.Background(), osquery.ExtensionPluginRequest{
+		"action":  "generate",
+		"context": `{"constraints":[{"name":"uid","affinity":"BIGINT","list":[{"op":32,"expr":"0"},{"op":16,"expr":"1000"}]},{"name":"name","list":[{"op":65,"expr":"a%"}]}],"limit":10,"colsUsed":["name","uid"]}`,
+	})
+	require.Equal(t, int32(0), resp.Status.Code, resp.Status.Message)
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"name": "root", "uid": "0", "admin": "1", "shell": ""},
+		{"name": "alice", "uid": "9223372036854775807", "admin": "0"},
+	}, resp.Response)
+
+	expected := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"table": "users",
+		"constraints": [
+			{"column": "name", "op": 65, "expr": "a%"},
+			{"column": "uid", "op": 32, "expr": "0"},
+			{"column": "uid", "op": 16, "expr": "1000"}
+		],
+		"limit": 10,
+		"columns": ["name", "uid"]
+	}`), &expected))
+	assert.Equal(t, expected, received)
+
+	// Backend errors are mapped to statuses
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+	}
+	resp = plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate"})
+	assert.Equal(t, StatusUnavailable, resp.Status.Code)
+	assert.Equal(t, "error generating table: 503 Service Unavailable: try later", resp.Status.Message)
+
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"rows": []}`))
+	}
+	resp = plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate"})
+	assert.Equal(t, StatusFailure, resp.Status.Code)
+
+	// Timeouts
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}
+	plugin = NewHTTPProxyPlugin("users", []ColumnDefinition{TextColumn("name")}, backend.URL, &http.Client{})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	resp = plugin.Call(ctx, osquery.ExtensionPluginRequest{"action": "generate"})
+	assert.Equal(t, StatusTimeout, resp.Status.Code)
+
+	plugin = NewHTTPProxyPlugin("users", []ColumnDefinition{TextColumn("name")}, backend.URL, &http.Client{Timeout: 20 * time.Millisecond})
+	resp = plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate"})
+	assert.Equal(t, StatusTimeout, resp.Status.Code)
+}
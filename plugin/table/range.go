@@ -0,0 +1,94 @@
+package table
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Range collapses the =, >, >=, < and <= constraints on the column into the
+// range they allow, eg. to push a time range down to an API. min and max are
+// empty if the range is unbounded on that side, and minIncl and maxIncl report
+// whether the bounds are part of the range. The expressions are compared as
+// numbers for INTEGER, BIGINT and DOUBLE columns, and as strings otherwise.
+// ok is false if the column has no such constraint, or if the constraints
+// contradict each other (eg. > 10 and < 5), in which case no row matches.
+func (qc QueryContext) Range(column string) (min string, minIncl bool, max string, maxIncl bool, ok bool) {
+	affinity := qc.Constraints[column].Affinity
+	var hasMin, hasMax bool
+	for _, constraint := range qc.All(column) {
+		expr := constraint.Expression
+		lower, upper := false, false
+		incl := false
+		switch constraint.Operator {
+		case OperatorEquals:
+			lower, upper, incl = true, true, true
+		case OperatorGreaterThan:
+			lower = true
+		case OperatorGreaterThanOrEquals:
+			lower, incl = true, true
+		case OperatorLessThan:
+			upper = true
+		case OperatorLessThanOrEquals:
+			upper, incl = true, true
+		default:
+			continue
+		}
+
+		// Keep the tightest bounds, an exclusive bound being tighter than an
+		// inclusive one on the same value
+		if lower {
+			c := compareValues(affinity, expr, min)
+			if !hasMin || c > 0 || (c == 0 && !incl) {
+				min, minIncl = expr, incl
+			}
+			hasMin = true
+		}
+		if upper {
+			c := compareValues(affinity, expr, max)
+			if !hasMax || c < 0 || (c == 0 && !incl) {
+				max, maxIncl = expr, incl
+			}
+			hasMax = true
+		}
+	}
+
+	if !hasMin && !hasMax {
+		return "", false, "", false, false
+	}
+	if hasMin && hasMax {
+		c := compareValues(affinity, min, max)
+		if c > 0 || (c == 0 && !(minIncl && maxIncl)) {
+			return "", false, "", false, false
+		}
+	}
+	return min, minIncl, max, maxIncl, true
+}
+
+// compareValues compares the constraint expressions a and b as numbers for
+// numeric affinities, if they parse as such, and as strings otherwise.
+func compareValues(affinity ColumnType, a, b string) int {
+	switch affinity {
+	case ColumnTypeInteger, ColumnTypeBigInt, ColumnTypeDouble:
+		if x, err := strconv.ParseInt(a, 10, 64); err == nil {
+			if y, err := strconv.ParseInt(b, 10, 64); err == nil {
+				return compareOrdered(x < y, x > y)
+			}
+		}
+		if x, err := strconv.ParseFloat(a, 64); err == nil {
+			if y, err := strconv.ParseFloat(b, 64); err == nil {
+				return compareOrdered(x < y, x > y)
+			}
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
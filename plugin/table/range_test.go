@@ -0,0 +1,44 @@
+package table
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryContextRange(t *testing.T) {
+	type bounds struct {
+		min     string
+		minIncl bool
+		max     string
+		maxIncl bool
+		ok      bool
+	}
+	for _, test := range []struct {
+		name        string
+		affinity    ColumnType
+		constraints []Constraint
+		expected    bounds
+	}{
+		{"none", ColumnTypeBigInt, nil, bounds{}},
+		{"not a range", ColumnTypeText, []Constraint{{OperatorLike, "a%"}}, bounds{}},
+		{"lower", ColumnTypeBigInt, []Constraint{{OperatorGreaterThanOrEquals, "10"}}, bounds{"10", true, "", false, true}},
+		{"upper", ColumnTypeBigInt, []Constraint{{OperatorLessThan, "10"}}, bounds{"", false, "10", false, true}},
+		{"both", ColumnTypeBigInt, []Constraint{{OperatorGreaterThan, "10"}, {OperatorLessThanOrEquals, "100"}}, bounds{"10", false, "100", true, true}},
+		{"numeric", ColumnTypeBigInt, []Constraint{{OperatorGreaterThan, "9"}, {OperatorGreaterThan, "10"}, {OperatorLessThan, "100"}}, bounds{"10", false, "100", false, true}},
+		{"double", ColumnTypeDouble, []Constraint{{OperatorGreaterThan, "9.5"}, {OperatorGreaterThan, "10"}}, bounds{"10", false, "", false, true}},
+		{"text", ColumnTypeText, []Constraint{{OperatorGreaterThan, "9"}, {OperatorGreaterThan, "10"}}, bounds{"9", false, "", false, true}},
+		{"exclusive tighter", ColumnTypeBigInt, []Constraint{{OperatorGreaterThanOrEquals, "10"}, {OperatorGreaterThan, "10"}}, bounds{"10", false, "", false, true}},
+		{"equals", ColumnTypeBigInt, []Constraint{{OperatorEquals, "42"}, {OperatorGreaterThan, "10"}}, bounds{"42", true, "42", true, true}},
+		{"contradiction", ColumnTypeBigInt, []Constraint{{OperatorGreaterThan, "10"}, {OperatorLessThan, "5"}}, bounds{}},
+		{"empty", ColumnTypeBigInt, []Constraint{{OperatorGreaterThan, "10"}, {OperatorLessThanOrEquals, "10"}}, bounds{}},
+		{"point", ColumnTypeBigInt, []Constraint{{OperatorGreaterThanOrEquals, "10"}, {OperatorLessThanOrEquals, "10"}}, bounds{"10", true, "10", true, true}},
+	} {
+		qc := QueryContext{Constraints: map[string]ConstraintList{
+			"time": {test.affinity, test.constraints},
+		}}
+		var actual bounds
+		actual.min, actual.minIncl, actual.max, actual.maxIncl, actual.ok = qc.Range("time")
+		assert.Equal(t, test.expected, actual, test.name)
+	}
+}
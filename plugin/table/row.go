@@ -0,0 +1,82 @@
+package table
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Field is a column value of a Row.
+type Field struct {
+	Column string
+	Value  string
+}
+
+// Row is a table row keeping its columns in the order they were set, eg. so
+// that rows can be logged as they were built while debugging a table. osquery
+// orders the columns from the table schema, so the order is not sent.
+type Row []Field
+
+// Set sets the value of the column, appending the column if it is not in the
+// row yet.
+func (r *Row) Set(column, value string) {
+	for i := range *r {
+		if (*r)[i].Column == column {
+			(*r)[i].Value = value
+			return
+		}
+	}
+	*r = append(*r, Field{Column: column, Value: value})
+}
+
+// Get returns the value of the column, if set.
+func (r Row) Get(column string) (string, bool) {
+	for _, field := range r {
+		if field.Column == column {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// Map returns the row as a map, as returned by a GenerateFunc.
+func (r Row) Map() map[string]string {
+	row := make(map[string]string, len(r))
+	for _, field := range r {
+		row[field.Column] = field.Value
+	}
+	return row
+}
+
+// String formats the row as column=value pairs, in the order of the columns.
+func (r Row) String() string {
+	var b strings.Builder
+	for i, field := range r {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(field.Column)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(field.Value))
+	}
+	return b.String()
+}
+
+// RowGenerateFunc is a GenerateFunc returning ordered rows.
+type RowGenerateFunc func(ctx context.Context, queryContext QueryContext) ([]Row, error)
+
+// NewRowPlugin creates a table generating ordered rows. The rows are
+// converted to maps for osquery.
+func NewRowPlugin(name string, columns []ColumnDefinition, gen RowGenerateFunc, opts ...Option) *Plugin {
+	return NewPlugin(name, columns, func(ctx context.Context, queryContext QueryContext) ([]map[string]string, error) {
+		rows, err := gen(ctx, queryContext)
+		if err != nil {
+			return nil, err
+		}
+		maps := make([]map[string]string, 0, len(rows))
+		for _, row := range rows {
+			maps = append(maps, row.Map())
+		}
+		return maps, nil
+	}, opts...)
+}
@@ -0,0 +1,32 @@
+package table
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRow(t *testing.T) {
+	var row Row
+	row.Set("pid", "1")
+	row.Set("name", "init")
+	row.Set("pid", "2")
+
+	value, ok := row.Get("pid")
+	assert.True(t, ok)
+	assert.Equal(t, "2", value)
+	_, ok = row.Get("path")
+	assert.False(t, ok)
+	assert.Equal(t, `pid="2" name="init"`, row.String())
+	assert.Equal(t, map[string]string{"pid": "2", "name": "init"}, row.Map())
+
+	plugin := NewRowPlugin("rows", []ColumnDefinition{IntegerColumn("pid"), TextColumn("name")},
+		func(ctx context.Context, queryContext QueryContext) ([]Row, error) {
+			return []Row{row, {{Column: "name", Value: "kthreadd"}}}, nil
+		})
+	resp := plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"})
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"pid": "2", "name": "init"}, {"name": "kthreadd"}}, resp.Response)
+}
@@ -0,0 +1,90 @@
+package table
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The approximate memory used by a row, besides the bytes of its column names
+// and values: the map header, and the string headers and map slot of each
+// column.
+const (
+	rowOverhead    = 48
+	columnOverhead = 40
+)
+
+// RowSize returns the approximate number of bytes used by the row in memory:
+// the lengths of its column names and values, plus a fixed overhead for the
+// map and each of its entries. The actual memory used depends on the Go
+// runtime (eg. map growth and strings shared between rows), so the size is
+// meant to bound the growth of a dataset rather than to account for it
+// exactly.
+func RowSize(row map[string]string) int64 {
+	size := int64(rowOverhead)
+	for column, value := range row {
+		size += int64(columnOverhead + len(column) + len(value))
+	}
+	return size
+}
+
+// SizeTracker tracks the approximate size in bytes of a cached dataset (see
+// RowSize), eg. the rows of an in-memory table filled by osquery INSERTs,
+// optionally capping it. It is safe for concurrent use.
+type SizeTracker struct {
+	mutex sync.Mutex
+	size  int64
+	limit int64 // Maximum size, if > 0
+}
+
+// NewSizeTracker creates a tracker rejecting growth beyond limit bytes. A
+// limit <= 0 does not cap the size.
+func NewSizeTracker(limit int64) *SizeTracker {
+	return &SizeTracker{limit: limit}
+}
+
+// Add adds delta bytes to the size, which is negative when data is removed.
+// If the size would exceed the limit, it is left unchanged and a RowError
+// with the RowFailure status is returned, so that osquery fails the statement
+// writing the data.
+func (t *SizeTracker) Add(delta int64) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if delta > 0 && t.limit > 0 && t.size+delta > t.limit {
+		return &RowError{
+			Status:  RowFailure,
+			Message: "size limit of " + strconv.FormatInt(t.limit, 10) + " bytes exceeded",
+		}
+	}
+	t.size += delta
+	return nil
+}
+
+// Size returns the current size in bytes.
+func (t *SizeTracker) Size() int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.size
+}
+
+// SetLimit changes the limit. Data already tracked is kept if it exceeds the
+// new limit, but cannot grow until it is below the limit.
+func (t *SizeTracker) SetLimit(limit int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.limit = limit
+}
+
+// Collector returns a Prometheus gauge of the size, named table_memory_bytes
+// and labelled with the table name, eg. to register with the default
+// registry which the server exposes when ServerPrometheusPort is set.
+func (t *SizeTracker) Collector(table string) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "table_memory_bytes",
+		Help:        "Approximate size in bytes of the data cached by the table",
+		ConstLabels: prometheus.Labels{"table_name": table},
+	}, func() float64 {
+		return float64(t.Size())
+	})
+}
@@ -0,0 +1,47 @@
+package table
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowSize(t *testing.T) {
+	assert.Equal(t, int64(rowOverhead), RowSize(map[string]string{}))
+	assert.Equal(t, int64(rowOverhead+2*columnOverhead+len("name")+len("root")+len("uid")+len("0")),
+		RowSize(map[string]string{"name": "root", "uid": "0"}))
+}
+
+func TestSizeTracker(t *testing.T) {
+	tracker := NewSizeTracker(100)
+	require.NoError(t, tracker.Add(60))
+	err := tracker.Add(41)
+	var rowErr *RowError
+	require.ErrorAs(t, err, &rowErr)
+	assert.Equal(t, RowFailure, rowErr.Status)
+	assert.Equal(t, int64(60), tracker.Size())
+
+	require.NoError(t, tracker.Add(40))
+	require.NoError(t, tracker.Add(-50))
+	assert.Equal(t, int64(50), tracker.Size())
+
+	// Lowering the limit keeps the data, but stops its growth
+	tracker.SetLimit(10)
+	assert.Error(t, tracker.Add(1))
+	require.NoError(t, tracker.Add(-1))
+	tracker.SetLimit(0)
+	require.NoError(t, tracker.Add(1000))
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(tracker.Collector("users")))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	assert.Equal(t, "table_memory_bytes", families[0].GetName())
+	metric := families[0].GetMetric()[0]
+	assert.Equal(t, float64(1049), metric.GetGauge().GetValue())
+	assert.Equal(t, "table_name", metric.GetLabel()[0].GetName())
+	assert.Equal(t, "users", metric.GetLabel()[0].GetValue())
+}
@@ -0,0 +1,34 @@
+package table
+
+import (
+	"context"
+	"sync"
+)
+
+// State is the state kept by a stateful table between its generate calls, eg.
+// a cursor into a log.
+type State interface{}
+
+// StatefulGenerateFunc is a GenerateFunc receiving the state of the table.
+type StatefulGenerateFunc func(ctx context.Context, queryContext QueryContext, state State) ([]map[string]string, error)
+
+// NewStatefulPlugin creates a table keeping state between its generate calls,
+// instead of a package-level variable. newState creates the state on the
+// first generate call, and gen receives the same state in every call. The
+// calls to gen are serialized, so the state is accessed by one query at a
+// time without locking, but concurrent queries of the table wait for each
+// other. gen must not keep using the state after returning.
+func NewStatefulPlugin(name string, columns []ColumnDefinition, newState func() State, gen StatefulGenerateFunc, opts ...Option) *Plugin {
+	var mutex sync.Mutex
+	var state State
+	created := false
+	return NewPlugin(name, columns, func(ctx context.Context, queryContext QueryContext) ([]map[string]string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !created {
+			state = newState()
+			created = true
+		}
+		return gen(ctx, queryContext, state)
+	}, opts...)
+}
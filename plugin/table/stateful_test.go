@@ -0,0 +1,50 @@
+package table
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/stretchr/testify/assert"
+)
+
+type cursor struct {
+	offset int
+}
+
+func TestStatefulPlugin(t *testing.T) {
+	states := 0
+	plugin := NewStatefulPlugin("log", []ColumnDefinition{IntegerColumn("line")},
+		func() State {
+			states++
+			return &cursor{}
+		},
+		func(ctx context.Context, queryContext QueryContext, state State) ([]map[string]string, error) {
+			c := state.(*cursor)
+			c.offset++
+			return []map[string]string{{"line": strconv.Itoa(c.offset)}}, nil
+		})
+	request := osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"}
+
+	assert.Equal(t, 0, states)
+	resp := plugin.Call(context.Background(), request)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"line": "1"}}, resp.Response)
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"line": "2"}}, resp.Response)
+
+	// Concurrent queries do not race on the state
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plugin.Call(context.Background(), request)
+		}()
+	}
+	wg.Wait()
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"line": "13"}}, resp.Response)
+	assert.Equal(t, 1, states)
+}
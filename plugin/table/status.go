@@ -0,0 +1,107 @@
+package table
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/pkg/errors"
+)
+
+// Status codes returned by StatusFromError, which maps errors as follows
+// (wrapped errors are matched too):
+//
+//	Code  Name                    Errors
+//	0     StatusOK                nil, ErrNotFound and HTTP 404 (no rows)
+//	1     StatusFailure           errors without a more specific code
+//	2     StatusTimeout           context.DeadlineExceeded, errors with a true
+//	                              Timeout() (eg. an http.Client timeout), and
+//	                              HTTP 408 and 504
+//	3     StatusCancelled         context.Canceled
+//	4     StatusPermissionDenied  HTTP 401 and 403
+//	5     StatusUnavailable       HTTP 429 and other 5xx
+//
+// osquery only reports whether the code is 0, along with the message, but the
+// codes are visible to operators in the extension logs and call metrics.
+const (
+	StatusOK               int32 = 0
+	StatusFailure          int32 = 1
+	StatusTimeout          int32 = 2
+	StatusCancelled        int32 = 3
+	StatusPermissionDenied int32 = 4
+	StatusUnavailable      int32 = 5
+)
+
+// ErrNotFound can be returned (or wrapped) by a generate function when the
+// requested data does not exist. The table then returns no rows instead of
+// failing the query.
+var ErrNotFound = errors.New("not found")
+
+// HTTPError is an error for a failed request to an HTTP backend, which
+// StatusFromError maps to the status codes by HTTP status.
+type HTTPError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error returns the HTTP status and message.
+func (e *HTTPError) Error() string {
+	status := strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode)
+	if e.Message == "" {
+		return status
+	}
+	return status + ": " + e.Message
+}
+
+// StatusFromError maps err to the status of a call, so that the tables of an
+// extension fail consistently. See the status codes for the mapping. Errors
+// meaning an empty result (ErrNotFound and HTTP 404) get the same status as
+// nil, ie. StatusOK with the message "OK"; the message of the other statuses
+// is the error message. The generate functions of the table plugins are
+// mapped with StatusFromError.
+func StatusFromError(err error) osquery.ExtensionStatus {
+	if err == nil {
+		return osquery.ExtensionStatus{Code: StatusOK, Message: "OK"}
+	}
+
+	code := StatusFailure
+	var httpErr *HTTPError
+	var timeoutErr interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, ErrNotFound):
+		code = StatusOK
+	case errors.Is(err, context.DeadlineExceeded):
+		code = StatusTimeout
+	case errors.As(err, &timeoutErr) && timeoutErr.Timeout():
+		code = StatusTimeout
+	case errors.Is(err, context.Canceled):
+		code = StatusCancelled
+	case errors.As(err, &httpErr):
+		switch {
+		case httpErr.StatusCode == http.StatusNotFound:
+			code = StatusOK
+		case httpErr.StatusCode == http.StatusRequestTimeout || httpErr.StatusCode == http.StatusGatewayTimeout:
+			code = StatusTimeout
+		case httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden:
+			code = StatusPermissionDenied
+		case httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500:
+			code = StatusUnavailable
+		}
+	}
+	if code == StatusOK {
+		return osquery.ExtensionStatus{Code: StatusOK, Message: "OK"}
+	}
+	return osquery.ExtensionStatus{Code: code, Message: err.Error()}
+}
+
+// generateError returns the status for an error of a generate function, and
+// whether the table should return no rows instead.
+func generateError(err error) (osquery.ExtensionStatus, bool) {
+	status := StatusFromError(err)
+	if status.Code == StatusOK {
+		return status, true
+	}
+	status.Message = "error generating table: " + status.Message
+	return status, false
+}
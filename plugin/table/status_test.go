@@ -0,0 +1,57 @@
+package table
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusFromError(t *testing.T) {
+	var testCases = []struct {
+		err     error
+		code    int32
+		message string
+	}{
+		{nil, StatusOK, "OK"},
+		{ErrNotFound, StatusOK, "OK"},
+		{errors.Wrap(context.DeadlineExceeded, "listing users"), StatusTimeout, "listing users: context deadline exceeded"},
+		{fmt.Errorf("listing users: %w", context.Canceled), StatusCancelled, "listing users: context canceled"},
+		{&HTTPError{StatusCode: 404}, StatusOK, "OK"},
+		{&HTTPError{StatusCode: 504}, StatusTimeout, "504 Gateway Timeout"},
+		{errors.Wrap(&HTTPError{StatusCode: 403, Message: "missing scope"}, "listing users"), StatusPermissionDenied, "listing users: 403 Forbidden: missing scope"},
+		{&HTTPError{StatusCode: 429}, StatusUnavailable, "429 Too Many Requests"},
+		{&HTTPError{StatusCode: 500}, StatusUnavailable, "500 Internal Server Error"},
+		{&HTTPError{StatusCode: 400}, StatusFailure, "400 Bad Request"},
+		{errors.New("boom"), StatusFailure, "boom"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.message, func(t *testing.T) {
+			status := StatusFromError(tt.err)
+			assert.Equal(t, tt.code, status.Code)
+			assert.Equal(t, tt.message, status.Message)
+		})
+	}
+}
+
+func TestGenerateStatus(t *testing.T) {
+	var genErr error
+	plugin := NewPlugin("users", []ColumnDefinition{TextColumn("name")},
+		func(ctx context.Context, queryContext QueryContext) ([]map[string]string, error) {
+			return nil, genErr
+		})
+	request := osquery.ExtensionPluginRequest{"action": "generate"}
+
+	genErr = errors.Wrap(ErrNotFound, "user alice")
+	resp := plugin.Call(context.Background(), request)
+	assert.Equal(t, StatusOK, resp.Status.Code)
+	assert.Empty(t, resp.Response)
+
+	genErr = &HTTPError{StatusCode: 503}
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, StatusUnavailable, resp.Status.Code)
+	assert.Equal(t, "error generating table: 503 Service Unavailable", resp.Status.Message)
+}
@@ -0,0 +1,83 @@
+package table
+
+import (
+	"context"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/pkg/errors"
+)
+
+// StreamFunc writes the rows of a streaming table with writeRow, the values of
+// each row ordered as the columns of the table. writeRow returns an error if
+// the row cannot be sent, in which case the function should stop and return
+// it. writeRow does not keep the values, so the slice can be reused.
+type StreamFunc func(ctx context.Context, writeRow func(values []string) error) error
+
+// StreamGenerateFunc prepares the rows of a streaming table, returning the
+// number of rows and the function writing them. Errors returned here fail the
+// query as for a GenerateFunc.
+type StreamGenerateFunc func(ctx context.Context, queryContext QueryContext) (count int, write StreamFunc, err error)
+
+// NewStreamingPlugin creates a table whose rows are written directly onto the
+// connection to osquery as they are produced, for tables too large to be held
+// in memory. The number of rows is sent first, so it must be known before the
+// rows are, eg. from a COUNT query of the backing store. write must write
+// exactly count rows; an error of write, or a different number of rows, fails
+// the query. The server runs write after the call returns, so the context of
+// write is not the one passed to gen.
+func NewStreamingPlugin(name string, columns []ColumnDefinition, gen StreamGenerateFunc, opts ...Option) *Plugin {
+	t := &Plugin{
+		name:           name,
+		columns:        columns,
+		generateStream: gen,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// CallStreaming is invoked by the server to generate the contents of streaming
+// tables. Other actions are not handled.
+func (t *Plugin) CallStreaming(ctx context.Context, request osquery.ExtensionPluginRequest) (osquery.ExtensionStatus, []string, int, func(ctx context.Context, writeRow func(values []string) error) error, bool) {
+	if t.generateStream == nil || request["action"] != "generate" {
+		return osquery.ExtensionStatus{}, nil, 0, nil, false
+	}
+
+	queryContext, err := parseQueryContext(request["context"])
+	if err != nil {
+		return *createError("error parsing context JSON: ", err).Status, nil, 0, nil, true
+	}
+	if err := t.checkRequirements(*queryContext); err != nil {
+		return *createError("error generating table: ", err).Status, nil, 0, nil, true
+	}
+
+	count, write, err := t.generateStream(ctx, *queryContext)
+	if err != nil {
+		status, empty := generateError(err)
+		if empty {
+			return osquery.ExtensionStatus{Code: 0, Message: "OK"}, t.columnNames(), 0, emptyStream, true
+		}
+		return status, nil, 0, nil, true
+	}
+	if count < 0 {
+		err = errors.Errorf("negative row count %d", count)
+		return *createError("error generating table: ", err).Status, nil, 0, nil, true
+	}
+
+	return osquery.ExtensionStatus{Code: 0, Message: "OK"}, t.columnNames(), count, write, true
+}
+
+// columnNames returns the names of the declared columns.
+func (t *Plugin) columnNames() []string {
+	names := make([]string, 0, len(t.columns))
+	for _, column := range t.columns {
+		names = append(names, column.Name)
+	}
+	return names
+}
+
+// emptyStream writes no rows.
+func emptyStream(ctx context.Context, writeRow func(values []string) error) error {
+	return nil
+}
@@ -0,0 +1,66 @@
+package table
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamingPlugin(t *testing.T) {
+	var count int
+	var fail error
+	plugin := NewStreamingPlugin("numbers", []ColumnDefinition{IntegerColumn("n"), TextColumn("name")},
+		func(ctx context.Context, queryContext QueryContext) (int, StreamFunc, error) {
+			if count < 0 {
+				return count, nil, nil
+			}
+			return count, func(ctx context.Context, writeRow func([]string) error) error {
+				values := make([]string, 2)
+				for i := 0; i < 3; i++ {
+					values[0], values[1] = strconv.Itoa(i), Null
+					if err := writeRow(values); err != nil {
+						return err
+					}
+				}
+				return fail
+			}, nil
+		})
+	request := osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"}
+
+	count = 3
+	status, columns, n, write, handled := plugin.CallStreaming(context.Background(), request)
+	assert.True(t, handled)
+	assert.Equal(t, int32(0), status.Code)
+	assert.Equal(t, []string{"n", "name"}, columns)
+	assert.Equal(t, 3, n)
+	assert.NotNil(t, write)
+
+	// Call collects the rows, copying the reused values
+	resp := plugin.Call(context.Background(), request)
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"n": "0"}, {"n": "1"}, {"n": "2"}}, resp.Response)
+
+	count = 2
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "more than the 2 declared rows")
+
+	count = 3
+	fail = errors.New("backend gone")
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "backend gone")
+
+	count = -1
+	status, _, _, _, handled = plugin.CallStreaming(context.Background(), request)
+	assert.True(t, handled)
+	assert.Equal(t, int32(1), status.Code)
+	assert.Contains(t, status.Message, "negative row count")
+
+	_, _, _, _, handled = plugin.CallStreaming(context.Background(), osquery.ExtensionPluginRequest{"action": "columns"})
+	assert.False(t, handled)
+}
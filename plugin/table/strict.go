@@ -0,0 +1,133 @@
+package table
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// StrictSchema returns a copy of the table whose generated rows always match
+// its columns, for hosting tables whose row shape cannot be trusted (eg.
+// third-party or generated tables). Every row is rebuilt as follows:
+//
+//   - columns that are not declared are dropped;
+//   - declared columns missing from the row are set to the empty string;
+//   - Null values are kept, so osquery still returns NULL for them;
+//   - INTEGER and BIGINT values are trimmed of whitespace, and a decimal
+//     value is truncated to an integer ("3.7" becomes "3");
+//   - DOUBLE values are trimmed of whitespace;
+//   - numeric values that do not parse, or are out of range, are set to the
+//     empty string;
+//   - TEXT and BLOB values are kept as is.
+//
+// Columnar tables are coerced the same way, with their values ordered as the
+// declared columns.
+func StrictSchema(t *Plugin) *Plugin {
+	strict := *t
+	if t.generate != nil {
+		gen := t.generate
+		strict.generate = func(ctx context.Context, queryContext QueryContext) ([]map[string]string, error) {
+			rows, err := gen(ctx, queryContext)
+			if err != nil {
+				return nil, err
+			}
+			result := make([]map[string]string, len(rows))
+			for i, row := range rows {
+				result[i] = strictRow(t.columns, row)
+			}
+			return result, nil
+		}
+	}
+	if t.generateColumnar != nil {
+		gen := t.generateColumnar
+		strict.generateColumnar = func(ctx context.Context, queryContext QueryContext) ([]string, [][]string, error) {
+			columns, values, err := gen(ctx, queryContext)
+			if err != nil {
+				return nil, nil, err
+			}
+			return strictColumnar(t.columns, columns, values)
+		}
+	}
+	return &strict
+}
+
+// strictRow rebuilds the row with the declared columns only.
+func strictRow(columns []ColumnDefinition, row map[string]string) map[string]string {
+	result := make(map[string]string, len(columns))
+	for _, col := range columns {
+		result[col.Name] = CoerceValue(col.Type, row[col.Name])
+	}
+	return result
+}
+
+// strictColumnar rebuilds the columnar values with the declared columns only.
+// Rows of the wrong length are left for the caller to reject.
+func strictColumnar(columns []ColumnDefinition, names []string, values [][]string) ([]string, [][]string, error) {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+	resultNames := make([]string, len(columns))
+	for i, col := range columns {
+		resultNames[i] = col.Name
+	}
+
+	result := make([][]string, len(values))
+	for r, vals := range values {
+		if len(vals) != len(names) {
+			return names, values, nil
+		}
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			var value string
+			if j, ok := index[col.Name]; ok {
+				value = vals[j]
+			}
+			row[i] = CoerceValue(col.Type, value)
+		}
+		result[r] = row
+	}
+	return resultNames, result, nil
+}
+
+// CoerceValue returns the value coerced to the column type, following the
+// rules described by StrictSchema.
+func CoerceValue(columnType ColumnType, value string) string {
+	if value == Null {
+		return value
+	}
+	switch columnType {
+	case ColumnTypeInteger, ColumnTypeBigInt:
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return value
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			f, err := strconv.ParseFloat(value, 64)
+			// 2^63 is the first float above the int64 range
+			if err != nil || math.IsNaN(f) || f < math.MinInt64 || f >= -math.MinInt64 {
+				return ""
+			}
+			n = int64(f)
+		}
+		if columnType == ColumnTypeInteger && (n < math.MinInt32 || n > math.MaxInt32) {
+			return ""
+		}
+		return strconv.FormatInt(n, 10)
+
+	case ColumnTypeDouble:
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return value
+		}
+		if f, err := strconv.ParseFloat(value, 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return ""
+		}
+		return value
+
+	default:
+		return value
+	}
+}
@@ -0,0 +1,80 @@
+package table
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoerceValue(t *testing.T) {
+	tests := []struct {
+		columnType ColumnType
+		value      string
+		expected   string
+	}{
+		{ColumnTypeText, " text ", " text "},
+		{ColumnTypeBlob, "\x01 ", "\x01 "},
+		{ColumnTypeInteger, " 42\n", "42"},
+		{ColumnTypeInteger, "+7", "7"},
+		{ColumnTypeInteger, "3.7", "3"},
+		{ColumnTypeInteger, "-3.7", "-3"},
+		{ColumnTypeInteger, "1e3", "1000"},
+		{ColumnTypeInteger, "4294967296", ""},
+		{ColumnTypeInteger, "abc", ""},
+		{ColumnTypeInteger, "", ""},
+		{ColumnTypeInteger, "  ", ""},
+		{ColumnTypeInteger, Null, Null},
+		{ColumnTypeBigInt, "4294967296", "4294967296"},
+		{ColumnTypeBigInt, "1e30", ""},
+		{ColumnTypeBigInt, "NaN", ""},
+		{ColumnTypeDouble, " 1.5 ", "1.5"},
+		{ColumnTypeDouble, "1e3", "1e3"},
+		{ColumnTypeDouble, "Inf", ""},
+		{ColumnTypeDouble, "1.5.2", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, CoerceValue(tt.columnType, tt.value), "%s %q", tt.columnType, tt.value)
+	}
+}
+
+func TestStrictSchema(t *testing.T) {
+	columns := []ColumnDefinition{
+		TextColumn("name"),
+		IntegerColumn("pid"),
+		DoubleColumn("cpu"),
+	}
+	rows := []map[string]string{
+		{"name": "init", "pid": " 1 ", "cpu": "0.5", "extra": "x"},
+		{"name": "bash", "cpu": Null},
+	}
+	plugin := StrictSchema(NewPlugin("procs", columns, func(ctx context.Context, queryContext QueryContext) ([]map[string]string, error) {
+		return rows, nil
+	}))
+
+	resp := plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"})
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"name": "init", "pid": "1", "cpu": "0.5"},
+		{"name": "bash", "pid": ""},
+	}, resp.Response)
+	// The rows of the table are not modified
+	assert.Equal(t, "x", rows[0]["extra"])
+
+	columnar := StrictSchema(NewColumnarPlugin("procs", columns, func(ctx context.Context, queryContext QueryContext) ([]string, [][]string, error) {
+		return []string{"pid", "extra", "name"}, [][]string{{"2.0", "x", "sshd"}}, nil
+	}))
+	status, names, values, ok := columnar.CallColumnar(context.Background(), osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"})
+	assert.True(t, ok)
+	assert.Equal(t, int32(0), status.Code)
+	assert.Equal(t, []string{"name", "pid", "cpu"}, names)
+	assert.Equal(t, [][]string{{"sshd", "2", ""}}, values)
+
+	// Rows of the wrong length are still rejected
+	columnar = StrictSchema(NewColumnarPlugin("procs", columns, func(ctx context.Context, queryContext QueryContext) ([]string, [][]string, error) {
+		return []string{"pid"}, [][]string{{"1", "2"}}, nil
+	}))
+	status, _, _, _ = columnar.CallColumnar(context.Background(), osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"})
+	assert.Equal(t, int32(1), status.Code)
+}
@@ -5,18 +5,46 @@ import (
 	"context"
 	"encoding/json"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/internal/stream"
 	"github.com/pkg/errors"
 )
 
 // GenerateFunc returns the rows generated by the table. The ctx argument
 // should be checked for cancellation if the generation performs a
 // substantial amount of work. The queryContext argument provides the
-// deserialized JSON query context from osquery.
+// deserialized JSON query context from osquery. Columns missing from a row,
+// or set to Null, are NULL in osquery.
+//
+// osquery does not tell a table that it is disabled: the generate request only
+// holds the action and the query context. Tables listed in osquery's
+// --disable_tables flag are skipped by osquery itself; an extension wanting to
+// avoid any setup for such a table can read the flag with the client Options
+// method and not register the table.
 type GenerateFunc func(ctx context.Context, queryContext QueryContext) ([]map[string]string, error)
 
-// InsertFunc is optional implementation that can be used to implement insert SQL semantics
+// ColumnarGenerateFunc returns the rows generated by the table as parallel
+// slices. columns holds the column names and each entry in values holds the
+// values of one row, in the same order as columns. This avoids allocating a
+// map per row for tables returning a large number of rows.
+type ColumnarGenerateFunc func(ctx context.Context, queryContext QueryContext) (columns []string, values [][]string, err error)
+
+// InsertFunc is optional implementation that can be used to implement insert SQL semantics.
+//
+// The first returned map is the insert status sent to osquery, not a row of the
+// table: osquery only reads its "status" key (defaulted to "success" when
+// missing) and, if present, its "id" key which becomes the SQLite rowid of the
+// new row. The fully materialized row (including server assigned columns) can
+// follow as the second map, so that its columns never clash with these keys;
+// use InsertedRow to build such a response. osquery ignores the materialized
+// row, which is only seen by in-process callers of the plugin, and does not
+// cache inserted rows, so the plugin must store the row for a subsequent
+// generate to reflect it. Return a RowError to reject the row with a precise
+// status.
 type InsertFunc func(ctx context.Context, autoRowId bool, row []interface{}) ([]map[string]string, error)
 
 // UpdateFunc is optional implementation that can be used to implement update SQL semantics
@@ -25,35 +53,133 @@ type UpdateFunc func(ctx context.Context, rowID int64, row []interface{}) error
 // DeleteFunc is optional implementation that can be used to implement delete SQL semantics
 type DeleteFunc func(ctx context.Context, rowID int64) error
 
+// AutoIDFunc returns the row ID assigned to a row inserted into a mutable
+// table without a row ID (ie. with auto row IDs).
+type AutoIDFunc func() int64
+
 // Plugin structure holds the plugin details.
 type Plugin struct {
-	name     string
-	columns  []ColumnDefinition
-	generate GenerateFunc
-	insert   InsertFunc
-	update   UpdateFunc
-	delete   DeleteFunc
+	name             string
+	columns          []ColumnDefinition
+	generate         GenerateFunc
+	generateColumnar ColumnarGenerateFunc
+	generateStream   StreamGenerateFunc
+	insert           InsertFunc
+	update           UpdateFunc
+	delete           DeleteFunc
+	autoID           AutoIDFunc
+	useNumber        bool
+	requireAnyOf     [][]string
+	callTimeout      time.Duration
+	lazyColumns      []lazyColumn
+}
+
+// Option is function for setting table plugin options.
+type Option func(*Plugin)
+
+// AutoID sets the generator of the row IDs assigned to rows inserted with auto
+// row IDs. By default, a counter starting at 1 is used, so the IDs restart
+// with the process; use a generator backed by the storage of the table to keep
+// them unique across restarts.
+func AutoID(fn AutoIDFunc) Option {
+	return func(t *Plugin) {
+		t.autoID = fn
+	}
+}
+
+// UseNumber passes the numbers of inserted and updated rows to the InsertFunc
+// and UpdateFunc as json.Number instead of float64, so that BIGINT values
+// beyond 2^53 (eg. math.MaxInt64) keep their precision. FormatValue converts
+// either form to the column string.
+func UseNumber() Option {
+	return func(t *Plugin) {
+		t.useNumber = true
+	}
+}
+
+// RequireAnyOf requires queries of the table to constrain at least one of the
+// columns, eg. an API that looks users up either by id or by name. osquery
+// can only require individual columns (see REQUIRED), so the table checks the
+// requirement itself and fails generate with an actionable message. The
+// option can be set several times for several groups of columns.
+func RequireAnyOf(columns ...string) Option {
+	return func(t *Plugin) {
+		t.requireAnyOf = append(t.requireAnyOf, columns)
+	}
+}
+
+// CallTimeout sets the timeout of the context of the calls to the table,
+// instead of the server call timeout, eg. for a table backed by a slow API.
+func CallTimeout(timeout time.Duration) Option {
+	return func(t *Plugin) {
+		t.callTimeout = timeout
+	}
+}
+
+// CallTimeout returns the timeout set with the CallTimeout option, or 0 if it
+// is not set.
+func (t *Plugin) CallTimeout() time.Duration {
+	return t.callTimeout
+}
+
+type autoRowIDKey struct{}
+
+// AutoRowID returns the row ID assigned to the row being inserted, when
+// called from an InsertFunc invoked with autoRowID set. The ID is also sent
+// back to osquery unless the insert result has an "id".
+func AutoRowID(ctx context.Context) (int64, bool) {
+	rowID, ok := ctx.Value(autoRowIDKey{}).(int64)
+	return rowID, ok
 }
 
 // NewPlugin is helper method to create plugin structure.
-func NewPlugin(name string, columns []ColumnDefinition, gen GenerateFunc) *Plugin {
-	return &Plugin{
+func NewPlugin(name string, columns []ColumnDefinition, gen GenerateFunc, opts ...Option) *Plugin {
+	t := &Plugin{
 		name:     name,
 		columns:  columns,
 		generate: gen,
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
-// NewMutablePlugin is helper method to create mutable plugin structure.
-func NewMutablePlugin(name string, columns []ColumnDefinition, gen GenerateFunc, ins InsertFunc, upd UpdateFunc, del DeleteFunc) *Plugin {
-	return &Plugin{
+// NewMutablePlugin is helper method to create mutable plugin structure. Any of
+// ins, upd and del can be nil (eg. for an insert-only table): the table then
+// advertises the operation as unsupported, and osquery gets an "operation not
+// supported" error if it requests it anyway.
+func NewMutablePlugin(name string, columns []ColumnDefinition, gen GenerateFunc, ins InsertFunc, upd UpdateFunc, del DeleteFunc, opts ...Option) *Plugin {
+	var lastID int64
+	t := &Plugin{
 		name:     name,
 		columns:  columns,
 		generate: gen,
 		insert:   ins,
 		update:   upd,
 		delete:   del,
+		autoID: func() int64 {
+			return atomic.AddInt64(&lastID, 1)
+		},
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// NewColumnarPlugin is helper method to create plugin structure whose rows are
+// generated in columnar form.
+func NewColumnarPlugin(name string, columns []ColumnDefinition, gen ColumnarGenerateFunc, opts ...Option) *Plugin {
+	t := &Plugin{
+		name:             name,
+		columns:          columns,
+		generateColumnar: gen,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
 func createError(prefix string, err error) osquery.ExtensionResponse {
@@ -79,43 +205,103 @@ func (t *Plugin) RegistryName() string {
 	return "table"
 }
 
-// Routes returns the table columns definitions.
+// Routes returns the table columns definitions. Mutable tables also include a
+// "mutable" route listing which of insert, update and delete are supported.
+// This route is metadata of this SDK, eg. for tools inspecting the registry:
+// osquery ignores routes other than the columns and forwards writes to every
+// extension table, so unsupported writes are only rejected when the table is
+// called.
 func (t *Plugin) Routes() osquery.ExtensionPluginResponse {
 	routes := []map[string]string{}
 	for _, col := range t.columns {
-		routes = append(routes, map[string]string{
+		route := map[string]string{
 			"id":   "column",
 			"name": col.Name,
 			"type": string(col.Type),
 			"op":   strconv.Itoa(int(col.Op)),
+		}
+		if col.Description != "" {
+			route["description"] = col.Description
+		}
+		if col.Collation != "" {
+			route["collate"] = string(col.Collation)
+		}
+		routes = append(routes, route)
+	}
+	if t.insert != nil || t.update != nil || t.delete != nil {
+		routes = append(routes, map[string]string{
+			"id":     "mutable",
+			"insert": boolRoute(t.insert != nil),
+			"update": boolRoute(t.update != nil),
+			"delete": boolRoute(t.delete != nil),
 		})
 	}
 	return routes
 }
 
+func boolRoute(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
 // Call is invoked to generate the table contents or to get the column details.
 func (t *Plugin) Call(ctx context.Context, request osquery.ExtensionPluginRequest) osquery.ExtensionResponse {
 	ok := osquery.ExtensionStatus{Code: 0, Message: "OK"}
 	switch request["action"] {
 	case "generate":
+		if t.generateColumnar != nil {
+			status, columns, values, _ := t.CallColumnar(ctx, request)
+			if status.Code != 0 {
+				return osquery.ExtensionResponse{Status: &status}
+			}
+			return osquery.ExtensionResponse{Status: &ok, Response: columnarRows(columns, values)}
+		}
+		if t.generateStream != nil {
+			status, columns, count, write, _ := t.CallStreaming(ctx, request)
+			if status.Code != 0 {
+				return osquery.ExtensionResponse{Status: &status}
+			}
+			values, err := stream.Collect(ctx, columns, count, write)
+			if err != nil {
+				return createError("error streaming table: ", err)
+			}
+			return osquery.ExtensionResponse{Status: &ok, Response: columnarRows(columns, values)}
+		}
+
+		if t.generate == nil {
+			return createError("'generate' not supported by table: "+t.name, nil)
+		}
+
 		queryContext, err := parseQueryContext(request["context"])
 		if err != nil {
 			return createError("error parsing context JSON: ", err)
 		}
+		if err := t.checkRequirements(*queryContext); err != nil {
+			return createError("error generating table: ", err)
+		}
 
 		rows, err := t.generate(ctx, *queryContext)
+		if err == nil {
+			rows, err = t.computeLazyColumns(ctx, *queryContext, rows)
+		}
 		if err != nil {
-			return createError("error generating table: ", err)
+			status, empty := generateError(err)
+			if empty {
+				return osquery.ExtensionResponse{Status: &ok, Response: []map[string]string{}}
+			}
+			return osquery.ExtensionResponse{Status: &status}
 		}
 
-		return osquery.ExtensionResponse{Status: &ok, Response: rows}
+		return osquery.ExtensionResponse{Status: &ok, Response: withoutNulls(rows)}
 
 	case "insert":
 		if t.insert == nil {
-			return createError("'insert' not implemented by table: "+t.name, nil)
+			return createError("'insert' not supported by table: "+t.name, nil)
 		}
 
-		row, err := parseRow(request["json_value_array"])
+		row, err := parseRow(request["json_value_array"], t.useNumber)
 		if err != nil {
 			return createError("invalid data to insert: ", err)
 		}
@@ -125,16 +311,26 @@ func (t *Plugin) Call(ctx context.Context, request osquery.ExtensionPluginReques
 			return createError("invalid value for auto_rowid: ", err)
 		}
 
+		rowID := ""
+		if autoRowID && t.autoID != nil {
+			id := t.autoID()
+			ctx = context.WithValue(ctx, autoRowIDKey{}, id)
+			rowID = strconv.FormatInt(id, 10)
+		}
+
 		rows, err := t.insert(ctx, autoRowID, row)
+		if resp, ok := rowErrorResponse(err); ok {
+			return resp
+		}
 		if err != nil {
 			return createError("error inserting into table: ", err)
 		}
 
-		return osquery.ExtensionResponse{Status: &ok, Response: rows}
+		return osquery.ExtensionResponse{Status: &ok, Response: insertResponse(rows, rowID)}
 
 	case "update":
 		if t.update == nil {
-			return createError("'update' not implemented by table: "+t.name, nil)
+			return createError("'update' not supported by table: "+t.name, nil)
 		}
 
 		rowID, err := strconv.ParseInt(request["id"], 10, 64)
@@ -142,12 +338,15 @@ func (t *Plugin) Call(ctx context.Context, request osquery.ExtensionPluginReques
 			return createError("invalid row id to update: ", err)
 		}
 
-		row, err := parseRow(request["json_value_array"])
+		row, err := parseRow(request["json_value_array"], t.useNumber)
 		if err != nil {
 			return createError("invalid data to update: ", err)
 		}
 
 		err = t.update(ctx, rowID, row)
+		if resp, ok := rowErrorResponse(err); ok {
+			return resp
+		}
 		if err != nil {
 			return createError("error updating table: ", err)
 		}
@@ -156,7 +355,7 @@ func (t *Plugin) Call(ctx context.Context, request osquery.ExtensionPluginReques
 
 	case "delete":
 		if t.delete == nil {
-			return createError("'delete' not implemented by table: "+t.name, nil)
+			return createError("'delete' not supported by table: "+t.name, nil)
 		}
 
 		rowID, err := strconv.ParseInt(request["id"], 10, 64)
@@ -165,6 +364,9 @@ func (t *Plugin) Call(ctx context.Context, request osquery.ExtensionPluginReques
 		}
 
 		err = t.delete(ctx, rowID)
+		if resp, ok := rowErrorResponse(err); ok {
+			return resp
+		}
 		if err != nil {
 			return createError("error deleting from table: ", err)
 		}
@@ -180,6 +382,192 @@ func (t *Plugin) Call(ctx context.Context, request osquery.ExtensionPluginReques
 
 }
 
+// CallColumnar is invoked by the server to generate the contents of columnar
+// tables without building a map per row. Other actions are not handled.
+func (t *Plugin) CallColumnar(ctx context.Context, request osquery.ExtensionPluginRequest) (osquery.ExtensionStatus, []string, [][]string, bool) {
+	if t.generateColumnar == nil || request["action"] != "generate" {
+		return osquery.ExtensionStatus{}, nil, nil, false
+	}
+
+	queryContext, err := parseQueryContext(request["context"])
+	if err != nil {
+		return *createError("error parsing context JSON: ", err).Status, nil, nil, true
+	}
+	if err := t.checkRequirements(*queryContext); err != nil {
+		return *createError("error generating table: ", err).Status, nil, nil, true
+	}
+
+	columns, values, err := t.generateColumnar(ctx, *queryContext)
+	if err != nil {
+		status, _ := generateError(err)
+		return status, nil, nil, true
+	}
+	for i, row := range values {
+		if len(row) != len(columns) {
+			err = errors.Errorf("row %d has %d values, expected %d", i, len(row), len(columns))
+			return *createError("error generating table: ", err).Status, nil, nil, true
+		}
+	}
+
+	return osquery.ExtensionStatus{Code: 0, Message: "OK"}, columns, values, true
+}
+
+// columnarRows converts columnar results to row maps.
+func columnarRows(columns []string, values [][]string) []map[string]string {
+	rows := make([]map[string]string, 0, len(values))
+	for _, vals := range values {
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			if vals[i] != Null {
+				row[column] = vals[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// withoutNulls returns the rows with the Null columns left out. The rows (and
+// the slice) are copied only if they hold Null values, so that the plugin can
+// keep returning the same rows.
+func withoutNulls(rows []map[string]string) []map[string]string {
+	var result []map[string]string
+	for i, row := range rows {
+		null := false
+		for _, value := range row {
+			if value == Null {
+				null = true
+				break
+			}
+		}
+		if null && result == nil {
+			result = make([]map[string]string, i, len(rows))
+			copy(result, rows[:i])
+		}
+		if result == nil {
+			continue
+		}
+		if null {
+			stripped := make(map[string]string, len(row))
+			for column, value := range row {
+				if value != Null {
+					stripped[column] = value
+				}
+			}
+			row = stripped
+		}
+		result = append(result, row)
+	}
+	if result == nil {
+		return rows
+	}
+	return result
+}
+
+// InsertedRow builds the insert result for a new row with the specified row
+// ID: the status for osquery, followed by a copy of the materialized row so
+// that the plugin can keep storing the original map. Columns of the row named
+// "id" or "status" are kept in the row and do not affect the status.
+func InsertedRow(rowID int64, row map[string]string) []map[string]string {
+	result := make(map[string]string, len(row))
+	for k, v := range row {
+		result[k] = v
+	}
+	status := map[string]string{
+		"id":     strconv.FormatInt(rowID, 10),
+		"status": string(RowSuccess),
+	}
+	return []map[string]string{status, result}
+}
+
+// insertResponse makes sure that the insert status, ie. the first map of the
+// insert result, carries a status for osquery and, for successful inserts, the
+// assigned row ID (if not empty) unless it has an ID. The materialized row
+// following the status is passed through untouched.
+func insertResponse(rows []map[string]string, rowID string) []map[string]string {
+	if len(rows) == 0 {
+		rows = []map[string]string{{}}
+	}
+	status, hasStatus := rows[0]["status"]
+	_, hasID := rows[0]["id"]
+	if hasStatus && (hasID || rowID == "" || status != string(RowSuccess)) {
+		return rows
+	}
+
+	first := make(map[string]string, len(rows[0])+2)
+	for k, v := range rows[0] {
+		first[k] = v
+	}
+	if !hasStatus {
+		first["status"] = string(RowSuccess)
+	}
+	if !hasID && rowID != "" {
+		first["id"] = rowID
+	}
+	return append([]map[string]string{first}, rows[1:]...)
+}
+
+// RowStatus is the status of a row written by insert, update or delete, as
+// reported to osquery.
+type RowStatus string
+
+// The following row statuses are understood by osquery.
+const (
+	// RowSuccess means the row was written.
+	RowSuccess RowStatus = "success"
+
+	// RowConstraint means the row violates a constraint of the table (eg. a
+	// duplicate key). osquery fails the statement with SQLITE_CONSTRAINT.
+	RowConstraint RowStatus = "constraint"
+
+	// RowReadOnly means the row cannot be modified. osquery fails the
+	// statement with SQLITE_READONLY.
+	RowReadOnly RowStatus = "readonly"
+
+	// RowFailure means the row could not be written. osquery fails the
+	// statement with the message of the RowError.
+	RowFailure RowStatus = "failure"
+)
+
+// RowError can be returned by InsertFunc, UpdateFunc and DeleteFunc to reject
+// the single row being written with a precise status and message.
+//
+// osquery writes rows one at a time, calling the plugin once per row even for
+// statements affecting multiple rows, and stops the statement at the first
+// rejected row. A RowError is sent back as a successful call whose row carries
+// the status and message, which osquery maps to the matching SQLite error for
+// that row. Any other error fails the whole call, and osquery only reports a
+// generic error for the statement.
+type RowError struct {
+	Status  RowStatus
+	Message string
+}
+
+// Error returns the status and message of the row error.
+func (e *RowError) Error() string {
+	if e.Message == "" {
+		return string(e.Status)
+	}
+	return string(e.Status) + ": " + e.Message
+}
+
+// rowErrorResponse returns the response for err if it is (or wraps) a RowError.
+func rowErrorResponse(err error) (osquery.ExtensionResponse, bool) {
+	var rowErr *RowError
+	if err == nil || !errors.As(err, &rowErr) {
+		return osquery.ExtensionResponse{}, false
+	}
+
+	row := map[string]string{"status": string(rowErr.Status)}
+	if rowErr.Message != "" {
+		row["message"] = rowErr.Message
+	}
+	return osquery.ExtensionResponse{
+		Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+		Response: []map[string]string{row},
+	}, true
+}
+
 // Ping returns static OK response.
 func (t *Plugin) Ping() osquery.ExtensionStatus {
 	return osquery.ExtensionStatus{Code: 0, Message: "OK"}
@@ -189,12 +577,14 @@ func (t *Plugin) Ping() osquery.ExtensionStatus {
 func (t *Plugin) Shutdown() {}
 
 // ColumnDefinition defines the relevant information for a column in a table
-// plugin. Both values are mandatory. Prefer using the *Column helpers to
+// plugin. Name and Type are mandatory. Prefer using the *Column helpers to
 // create ColumnDefinition structs.
 type ColumnDefinition struct {
-	Name string
-	Type ColumnType
-	Op   ColumnOptions
+	Name        string
+	Type        ColumnType
+	Op          ColumnOptions
+	Description string
+	Collation   ColumnCollation
 }
 
 // TextColumn is a helper for defining columns containing strings.
@@ -234,6 +624,35 @@ func DoubleColumn(name string, options ...ColumnOptions) ColumnDefinition {
 	}
 }
 
+// TextColumnWithDescription is a helper for defining described columns containing strings.
+func TextColumnWithDescription(name, description string, options ...ColumnOptions) ColumnDefinition {
+	col := TextColumn(name, options...)
+	col.Description = description
+	return col
+}
+
+// IntegerColumnWithDescription is a helper for defining described columns containing integers.
+func IntegerColumnWithDescription(name, description string, options ...ColumnOptions) ColumnDefinition {
+	col := IntegerColumn(name, options...)
+	col.Description = description
+	return col
+}
+
+// BigIntColumnWithDescription is a helper for defining described columns containing big integers.
+func BigIntColumnWithDescription(name, description string, options ...ColumnOptions) ColumnDefinition {
+	col := BigIntColumn(name, options...)
+	col.Description = description
+	return col
+}
+
+// DoubleColumnWithDescription is a helper for defining described columns containing floating
+// point values.
+func DoubleColumnWithDescription(name, description string, options ...ColumnOptions) ColumnDefinition {
+	col := DoubleColumn(name, options...)
+	col.Description = description
+	return col
+}
+
 func getColumnOption(options ...ColumnOptions) ColumnOptions {
 	op := DEFAULT
 	if len(options) > 0 {
@@ -254,8 +673,31 @@ const (
 	ColumnTypeInteger ColumnType = "INTEGER"
 	ColumnTypeBigInt  ColumnType = "BIGINT"
 	ColumnTypeDouble  ColumnType = "DOUBLE"
+	ColumnTypeBlob    ColumnType = "BLOB"
+)
+
+// ColumnCollation is the SQLite collating sequence of a column. It is sent to
+// osquery as the "collate" column route attribute, which is advisory: osquery
+// declares extension columns without a collation, so constraints on the column
+// still compare values with BINARY. Queries needing case insensitive matching
+// must ask for it, eg. with "WHERE name = 'Admin' COLLATE NOCASE" or LIKE.
+type ColumnCollation string
+
+// The following collations are built into SQLite.
+const (
+	CollationBinary ColumnCollation = "BINARY"
+	CollationNoCase ColumnCollation = "NOCASE"
+	CollationRTrim  ColumnCollation = "RTRIM"
 )
 
+// Collate returns a copy of the column definition advertising the specified
+// collation, eg. CollationNoCase for user names or paths on case insensitive
+// file systems. See ColumnCollation: osquery does not apply it.
+func (c ColumnDefinition) Collate(collation ColumnCollation) ColumnDefinition {
+	c.Collation = collation
+	return c
+}
+
 // ColumnOptions for marking columns
 type ColumnOptions int
 
@@ -283,10 +725,163 @@ const (
 // that can optionally be used to optimize the table generation. Note that the
 // osquery SQLite engine will perform the filtering with these constraints, so
 // it is not mandatory that they be used in table generation.
+//
+// osquery does not send the text of the query to the table: SQLite only hands
+// the constraints it can push down to a virtual table, so the SQL cannot be
+// reconstructed from the query context either (eg. joins, OR clauses and
+// functions are evaluated by SQLite). Audit the queries touching a table where
+// they are issued, eg. in the osquery scheduler or distributed query logs.
 type QueryContext struct {
 	// Constraints is a map from column name to the details of the
 	// constraints on that column.
 	Constraints map[string]ConstraintList
+
+	// Limit is the LIMIT of the query, or nil if osquery did not supply one.
+	Limit *int
+
+	// Offset is the OFFSET of the query, or 0 if osquery did not supply one.
+	Offset int
+
+	// Columns are the columns used by the query, or nil if osquery did not
+	// supply them ("colsUsed").
+	Columns []string
+}
+
+// WantsColumn returns true if the query uses the specified column, so that
+// tables can skip computing expensive columns (eg. a file hash) that are not
+// selected. All columns are wanted if osquery did not supply the used columns.
+func (qc QueryContext) WantsColumn(name string) bool {
+	if qc.Columns == nil {
+		return true
+	}
+	for _, column := range qc.Columns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyLimit trims the generated rows to the LIMIT of the query, for tables
+// that cannot push the LIMIT down to their backend. All rows are returned if
+// the query has no LIMIT. The OFFSET rows are kept, since the osquery SQLite
+// engine still skips them when applying the OFFSET itself.
+func (qc QueryContext) ApplyLimit(rows []map[string]string) []map[string]string {
+	if qc.Limit == nil || *qc.Limit < 0 {
+		return rows
+	}
+
+	n := *qc.Limit
+	if qc.Offset > 0 {
+		n += qc.Offset
+	}
+	if n < len(rows) {
+		return rows[:n]
+	}
+	return rows
+}
+
+// All returns the constraints of the query on the specified column, with
+// their operators and expressions, in the order supplied by osquery. Tables
+// translating constraints to the query language of their backend can use this
+// to push down any operator. nil is returned if the column is unconstrained.
+func (qc QueryContext) All(column string) []Constraint {
+	return qc.Constraints[column].Constraints
+}
+
+// HasConstraint returns true if the query supplied at least one constraint for
+// the specified column.
+func (qc QueryContext) HasConstraint(column string) bool {
+	return len(qc.All(column)) > 0
+}
+
+// checkRequirements checks the RequireAnyOf requirements of the table.
+func (t *Plugin) checkRequirements(queryContext QueryContext) error {
+	for _, columns := range t.requireAnyOf {
+		if err := queryContext.RequireAnyOf(columns...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RequireAnyOf returns an error unless the query supplied a constraint for at
+// least one of the specified columns.
+func (qc QueryContext) RequireAnyOf(columns ...string) error {
+	for _, column := range columns {
+		if qc.HasConstraint(column) {
+			return nil
+		}
+	}
+	return errors.Errorf("missing required constraint on one of the column(s): %s", strings.Join(columns, ", "))
+}
+
+// RequireConstraints returns an error naming all the specified columns that
+// have no constraint in the query. Tables with REQUIRED columns can use this
+// to fail with an actionable message instead of scanning everything.
+func (qc QueryContext) RequireConstraints(columns ...string) error {
+	var missing []string
+	for _, column := range columns {
+		if !qc.HasConstraint(column) {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("missing required constraint(s) on column(s): %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// RequireOperators returns an error unless the query supplied a constraint on
+// the column and all its constraints use one of the specified operators. This
+// lets a table insist on the operators its backend can serve efficiently, eg.
+// an equality on id, rather than scanning everything for a LIKE.
+func (qc QueryContext) RequireOperators(column string, ops ...Operator) error {
+	constraints := qc.All(column)
+	if len(constraints) == 0 {
+		return errors.Errorf("missing required constraint on column %s", column)
+	}
+
+	var unsupported []string
+	for _, constraint := range constraints {
+		supported := false
+		for _, op := range ops {
+			if constraint.Operator == op {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			unsupported = append(unsupported, constraint.Operator.String())
+		}
+	}
+	if len(unsupported) > 0 {
+		allowed := make([]string, 0, len(ops))
+		for _, op := range ops {
+			allowed = append(allowed, op.String())
+		}
+		return errors.Errorf("unsupported operator(s) %s on column %s, expected one of: %s",
+			strings.Join(unsupported, ", "), column, strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+// GetJSON unmarshals the expression of the first equality constraint on the
+// specified column as JSON into dst. Tables whose constraints carry structured
+// filters (eg. WHERE filter = '{"tags":["a","b"]}') can use this to decode
+// them. An error is returned if the column has no equality constraint or the
+// expression is not valid JSON.
+func (qc QueryContext) GetJSON(column string, dst interface{}) error {
+	for _, constraint := range qc.All(column) {
+		if constraint.Operator != OperatorEquals {
+			continue
+		}
+		if err := json.Unmarshal([]byte(constraint.Expression), dst); err != nil {
+			return errors.Wrapf(err, "unmarshaling constraint on column %s as JSON", column)
+		}
+		return nil
+	}
+	return errors.Errorf("no equality constraint on column %s", column)
 }
 
 // ConstraintList contains the details of the constraints for the given column.
@@ -319,10 +914,41 @@ const (
 	OperatorUnique              Operator = 1
 )
 
+// String returns the SQL form of the operator.
+func (o Operator) String() string {
+	switch o {
+	case OperatorEquals:
+		return "="
+	case OperatorGreaterThan:
+		return ">"
+	case OperatorLessThanOrEquals:
+		return "<="
+	case OperatorLessThan:
+		return "<"
+	case OperatorGreaterThanOrEquals:
+		return ">="
+	case OperatorMatch:
+		return "MATCH"
+	case OperatorLike:
+		return "LIKE"
+	case OperatorGlob:
+		return "GLOB"
+	case OperatorRegexp:
+		return "REGEXP"
+	case OperatorUnique:
+		return "UNIQUE"
+	default:
+		return "Operator(" + strconv.Itoa(int(o)) + ")"
+	}
+}
+
 // The following types and functions exist for parsing of the queryContext
 // JSON and are not made public.
 type queryContextJSON struct {
 	Constraints []constraintListJSON `json:"constraints"`
+	Limit       interface{}          `json:"limit"`
+	Offset      interface{}          `json:"offset"`
+	ColsUsed    []string             `json:"colsUsed"`
 }
 
 type constraintListJSON struct {
@@ -332,7 +958,7 @@ type constraintListJSON struct {
 }
 
 func parseQueryContext(ctxJSON string) (*QueryContext, error) {
-	ctx := QueryContext{map[string]ConstraintList{}}
+	ctx := QueryContext{Constraints: map[string]ConstraintList{}}
 	if ctxJSON == "" {
 		return &ctx, nil
 	}
@@ -355,16 +981,47 @@ func parseQueryContext(ctxJSON string) (*QueryContext, error) {
 		}
 	}
 
+	if parsed.Limit != nil {
+		limit, err := parseContextInt(parsed.Limit)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing limit")
+		}
+		ctx.Limit = &limit
+	}
+	if parsed.Offset != nil {
+		offset, err := parseContextInt(parsed.Offset)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing offset")
+		}
+		ctx.Offset = offset
+	}
+	ctx.Columns = parsed.ColsUsed
+
 	return &ctx, nil
 }
 
-func parseRow(row string) ([]interface{}, error) {
+func parseContextInt(val interface{}) (int, error) {
+	switch v := val.(type) {
+	case string: // osquery < 3.0 with stringy types
+		return strconv.Atoi(v)
+	case float64: // osquery > 3.0 with strong types
+		return int(v), nil
+	default:
+		return 0, errors.Errorf("cannot parse type %T", v)
+	}
+}
+
+func parseRow(row string, useNumber bool) ([]interface{}, error) {
 	if row == "" {
 		return nil, errors.Errorf("invalid data to insert")
 	}
 
 	var parsed []interface{}
-	err := json.Unmarshal([]byte(row), &parsed)
+	decoder := json.NewDecoder(strings.NewReader(row))
+	if useNumber {
+		decoder.UseNumber()
+	}
+	err := decoder.Decode(&parsed)
 	if err != nil {
 		return nil, errors.Wrap(err, "unmarshaling JSON")
 	}
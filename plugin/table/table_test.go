@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/Uptycs/basequery-go/gen/osquery"
 	"github.com/stretchr/testify/assert"
@@ -57,7 +61,7 @@ func TestTablePlugin(t *testing.T) {
 
 	// Call with good action and context
 	resp = plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"})
-	assert.Equal(t, QueryContext{map[string]ConstraintList{}}, calledQueryCtx)
+	assert.Equal(t, QueryContext{Constraints: map[string]ConstraintList{}}, calledQueryCtx)
 	assert.Equal(t, &StatusOK, resp.Status)
 	assert.Equal(t, osquery.ExtensionPluginResponse{
 		{
@@ -156,7 +160,7 @@ func TestParseQueryContext(t *testing.T) {
 	}{
 		{
 			json:    "",
-			context: QueryContext{map[string]ConstraintList{}},
+			context: QueryContext{Constraints: map[string]ConstraintList{}},
 		},
 		{
 			json: `
@@ -189,7 +193,7 @@ func TestParseQueryContext(t *testing.T) {
     }
   ]
 }`,
-			context: QueryContext{map[string]ConstraintList{
+			context: QueryContext{Constraints: map[string]ConstraintList{
 				"big_int": {ColumnTypeBigInt, []Constraint{}},
 				"double":  {ColumnTypeDouble, []Constraint{}},
 				"integer": {ColumnTypeInteger, []Constraint{}},
@@ -233,7 +237,7 @@ func TestParseQueryContext(t *testing.T) {
   ]
 }
 `,
-			context: QueryContext{map[string]ConstraintList{
+			context: QueryContext{Constraints: map[string]ConstraintList{
 				"big_int": {ColumnTypeBigInt, []Constraint{}},
 				"double":  {ColumnTypeDouble, []Constraint{{OperatorGreaterThanOrEquals, "3.1"}}},
 				"integer": {ColumnTypeInteger, []Constraint{}},
@@ -318,3 +322,557 @@ func TestParseVaryingQueryContexts(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireConstraints(t *testing.T) {
+	qc := QueryContext{Constraints: map[string]ConstraintList{
+		"path":  {ColumnTypeText, []Constraint{{OperatorEquals, "/tmp"}}},
+		"name":  {ColumnTypeText, []Constraint{}},
+		"inode": {ColumnTypeBigInt, []Constraint{{OperatorGreaterThan, "1"}}},
+	}}
+
+	assert.True(t, qc.HasConstraint("path"))
+	assert.False(t, qc.HasConstraint("name"))
+	assert.False(t, qc.HasConstraint("missing"))
+
+	assert.NoError(t, qc.RequireConstraints())
+	assert.NoError(t, qc.RequireConstraints("path", "inode"))
+
+	err := qc.RequireConstraints("path", "name", "missing")
+	require.Error(t, err)
+	assert.Equal(t, "missing required constraint(s) on column(s): name, missing", err.Error())
+}
+
+func TestRequireOperators(t *testing.T) {
+	qc := QueryContext{Constraints: map[string]ConstraintList{
+		"id":    {ColumnTypeBigInt, []Constraint{{OperatorEquals, "1"}}},
+		"name":  {ColumnTypeText, []Constraint{{OperatorEquals, "a"}, {OperatorLike, "b%"}}},
+		"other": {ColumnTypeText, []Constraint{{Operator(3), "x"}}},
+	}}
+
+	assert.NoError(t, qc.RequireOperators("id", OperatorEquals))
+	assert.NoError(t, qc.RequireOperators("name", OperatorEquals, OperatorLike))
+
+	err := qc.RequireOperators("name", OperatorEquals)
+	require.Error(t, err)
+	assert.Equal(t, "unsupported operator(s) LIKE on column name, expected one of: =", err.Error())
+
+	err = qc.RequireOperators("other", OperatorEquals, OperatorGlob)
+	require.Error(t, err)
+	assert.Equal(t, "unsupported operator(s) Operator(3) on column other, expected one of: =, GLOB", err.Error())
+
+	err = qc.RequireOperators("missing", OperatorEquals)
+	require.Error(t, err)
+	assert.Equal(t, "missing required constraint on column missing", err.Error())
+}
+
+func TestRequireAnyOf(t *testing.T) {
+	qc := QueryContext{Constraints: map[string]ConstraintList{
+		"name": {ColumnTypeText, []Constraint{{OperatorEquals, "alice"}}},
+	}}
+	assert.NoError(t, qc.RequireAnyOf("uid", "name"))
+	assert.EqualError(t, qc.RequireAnyOf("uid", "email"), "missing required constraint on one of the column(s): uid, email")
+
+	called := false
+	plugin := NewPlugin("users", []ColumnDefinition{IntegerColumn("uid"), TextColumn("name")},
+		func(ctx context.Context, queryContext QueryContext) ([]map[string]string, error) {
+			called = true
+			return nil, nil
+		}, RequireAnyOf("uid", "name"))
+
+	resp := plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate", "context": `{"constraints":[]}`})
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Equal(t, "error generating table: missing required constraint on one of the column(s): uid, name", resp.Status.Message)
+	assert.False(t, called)
+
+	resp = plugin.Call(context.Background(), osquery.ExtensionPluginRequest{
+		"action":  "generate",
+		"context": `{"constraints":[{"name":"uid","list":[{"op":2,"expr":"0"}]}]}`,
+	})
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.True(t, called)
+}
+
+func TestQueryContextGetJSON(t *testing.T) {
+	qc := QueryContext{Constraints: map[string]ConstraintList{
+		"filter": {ColumnTypeText, []Constraint{{OperatorLike, "%x%"}, {OperatorEquals, `{"tags":["a","b"],"limit":2}`}}},
+		"bad":    {ColumnTypeText, []Constraint{{OperatorEquals, "not json"}}},
+		"range":  {ColumnTypeText, []Constraint{{OperatorGreaterThan, "[1]"}}},
+	}}
+
+	var filter struct {
+		Tags  []string `json:"tags"`
+		Limit int      `json:"limit"`
+	}
+	require.NoError(t, qc.GetJSON("filter", &filter))
+	assert.Equal(t, []string{"a", "b"}, filter.Tags)
+	assert.Equal(t, 2, filter.Limit)
+
+	var values []int
+	err := qc.GetJSON("bad", &values)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unmarshaling constraint on column bad as JSON")
+
+	assert.EqualError(t, qc.GetJSON("range", &values), "no equality constraint on column range")
+	assert.EqualError(t, qc.GetJSON("missing", &values), "no equality constraint on column missing")
+}
+
+func TestQueryContextAll(t *testing.T) {
+	qc := QueryContext{Constraints: map[string]ConstraintList{
+		"size": {ColumnTypeBigInt, []Constraint{{OperatorGreaterThan, "10"}, {OperatorLessThanOrEquals, "100"}}},
+		"name": {ColumnTypeText, []Constraint{}},
+	}}
+
+	assert.Equal(t, []Constraint{{OperatorGreaterThan, "10"}, {OperatorLessThanOrEquals, "100"}}, qc.All("size"))
+	assert.Empty(t, qc.All("name"))
+	assert.Nil(t, qc.All("missing"))
+	assert.Nil(t, QueryContext{}.All("size"))
+}
+
+func TestMutableTablePluginInsert(t *testing.T) {
+	var StatusOK = osquery.ExtensionStatus{Code: 0, Message: "OK"}
+	stored := map[string]string{"name": "foo", "created": "1600000000"}
+	var returned []map[string]string
+	plugin := NewMutablePlugin(
+		"mock",
+		[]ColumnDefinition{TextColumn("name"), BigIntColumn("created")},
+		func(ctx context.Context, queryCtx QueryContext) ([]map[string]string, error) {
+			return nil, nil
+		},
+		func(ctx context.Context, autoRowID bool, row []interface{}) ([]map[string]string, error) {
+			return returned, nil
+		},
+		nil,
+		nil,
+	)
+
+	request := osquery.ExtensionPluginRequest{"action": "insert", "auto_rowid": "false", "json_value_array": `["foo", null]`}
+
+	// Materialized row follows the status, without mutating the stored row
+	returned = InsertedRow(7, stored)
+	resp := plugin.Call(context.Background(), request)
+	assert.Equal(t, &StatusOK, resp.Status)
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"id": "7", "status": "success"},
+		{"name": "foo", "created": "1600000000"},
+	}, resp.Response)
+	assert.Equal(t, map[string]string{"name": "foo", "created": "1600000000"}, stored)
+
+	// Missing status defaults to success
+	returned = []map[string]string{{}, stored}
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"status": "success"},
+		{"name": "foo", "created": "1600000000"},
+	}, resp.Response)
+	_, ok := stored["status"]
+	assert.False(t, ok)
+
+	// Explicit status is passed through
+	returned = []map[string]string{{"status": "constraint"}}
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"status": "constraint"}}, resp.Response)
+
+	// No rows
+	returned = nil
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"status": "success"}}, resp.Response)
+}
+
+func TestMutableTablePluginInsertReservedColumns(t *testing.T) {
+	row := map[string]string{"id": "user-1", "status": "disabled"}
+	plugin := NewMutablePlugin(
+		"mock",
+		[]ColumnDefinition{TextColumn("id"), TextColumn("status")},
+		nil,
+		func(ctx context.Context, autoRowID bool, values []interface{}) ([]map[string]string, error) {
+			id, _ := AutoRowID(ctx)
+			return InsertedRow(id, row), nil
+		},
+		nil,
+		nil,
+	)
+
+	// Columns named id and status do not leak into the status for osquery
+	resp := plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "insert", "auto_rowid": "true", "json_value_array": `["user-1", "disabled"]`})
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"id": "1", "status": "success"},
+		{"id": "user-1", "status": "disabled"},
+	}, resp.Response)
+}
+
+func TestColumnarTablePlugin(t *testing.T) {
+	var StatusOK = osquery.ExtensionStatus{Code: 0, Message: "OK"}
+	values := [][]string{{"foo", "1"}, {"bar", "2"}}
+	plugin := NewColumnarPlugin(
+		"mock",
+		[]ColumnDefinition{TextColumn("text"), IntegerColumn("integer")},
+		func(ctx context.Context, queryCtx QueryContext) ([]string, [][]string, error) {
+			return []string{"text", "integer"}, values, nil
+		},
+	)
+	request := osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"}
+
+	status, columns, rows, handled := plugin.CallColumnar(context.Background(), request)
+	assert.True(t, handled)
+	assert.Equal(t, StatusOK, status)
+	assert.Equal(t, []string{"text", "integer"}, columns)
+	assert.Equal(t, values, rows)
+
+	// Call falls back to building row maps
+	resp := plugin.Call(context.Background(), request)
+	assert.Equal(t, &StatusOK, resp.Status)
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"text": "foo", "integer": "1"},
+		{"text": "bar", "integer": "2"},
+	}, resp.Response)
+
+	// Other actions are not handled in columnar form
+	_, _, _, handled = plugin.CallColumnar(context.Background(), osquery.ExtensionPluginRequest{"action": "columns"})
+	assert.False(t, handled)
+
+	// Rows with the wrong number of values are rejected
+	values = [][]string{{"foo"}}
+	status, _, _, handled = plugin.CallColumnar(context.Background(), request)
+	assert.True(t, handled)
+	assert.Equal(t, int32(1), status.Code)
+	assert.Equal(t, "error generating table: row 0 has 1 values, expected 2", status.Message)
+	assert.Equal(t, int32(1), plugin.Call(context.Background(), request).Status.Code)
+}
+
+func TestNullColumns(t *testing.T) {
+	rows := []map[string]string{
+		{"text": "foo", "integer": "1"},
+		{"text": "", "integer": Null},
+	}
+	plugin := NewPlugin(
+		"mock",
+		[]ColumnDefinition{TextColumn("text"), IntegerColumn("integer")},
+		func(ctx context.Context, queryCtx QueryContext) ([]map[string]string, error) {
+			return rows, nil
+		},
+	)
+	request := osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"}
+
+	resp := plugin.Call(context.Background(), request)
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"text": "foo", "integer": "1"},
+		{"text": ""},
+	}, resp.Response)
+	// The rows of the plugin are left untouched
+	assert.Equal(t, Null, rows[1]["integer"])
+
+	columnar := NewColumnarPlugin(
+		"mock",
+		[]ColumnDefinition{TextColumn("text"), IntegerColumn("integer")},
+		func(ctx context.Context, queryCtx QueryContext) ([]string, [][]string, error) {
+			return []string{"text", "integer"}, [][]string{{Null, "1"}}, nil
+		},
+	)
+	resp = columnar.Call(context.Background(), request)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"integer": "1"}}, resp.Response)
+}
+
+func TestColumnDescriptions(t *testing.T) {
+	plugin := NewPlugin(
+		"mock",
+		[]ColumnDefinition{
+			TextColumnWithDescription("text", "Some text"),
+			IntegerColumnWithDescription("integer", "An integer", INDEX),
+			BigIntColumnWithDescription("big_int", "A big integer"),
+			DoubleColumnWithDescription("double", "A double"),
+			TextColumn("plain"),
+		},
+		nil,
+	)
+
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"id": "column", "name": "text", "type": "TEXT", "op": "0", "description": "Some text"},
+		{"id": "column", "name": "integer", "type": "INTEGER", "op": "1", "description": "An integer"},
+		{"id": "column", "name": "big_int", "type": "BIGINT", "op": "0", "description": "A big integer"},
+		{"id": "column", "name": "double", "type": "DOUBLE", "op": "0", "description": "A double"},
+		{"id": "column", "name": "plain", "type": "TEXT", "op": "0"},
+	}, plugin.Routes())
+}
+
+func TestColumnCollation(t *testing.T) {
+	plugin := NewPlugin(
+		"mock",
+		[]ColumnDefinition{
+			TextColumn("username").Collate(CollationNoCase),
+			TextColumnWithDescription("path", "File path", INDEX).Collate(ColumnCollation("RTRIM")),
+			TextColumn("plain"),
+		},
+		nil,
+	)
+
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"id": "column", "name": "username", "type": "TEXT", "op": "0", "collate": "NOCASE"},
+		{"id": "column", "name": "path", "type": "TEXT", "op": "1", "description": "File path", "collate": "RTRIM"},
+		{"id": "column", "name": "plain", "type": "TEXT", "op": "0"},
+	}, plugin.Routes())
+}
+
+func TestMutableTablePluginRoutes(t *testing.T) {
+	columns := []ColumnDefinition{TextColumn("text")}
+	generate := func(ctx context.Context, queryCtx QueryContext) ([]map[string]string, error) {
+		return nil, nil
+	}
+	insert := func(ctx context.Context, autoRowID bool, row []interface{}) ([]map[string]string, error) {
+		return nil, nil
+	}
+	del := func(ctx context.Context, rowID int64) error {
+		return nil
+	}
+
+	// Read-only tables do not advertise mutation
+	readOnly := NewPlugin("mock", columns, generate)
+	for _, route := range readOnly.Routes() {
+		assert.Equal(t, "column", route["id"])
+	}
+
+	mutable := NewMutablePlugin("mock", columns, generate, insert, nil, del)
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"id": "column", "name": "text", "type": "TEXT", "op": "0"},
+		{"id": "mutable", "insert": "1", "update": "0", "delete": "1"},
+	}, mutable.Routes())
+}
+
+func TestParseQueryContextLimit(t *testing.T) {
+	context, err := parseQueryContext(`{"constraints":[],"limit":10,"offset":"5"}`)
+	require.NoError(t, err)
+	require.NotNil(t, context.Limit)
+	assert.Equal(t, 10, *context.Limit)
+	assert.Equal(t, 5, context.Offset)
+
+	context, err = parseQueryContext(`{"constraints":[]}`)
+	require.NoError(t, err)
+	assert.Nil(t, context.Limit)
+	assert.Equal(t, 0, context.Offset)
+
+	_, err = parseQueryContext(`{"constraints":[],"limit":"ten"}`)
+	assert.Error(t, err)
+}
+
+func TestParseQueryContextColumns(t *testing.T) {
+	context, err := parseQueryContext(`{"constraints":[],"colsUsed":["path","sha256"],"colsUsedBitset":5}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"path", "sha256"}, context.Columns)
+	assert.True(t, context.WantsColumn("sha256"))
+	assert.False(t, context.WantsColumn("md5"))
+
+	// Every column is wanted when osquery does not supply the used columns
+	context, err = parseQueryContext(`{"constraints":[]}`)
+	require.NoError(t, err)
+	assert.Nil(t, context.Columns)
+	assert.True(t, context.WantsColumn("md5"))
+}
+
+func TestApplyLimit(t *testing.T) {
+	rows := []map[string]string{{"n": "0"}, {"n": "1"}, {"n": "2"}, {"n": "3"}}
+	limit := func(n int) *int { return &n }
+
+	var testCases = []struct {
+		limit    *int
+		offset   int
+		expected int
+	}{
+		{nil, 0, 4},
+		{nil, 2, 4},
+		{limit(0), 0, 0},
+		{limit(2), 0, 2},
+		{limit(2), 1, 3},
+		{limit(10), 0, 4},
+		{limit(3), 3, 4},
+		{limit(-1), 0, 4},
+	}
+	for _, tt := range testCases {
+		t.Run("", func(t *testing.T) {
+			qc := QueryContext{Limit: tt.limit, Offset: tt.offset}
+			assert.Equal(t, rows[:tt.expected], qc.ApplyLimit(rows))
+		})
+	}
+}
+
+func TestMutableTablePluginRowErrors(t *testing.T) {
+	var StatusOK = osquery.ExtensionStatus{Code: 0, Message: "OK"}
+	var writeErr error
+	plugin := NewMutablePlugin(
+		"mock",
+		[]ColumnDefinition{TextColumn("name")},
+		func(ctx context.Context, queryCtx QueryContext) ([]map[string]string, error) {
+			return nil, nil
+		},
+		func(ctx context.Context, autoRowID bool, row []interface{}) ([]map[string]string, error) {
+			return nil, writeErr
+		},
+		func(ctx context.Context, rowID int64, row []interface{}) error {
+			return writeErr
+		},
+		func(ctx context.Context, rowID int64) error {
+			return writeErr
+		},
+	)
+
+	requests := []osquery.ExtensionPluginRequest{
+		{"action": "insert", "auto_rowid": "true", "json_value_array": `["foo"]`},
+		{"action": "update", "id": "1", "json_value_array": `["foo"]`},
+		{"action": "delete", "id": "1"},
+	}
+	for _, request := range requests {
+		t.Run(request["action"], func(t *testing.T) {
+			writeErr = &RowError{Status: RowConstraint, Message: "duplicate name"}
+			resp := plugin.Call(context.Background(), request)
+			assert.Equal(t, &StatusOK, resp.Status)
+			assert.Equal(t, osquery.ExtensionPluginResponse{{"status": "constraint", "message": "duplicate name"}}, resp.Response)
+
+			writeErr = fmt.Errorf("wrapped: %w", &RowError{Status: RowReadOnly})
+			resp = plugin.Call(context.Background(), request)
+			assert.Equal(t, &StatusOK, resp.Status)
+			assert.Equal(t, osquery.ExtensionPluginResponse{{"status": "readonly"}}, resp.Response)
+
+			writeErr = errors.New("backend down")
+			resp = plugin.Call(context.Background(), request)
+			assert.Equal(t, int32(1), resp.Status.Code)
+		})
+	}
+
+	assert.Equal(t, "failure: bad row", (&RowError{Status: RowFailure, Message: "bad row"}).Error())
+}
+
+func TestMutableTablePluginAutoID(t *testing.T) {
+	var returned []map[string]string
+	var assigned []int64
+	insert := func(ctx context.Context, autoRowID bool, row []interface{}) ([]map[string]string, error) {
+		if id, ok := AutoRowID(ctx); ok {
+			assigned = append(assigned, id)
+		}
+		return returned, nil
+	}
+	request := osquery.ExtensionPluginRequest{"action": "insert", "auto_rowid": "true", "json_value_array": `["foo"]`}
+
+	// Default counter
+	plugin := NewMutablePlugin("mock", []ColumnDefinition{TextColumn("name")}, nil, insert, nil, nil)
+	for _, expected := range []string{"1", "2"} {
+		resp := plugin.Call(context.Background(), request)
+		assert.Equal(t, osquery.ExtensionPluginResponse{{"id": expected, "status": "success"}}, resp.Response)
+	}
+	assert.Equal(t, []int64{1, 2}, assigned)
+
+	// The ID returned by the plugin wins, and rejected rows get no ID
+	returned = InsertedRow(42, map[string]string{"name": "foo"})
+	resp := plugin.Call(context.Background(), request)
+	assert.Equal(t, "42", resp.Response[0]["id"])
+	returned = []map[string]string{{"status": "constraint"}}
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"status": "constraint"}}, resp.Response)
+
+	// No ID is assigned when osquery supplies the row ID
+	assigned = nil
+	returned = nil
+	request["auto_rowid"] = "false"
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"status": "success"}}, resp.Response)
+	assert.Empty(t, assigned)
+
+	// Custom generator
+	request["auto_rowid"] = "true"
+	plugin = NewMutablePlugin("mock", []ColumnDefinition{TextColumn("name")}, nil, insert, nil, nil,
+		AutoID(func() int64 { return 1000 }))
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"id": "1000", "status": "success"}}, resp.Response)
+	assert.Equal(t, []int64{1000}, assigned)
+}
+
+func TestInsertNumberRoundTrip(t *testing.T) {
+	var StatusOK = osquery.ExtensionStatus{Code: 0, Message: "OK"}
+	var stored map[string]string
+	insert := func(ctx context.Context, autoRowID bool, row []interface{}) ([]map[string]string, error) {
+		stored = map[string]string{}
+		for i, name := range []string{"min", "max", "i", "d", "t"} {
+			value, err := FormatValue(row[i])
+			if err != nil {
+				return nil, err
+			}
+			stored[name] = value
+		}
+		return nil, nil
+	}
+	columns := []ColumnDefinition{BigIntColumn("min"), BigIntColumn("max"), IntegerColumn("i"), DoubleColumn("d"), TextColumn("t")}
+	request := osquery.ExtensionPluginRequest{
+		"action":           "insert",
+		"auto_rowid":       "false",
+		"json_value_array": `[-9223372036854775808, 9223372036854775807, -12345, -0.000001234, "x"]`,
+	}
+	expected := map[string]string{
+		"min": strconv.FormatInt(math.MinInt64, 10),
+		"max": strconv.FormatInt(math.MaxInt64, 10),
+		"i":   "-12345",
+		"d":   "-0.000001234",
+		"t":   "x",
+	}
+
+	plugin := NewMutablePlugin("numbers", columns, nil, insert, nil, nil, UseNumber())
+	resp := plugin.Call(context.Background(), request)
+	assert.Equal(t, &StatusOK, resp.Status)
+	assert.Equal(t, expected, stored)
+
+	// Without UseNumber, the largest BIGINT values are rounded to the nearest
+	// float64 and formatted in exponent form
+	plugin = NewMutablePlugin("numbers", columns, nil, insert, nil, nil)
+	resp = plugin.Call(context.Background(), request)
+	assert.Equal(t, &StatusOK, resp.Status)
+	assert.Equal(t, "-9.223372036854776e+18", stored["min"])
+	assert.Equal(t, "-12345", stored["i"])
+	assert.Equal(t, "-1.234e-06", stored["d"])
+}
+
+func TestMutablePluginNilCallbacks(t *testing.T) {
+	insertOnly := NewMutablePlugin("insert_only", []ColumnDefinition{TextColumn("name")}, nil,
+		func(ctx context.Context, autoRowID bool, row []interface{}) ([]map[string]string, error) {
+			return nil, nil
+		}, nil, nil)
+
+	routes := insertOnly.Routes()
+	assert.Equal(t, map[string]string{"id": "mutable", "insert": "1", "update": "0", "delete": "0"}, routes[len(routes)-1])
+
+	requests := []osquery.ExtensionPluginRequest{
+		{"action": "generate"},
+		{"action": "update", "id": "1", "json_value_array": `["foo"]`},
+		{"action": "delete", "id": "1"},
+	}
+	for _, request := range requests {
+		t.Run(request["action"], func(t *testing.T) {
+			resp := insertOnly.Call(context.Background(), request)
+			assert.Equal(t, int32(1), resp.Status.Code)
+			assert.Equal(t, "'"+request["action"]+"' not supported by table: insert_only", resp.Status.Message)
+		})
+	}
+
+	resp := insertOnly.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "insert", "auto_rowid": "true", "json_value_array": `["foo"]`})
+	assert.Equal(t, int32(0), resp.Status.Code)
+}
+
+func TestConstructorOptions(t *testing.T) {
+	columns := []ColumnDefinition{TextColumn("a")}
+	opts := []Option{CallTimeout(5 * time.Second), RequireAnyOf("a")}
+	plugins := map[string]*Plugin{
+		"columnar": NewColumnarPlugin("columnar", columns, func(ctx context.Context, queryContext QueryContext) ([]string, [][]string, error) {
+			return []string{"a"}, [][]string{{"1"}}, nil
+		}, opts...),
+		"paginated": NewPaginatedPlugin("paginated", columns, func(ctx context.Context, queryContext QueryContext, cursor string) ([]map[string]string, string, error) {
+			return []map[string]string{{"a": "1"}}, "", nil
+		}, 0, opts...),
+		"proxy":  NewHTTPProxyPlugin("proxy", columns, "http://127.0.0.1:0", nil, opts...),
+		"memory": NewMemoryTable("memory", columns, "", opts...).Plugin,
+	}
+
+	for name, plugin := range plugins {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, 5*time.Second, plugin.CallTimeout())
+			resp := plugin.Call(context.Background(), osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"})
+			assert.Equal(t, int32(1), resp.Status.Code)
+			assert.Contains(t, resp.Status.Message, "missing required constraint on one of the column(s): a")
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Package tablecommon provides the column sets shared by many tables, with the
+// helpers filling their values, so that these columns have the same types and
+// descriptions in every table. The types follow the osquery tables defining
+// the columns. Compose them with table.MergeColumns:
+//
+//	columns, err := table.MergeColumns(
+//		tablecommon.ProcessColumns(),
+//		[]table.ColumnDefinition{table.TextColumn("socket")},
+//	)
+package tablecommon
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"github.com/Uptycs/basequery-go/plugin/table"
+)
+
+// ProcessColumns returns the columns identifying the process of a row, pid and
+// uid, as BIGINT like the osquery processes table.
+func ProcessColumns() []table.ColumnDefinition {
+	return []table.ColumnDefinition{
+		table.BigIntColumnWithDescription("pid", "Process (or thread) ID"),
+		table.BigIntColumnWithDescription("uid", "Unsigned user ID"),
+	}
+}
+
+// FillProcess sets the values of the ProcessColumns in row.
+func FillProcess(row map[string]string, pid int64, uid int64) {
+	row["pid"] = strconv.FormatInt(pid, 10)
+	row["uid"] = strconv.FormatInt(uid, 10)
+}
+
+// FileColumns returns the columns identifying the file of a row, path,
+// directory and filename, as TEXT like the osquery file table.
+func FileColumns() []table.ColumnDefinition {
+	return []table.ColumnDefinition{
+		table.TextColumnWithDescription("path", "Absolute file path"),
+		table.TextColumnWithDescription("directory", "Directory of file(s)"),
+		table.TextColumnWithDescription("filename", "Name portion of file path"),
+	}
+}
+
+// FillFile sets the values of the FileColumns in row, the directory and
+// filename being taken from path.
+func FillFile(row map[string]string, path string) {
+	row["path"] = path
+	row["directory"] = filepath.Dir(path)
+	row["filename"] = filepath.Base(path)
+}
+
+// HostColumns returns the hostname column, as TEXT like the osquery
+// system_info table.
+func HostColumns() []table.ColumnDefinition {
+	return []table.ColumnDefinition{
+		table.TextColumnWithDescription("hostname", "Network hostname including domain"),
+	}
+}
+
+// FillHost sets the values of the HostColumns in row.
+func FillHost(row map[string]string, hostname string) {
+	row["hostname"] = hostname
+}
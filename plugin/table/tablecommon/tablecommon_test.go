@@ -0,0 +1,31 @@
+package tablecommon
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnSets(t *testing.T) {
+	columns, err := table.MergeColumns(ProcessColumns(), FileColumns(), HostColumns())
+	require.NoError(t, err)
+
+	row := map[string]string{}
+	FillProcess(row, 42, 1000)
+	FillFile(row, filepath.Join("var", "log", "syslog"))
+	FillHost(row, "host.example.com")
+
+	// Every column is filled, and only those
+	assert.Len(t, row, len(columns))
+	for _, column := range columns {
+		assert.Contains(t, row, column.Name)
+	}
+	assert.Equal(t, "42", row["pid"])
+	assert.Equal(t, "1000", row["uid"])
+	assert.Equal(t, filepath.Join("var", "log"), row["directory"])
+	assert.Equal(t, "syslog", row["filename"])
+	assert.Equal(t, "host.example.com", row["hostname"])
+}
@@ -0,0 +1,101 @@
+// Package tabletest provides helpers for testing table plugins without
+// running osquery.
+package tabletest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunConformance drives the plugin through the actions osquery uses, as
+// subtests of t: columns and generate for every table and, for mutable tables,
+// the insert, update and delete actions advertised in the routes. sampleRow
+// holds the values inserted and updated, in the order of the table columns,
+// as osquery would send them. The status of every response is checked, as
+// well as the shape of the columns and generated rows.
+func RunConformance(t *testing.T, plugin *table.Plugin, sampleRow []interface{}) {
+	ctx := context.Background()
+	columns := map[string]bool{}
+	mutable := map[string]string{}
+
+	t.Run("columns", func(t *testing.T) {
+		resp := plugin.Call(ctx, osquery.ExtensionPluginRequest{"action": "columns"})
+		requireOK(t, resp)
+		for _, route := range resp.Response {
+			switch route["id"] {
+			case "column":
+				assert.NotEmpty(t, route["name"], "column without name")
+				assert.NotEmpty(t, route["type"], "column %s without type", route["name"])
+				assert.False(t, columns[route["name"]], "duplicate column %s", route["name"])
+				columns[route["name"]] = true
+			case "mutable":
+				mutable = route
+			}
+		}
+		require.NotEmpty(t, columns, "table has no columns")
+	})
+
+	t.Run("generate", func(t *testing.T) {
+		resp := plugin.Call(ctx, osquery.ExtensionPluginRequest{"action": "generate", "context": "{}"})
+		requireOK(t, resp)
+		for i, row := range resp.Response {
+			for column := range row {
+				assert.True(t, columns[column], "row %d has unknown column %s", i, column)
+			}
+		}
+	})
+
+	if len(mutable) == 0 {
+		return
+	}
+
+	values, err := json.Marshal(sampleRow)
+	require.NoError(t, err, "marshaling sample row")
+	rowID := "0"
+
+	if mutable["insert"] == "1" {
+		t.Run("insert", func(t *testing.T) {
+			resp := plugin.Call(ctx, osquery.ExtensionPluginRequest{
+				"action":           "insert",
+				"auto_rowid":       "true",
+				"json_value_array": string(values),
+			})
+			requireOK(t, resp)
+			require.NotEmpty(t, resp.Response, "insert returned no result")
+			assert.Equal(t, "success", resp.Response[0]["status"])
+			if id, ok := resp.Response[0]["id"]; ok {
+				rowID = id
+			}
+		})
+	}
+
+	if mutable["update"] == "1" {
+		t.Run("update", func(t *testing.T) {
+			resp := plugin.Call(ctx, osquery.ExtensionPluginRequest{
+				"action":           "update",
+				"id":               rowID,
+				"json_value_array": string(values),
+			})
+			requireOK(t, resp)
+		})
+	}
+
+	if mutable["delete"] == "1" {
+		t.Run("delete", func(t *testing.T) {
+			resp := plugin.Call(ctx, osquery.ExtensionPluginRequest{"action": "delete", "id": rowID})
+			requireOK(t, resp)
+		})
+	}
+}
+
+func requireOK(t *testing.T, resp osquery.ExtensionResponse) {
+	t.Helper()
+	require.NotNil(t, resp.Status, "response without status")
+	require.Equal(t, int32(0), resp.Status.Code, "response status: %s", resp.Status.Message)
+}
@@ -0,0 +1,65 @@
+package tabletest
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunConformance(t *testing.T) {
+	columns := []table.ColumnDefinition{table.TextColumn("name"), table.IntegerColumn("size")}
+
+	t.Run("read-only", func(t *testing.T) {
+		RunConformance(t, table.NewPlugin("files", columns, func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return []map[string]string{{"name": "a", "size": "1"}}, nil
+		}), nil)
+	})
+
+	t.Run("mutable", func(t *testing.T) {
+		var mutex sync.Mutex
+		rows := map[int64]map[string]string{}
+		var inserted, updated, deleted bool
+
+		plugin := table.NewMutablePlugin("files", columns,
+			func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				result := []map[string]string{}
+				for _, row := range rows {
+					result = append(result, row)
+				}
+				return result, nil
+			},
+			func(ctx context.Context, autoRowID bool, values []interface{}) ([]map[string]string, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				inserted = true
+				id := int64(len(rows) + 1)
+				rows[id] = map[string]string{"name": values[0].(string), "size": strconv.Itoa(int(values[1].(float64)))}
+				return table.InsertedRow(id, rows[id]), nil
+			},
+			func(ctx context.Context, rowID int64, values []interface{}) error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				updated = rows[rowID] != nil
+				return nil
+			},
+			func(ctx context.Context, rowID int64) error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				deleted = rows[rowID] != nil
+				delete(rows, rowID)
+				return nil
+			},
+		)
+
+		RunConformance(t, plugin, []interface{}{"b", 2})
+		assert.True(t, inserted)
+		assert.True(t, updated)
+		assert.True(t, deleted)
+	})
+}
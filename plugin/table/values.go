@@ -0,0 +1,83 @@
+package table
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Uptycs/basequery-go/internal/null"
+	"github.com/pkg/errors"
+)
+
+// Null is the value of a column that is SQL NULL rather than an empty string.
+// osquery returns NULL for the columns missing from a row, so the columns set
+// to Null are left out of the rows sent to osquery. Leaving the column out of
+// the row has the same effect; Null is for tables that always fill every
+// column, including columnar tables which cannot leave columns out.
+const Null = null.Value
+
+// UnixTime formats the time as unix seconds, for use in BIGINT columns. The
+// zero time is formatted as "0", which osquery tables use for unknown times.
+func UnixTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// UnixTimeMilli formats the time as unix milliseconds. The zero time is
+// formatted as "0".
+func UnixTimeMilli(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// UnixTimeNano formats the time as unix nanoseconds. The zero time is
+// formatted as "0". The result is undefined for times that cannot be
+// represented in nanoseconds (before 1678 or after 2262).
+func UnixTimeNano(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// FormatDouble formats the value for DOUBLE columns, using the fewest digits
+// needed to parse it back to the same value. SQLite has no representation for
+// NaN and infinities, so they return an error.
+func FormatDouble(v float64) (string, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", errors.Errorf("cannot represent %v as a DOUBLE", v)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64), nil
+}
+
+// FormatValue formats a value of a row passed to an InsertFunc or UpdateFunc
+// as the string expected for its column. Integral numbers keep all their
+// digits if the table uses the UseNumber option. Nulls are formatted as empty
+// strings.
+func FormatValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case json.Number:
+		return v.String(), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return strconv.FormatInt(int64(v), 10), nil
+		}
+		return FormatDouble(v)
+	default:
+		return "", errors.Errorf("cannot format type %T", v)
+	}
+}
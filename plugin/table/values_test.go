@@ -0,0 +1,87 @@
+package table
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixTime(t *testing.T) {
+	var testCases = []struct {
+		time  time.Time
+		sec   string
+		milli string
+		nano  string
+	}{
+		{time.Time{}, "0", "0", "0"},
+		{time.Unix(0, 0), "0", "0", "0"},
+		{time.Unix(1600000000, 123456789), "1600000000", "1600000000123", "1600000000123456789"},
+		{time.Unix(-86400, 0), "-86400", "-86400000", "-86400000000000"},
+		{time.Date(1969, 12, 31, 23, 59, 59, 500000000, time.UTC), "-1", "-500", "-500000000"},
+	}
+
+	for _, tt := range testCases {
+		t.Run("", func(t *testing.T) {
+			assert.Equal(t, tt.sec, UnixTime(tt.time))
+			assert.Equal(t, tt.milli, UnixTimeMilli(tt.time))
+			assert.Equal(t, tt.nano, UnixTimeNano(tt.time))
+		})
+	}
+}
+
+func TestFormatDouble(t *testing.T) {
+	var testCases = []struct {
+		value    float64
+		expected string
+	}{
+		{0, "0"},
+		{-3.14159, "-3.14159"},
+		{-0.000001234, "-1.234e-06"},
+		{1e21, "1e+21"},
+		{math.MaxFloat64, "1.7976931348623157e+308"},
+	}
+	for _, tt := range testCases {
+		formatted, err := FormatDouble(tt.value)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, formatted)
+		parsed, err := strconv.ParseFloat(formatted, 64)
+		require.NoError(t, err)
+		assert.Equal(t, tt.value, parsed)
+	}
+
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		_, err := FormatDouble(value)
+		assert.Error(t, err)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	var testCases = []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, ""},
+		{"text", "text"},
+		{true, "1"},
+		{false, "0"},
+		{float64(-12345678900), "-12345678900"},
+		{-2.5, "-2.5"},
+		{json.Number("9223372036854775807"), "9223372036854775807"},
+		{json.Number("-9223372036854775808"), "-9223372036854775808"},
+	}
+	for _, tt := range testCases {
+		formatted, err := FormatValue(tt.value)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, formatted)
+	}
+
+	_, err := FormatValue(math.NaN())
+	assert.Error(t, err)
+	_, err = FormatValue([]interface{}{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,235 @@
+package osquery
+
+import (
+	"context"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/internal/null"
+	"github.com/Uptycs/basequery-go/internal/stream"
+	"github.com/pkg/errors"
+)
+
+// nullValue is the value of the SQL NULL columns of table plugins (table.Null).
+// These columns are left out of the rows sent to osquery, which returns NULL
+// for missing columns.
+const nullValue = null.Value
+
+// callResult holds the outcome of a plugin call. Results of columnar plugins
+// are stored as parallel column/value slices instead of row maps, and results
+// of streaming plugins as the stream writing the rows.
+type callResult struct {
+	status   *osquery.ExtensionStatus
+	rows     osquery.ExtensionPluginResponse
+	columns  []string
+	values   [][]string
+	columnar bool
+	stream   *rowStream
+}
+
+// rowCount returns the number of result rows.
+func (r *callResult) rowCount() int {
+	if r.stream != nil {
+		return r.stream.count
+	}
+	if r.columnar {
+		return len(r.values)
+	}
+	return len(r.rows)
+}
+
+// extensionResponse converts the result to the thrift response, building the
+// row maps for columnar results. Streamed results are collected first.
+func (r *callResult) extensionResponse(ctx context.Context) *osquery.ExtensionResponse {
+	if !r.columnar {
+		return &osquery.ExtensionResponse{Status: r.status, Response: r.rows}
+	}
+
+	values := r.values
+	if r.stream != nil {
+		var err error
+		if values, err = stream.Collect(ctx, r.columns, r.stream.count, r.stream.write); err != nil {
+			return &osquery.ExtensionResponse{Status: &osquery.ExtensionStatus{Code: 1, Message: "error streaming table: " + err.Error()}}
+		}
+	}
+	rows := make(osquery.ExtensionPluginResponse, 0, len(values))
+	for _, vals := range values {
+		row := make(map[string]string, len(r.columns))
+		for i, column := range r.columns {
+			if vals[i] != nullValue {
+				row[column] = vals[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return &osquery.ExtensionResponse{Status: r.status, Response: rows}
+}
+
+// write serializes the result as the thrift "call" result struct. Columnar
+// results are written directly from the column/value slices, and streamed
+// results as the plugin writes them.
+func (r *callResult) write(ctx context.Context, oprot thrift.TProtocol) error {
+	if r.stream != nil {
+		return r.writeStream(ctx, oprot)
+	}
+	if !r.columnar {
+		result := osquery.ExtensionCallResult{Success: r.extensionResponse(ctx)}
+		return result.Write(ctx, oprot)
+	}
+
+	if err := oprot.WriteStructBegin(ctx, "call_result"); err != nil {
+		return thrift.PrependError("write struct begin error: ", err)
+	}
+	if err := oprot.WriteFieldBegin(ctx, "success", thrift.STRUCT, 0); err != nil {
+		return thrift.PrependError("write field begin error 0:success: ", err)
+	}
+	if err := oprot.WriteStructBegin(ctx, "ExtensionResponse"); err != nil {
+		return thrift.PrependError("write struct begin error: ", err)
+	}
+
+	if r.status != nil {
+		if err := oprot.WriteFieldBegin(ctx, "status", thrift.STRUCT, 1); err != nil {
+			return thrift.PrependError("write field begin error 1:status: ", err)
+		}
+		if err := r.status.Write(ctx, oprot); err != nil {
+			return thrift.PrependError("error writing status: ", err)
+		}
+		if err := oprot.WriteFieldEnd(ctx); err != nil {
+			return thrift.PrependError("write field end error 1:status: ", err)
+		}
+	}
+
+	if err := oprot.WriteFieldBegin(ctx, "response", thrift.LIST, 2); err != nil {
+		return thrift.PrependError("write field begin error 2:response: ", err)
+	}
+	if err := oprot.WriteListBegin(ctx, thrift.MAP, len(r.values)); err != nil {
+		return thrift.PrependError("error writing list begin: ", err)
+	}
+	for _, values := range r.values {
+		if err := writeRowMap(ctx, oprot, r.columns, values); err != nil {
+			return err
+		}
+	}
+	if err := oprot.WriteListEnd(ctx); err != nil {
+		return thrift.PrependError("error writing list end: ", err)
+	}
+	if err := oprot.WriteFieldEnd(ctx); err != nil {
+		return thrift.PrependError("write field end error 2:response: ", err)
+	}
+
+	if err := oprot.WriteFieldStop(ctx); err != nil {
+		return thrift.PrependError("write field stop error: ", err)
+	}
+	if err := oprot.WriteStructEnd(ctx); err != nil {
+		return thrift.PrependError("write struct end error: ", err)
+	}
+	if err := oprot.WriteFieldEnd(ctx); err != nil {
+		return thrift.PrependError("write field end error 0:success: ", err)
+	}
+	if err := oprot.WriteFieldStop(ctx); err != nil {
+		return thrift.PrependError("write field stop error: ", err)
+	}
+	if err := oprot.WriteStructEnd(ctx); err != nil {
+		return thrift.PrependError("write struct end error: ", err)
+	}
+	return nil
+}
+
+// writeRowMap writes a columnar row as a thrift map, leaving out the Null
+// values.
+func writeRowMap(ctx context.Context, oprot thrift.TProtocol, columns []string, values []string) error {
+	size := len(columns)
+	for _, value := range values {
+		if value == nullValue {
+			size--
+		}
+	}
+	if err := oprot.WriteMapBegin(ctx, thrift.STRING, thrift.STRING, size); err != nil {
+		return thrift.PrependError("error writing map begin: ", err)
+	}
+	for i, column := range columns {
+		if values[i] == nullValue {
+			continue
+		}
+		if err := oprot.WriteString(ctx, column); err != nil {
+			return thrift.PrependError("error writing column name: ", err)
+		}
+		if err := oprot.WriteString(ctx, values[i]); err != nil {
+			return thrift.PrependError("error writing column value: ", err)
+		}
+	}
+	if err := oprot.WriteMapEnd(ctx); err != nil {
+		return thrift.PrependError("error writing map end: ", err)
+	}
+	return nil
+}
+
+// callProcessor replaces the generated thrift processor for "call" so that
+// results of columnar plugins can be serialized without intermediate maps.
+type callProcessor struct {
+	server *ExtensionManagerServer
+}
+
+// Process reads the call arguments, dispatches the call and writes the reply.
+// It mirrors the generated processor, including the connectivity check.
+func (p *callProcessor) Process(ctx context.Context, seqID int32, iprot, oprot thrift.TProtocol) (bool, thrift.TException) {
+	args := osquery.ExtensionCallArgs{}
+	if err := args.Read(ctx, iprot); err != nil {
+		iprot.ReadMessageEnd(ctx)
+		x := thrift.NewTApplicationException(thrift.PROTOCOL_ERROR, err.Error())
+		oprot.WriteMessageBegin(ctx, "call", thrift.EXCEPTION, seqID)
+		x.Write(ctx, oprot)
+		oprot.WriteMessageEnd(ctx)
+		oprot.Flush(ctx)
+		return false, thrift.WrapTException(err)
+	}
+	iprot.ReadMessageEnd(ctx)
+
+	tickerCancel := func() {}
+	if thrift.ServerConnectivityCheckInterval > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		var tickerCtx context.Context
+		tickerCtx, tickerCancel = context.WithCancel(context.Background())
+		defer tickerCancel()
+		go func(ctx context.Context, cancel context.CancelFunc) {
+			ticker := time.NewTicker(thrift.ServerConnectivityCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if !iprot.Transport().IsOpen() {
+						cancel()
+						return
+					}
+				}
+			}
+		}(tickerCtx, cancel)
+	}
+
+	result := p.server.call(ctx, args.Registry, args.Item, args.Request)
+	tickerCancel()
+
+	var err error
+	if err2 := oprot.WriteMessageBegin(ctx, "call", thrift.REPLY, seqID); err2 != nil {
+		err = err2
+	}
+	if err2 := result.write(ctx, oprot); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 := oprot.WriteMessageEnd(ctx); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 := oprot.Flush(ctx); err == nil && err2 != nil {
+		err = err2
+	}
+	if err != nil {
+		return false, thrift.WrapTException(errors.Wrap(err, "writing call reply"))
+	}
+	return true, nil
+}
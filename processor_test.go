@@ -0,0 +1,136 @@
+package osquery
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBenchmarkServer(rows int) *ExtensionManagerServer {
+	columns := []table.ColumnDefinition{
+		table.TextColumn("name"),
+		table.IntegerColumn("pid"),
+		table.TextColumn("path"),
+		table.BigIntColumn("start_time"),
+	}
+	pids := make([]string, 0, rows)
+	for i := 0; i < rows; i++ {
+		pids = append(pids, strconv.Itoa(i))
+	}
+
+	// The tables build their results on every generate, like a real table would
+	server := &ExtensionManagerServer{registry: map[string]map[string]Plugin{"table": {}}}
+	server.RegisterPlugin(
+		table.NewPlugin("maps", columns, func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			results := make([]map[string]string, 0, len(pids))
+			for _, pid := range pids {
+				results = append(results, map[string]string{"name": "proc", "pid": pid, "path": "/usr/bin/proc", "start_time": "1600000000"})
+			}
+			return results, nil
+		}),
+		table.NewColumnarPlugin("columnar", columns, func(ctx context.Context, queryContext table.QueryContext) ([]string, [][]string, error) {
+			values := make([][]string, 0, len(pids))
+			for _, pid := range pids {
+				values = append(values, []string{"proc", pid, "/usr/bin/proc", "1600000000"})
+			}
+			return []string{"name", "pid", "path", "start_time"}, values, nil
+		}),
+		table.NewStreamingPlugin("stream", columns, func(ctx context.Context, queryContext table.QueryContext) (int, table.StreamFunc, error) {
+			return len(pids), func(ctx context.Context, writeRow func([]string) error) error {
+				values := []string{"proc", "", "/usr/bin/proc", "1600000000"}
+				for _, pid := range pids {
+					values[1] = pid
+					if err := writeRow(values); err != nil {
+						return err
+					}
+				}
+				return nil
+			}, nil
+		}),
+	)
+	return server
+}
+
+func writeCall(server *ExtensionManagerServer, item string, trans *thrift.TMemoryBuffer) error {
+	oprot := thrift.NewTBinaryProtocolConf(trans, &thrift.TConfiguration{})
+	result := server.call(context.Background(), "table", item, osquery.ExtensionPluginRequest{"action": "generate"})
+	return result.write(context.Background(), oprot)
+}
+
+func TestColumnarCallResult(t *testing.T) {
+	server := newBenchmarkServer(10)
+
+	readBack := func(item string) *osquery.ExtensionCallResult {
+		trans := thrift.NewTMemoryBuffer()
+		require.NoError(t, writeCall(server, item, trans))
+		result := osquery.NewExtensionCallResult()
+		require.NoError(t, result.Read(context.Background(), thrift.NewTBinaryProtocolConf(trans, &thrift.TConfiguration{})))
+		return result
+	}
+
+	maps := readBack("maps")
+	columnar := readBack("columnar")
+	assert.Equal(t, int32(0), columnar.Success.Status.Code)
+	assert.Len(t, columnar.Success.Response, 10)
+	assert.Equal(t, maps.Success, columnar.Success)
+	assert.Equal(t, maps.Success, readBack("stream").Success)
+
+	// Public Call builds row maps for columnar plugins
+	resp, err := server.Call(context.Background(), "table", "columnar", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+	assert.Equal(t, maps.Success, resp)
+	resp, err = server.Call(context.Background(), "table", "stream", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+	assert.Equal(t, maps.Success, resp)
+}
+
+func TestColumnarCallResultNulls(t *testing.T) {
+	assert.Equal(t, table.Null, nullValue)
+
+	result := &callResult{
+		status:   &osquery.ExtensionStatus{},
+		columns:  []string{"name", "pid"},
+		values:   [][]string{{"proc", table.Null}, {table.Null, "2"}},
+		columnar: true,
+	}
+	trans := thrift.NewTMemoryBuffer()
+	require.NoError(t, result.write(context.Background(), thrift.NewTBinaryProtocolConf(trans, &thrift.TConfiguration{})))
+	read := osquery.NewExtensionCallResult()
+	require.NoError(t, read.Read(context.Background(), thrift.NewTBinaryProtocolConf(trans, &thrift.TConfiguration{})))
+
+	expected := osquery.ExtensionPluginResponse{{"name": "proc"}, {"pid": "2"}}
+	assert.Equal(t, expected, read.Success.Response)
+	assert.Equal(t, expected, result.extensionResponse(context.Background()).Response)
+}
+
+func benchmarkCall(b *testing.B, item string) {
+	server := newBenchmarkServer(100000)
+	trans := thrift.NewTMemoryBuffer()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trans.Reset()
+		if err := writeCall(server, item, trans); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCallMapRows(b *testing.B) {
+	benchmarkCall(b, "maps")
+}
+
+func BenchmarkCallColumnarRows(b *testing.B) {
+	benchmarkCall(b, "columnar")
+}
+
+func BenchmarkCallStreamRows(b *testing.B) {
+	benchmarkCall(b, "stream")
+}
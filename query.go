@@ -0,0 +1,124 @@
+package osquery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// QuoteIdentifier quotes a table or column name for use in osquery SQL.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteString quotes a string literal for use in osquery SQL.
+func QuoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// whereOperators are the operators accepted by SelectBuilder.Where.
+var whereOperators = map[string]bool{
+	"=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+	"LIKE": true, "GLOB": true, "REGEXP": true,
+}
+
+// SelectBuilder builds a SELECT query on a single table, quoting the names and
+// values so that they cannot alter the query. It covers the queries extensions
+// usually run on osquery tables; write other SQL by hand with QuoteIdentifier
+// and QuoteString.
+//
+//	sql := osquery.Select("processes").Columns("pid", "name").Where("name", "=", name).Limit(10).SQL()
+type SelectBuilder struct {
+	table   string
+	columns []string
+	where   []string
+	limit   int
+}
+
+// Select starts a query on the table. All the columns are selected unless
+// Columns is called.
+func Select(table string) *SelectBuilder {
+	return &SelectBuilder{table: table}
+}
+
+// Columns adds columns to select.
+func (b *SelectBuilder) Columns(columns ...string) *SelectBuilder {
+	b.columns = append(b.columns, columns...)
+	return b
+}
+
+// Where adds a constraint on a column, joined to the others with AND. The op
+// is one of =, !=, <>, <, <=, >, >=, LIKE, GLOB or REGEXP; other operators
+// panic, as they are a programming error. The value is formatted as a number
+// for Go numbers, 1 or 0 for bools and a quoted string otherwise. A nil value
+// with = or != checks that the column IS NULL or IS NOT NULL.
+func (b *SelectBuilder) Where(column, op string, value interface{}) *SelectBuilder {
+	op = strings.ToUpper(op)
+	if !whereOperators[op] {
+		panic(fmt.Sprintf("unsupported SQL operator %q", op))
+	}
+	if value == nil {
+		switch op {
+		case "=":
+			op = "IS"
+		case "!=", "<>":
+			op = "IS NOT"
+		}
+	}
+	b.where = append(b.where, QuoteIdentifier(column)+" "+op+" "+sqlLiteral(value))
+	return b
+}
+
+// Limit sets the maximum number of rows returned. Zero (the default) means no
+// limit.
+func (b *SelectBuilder) Limit(n int) *SelectBuilder {
+	b.limit = n
+	return b
+}
+
+// SQL returns the query.
+func (b *SelectBuilder) SQL() string {
+	var sql strings.Builder
+	sql.WriteString("SELECT ")
+	if len(b.columns) == 0 {
+		sql.WriteString("*")
+	}
+	for i, column := range b.columns {
+		if i > 0 {
+			sql.WriteString(", ")
+		}
+		sql.WriteString(QuoteIdentifier(column))
+	}
+	sql.WriteString(" FROM ")
+	sql.WriteString(QuoteIdentifier(b.table))
+	if len(b.where) > 0 {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(strings.Join(b.where, " AND "))
+	}
+	if b.limit > 0 {
+		sql.WriteString(" LIMIT ")
+		sql.WriteString(strconv.Itoa(b.limit))
+	}
+	return sql.String()
+}
+
+func sqlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return QuoteString(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return QuoteString(fmt.Sprint(value))
+}
@@ -0,0 +1,31 @@
+package osquery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, `"name"`, QuoteIdentifier("name"))
+	assert.Equal(t, `"a""b"`, QuoteIdentifier(`a"b`))
+	assert.Equal(t, `'it''s'`, QuoteString("it's"))
+}
+
+func TestSelectBuilder(t *testing.T) {
+	assert.Equal(t, `SELECT * FROM "processes"`, Select("processes").SQL())
+
+	sql := Select("processes").
+		Columns("pid", "name").
+		Where("name", "=", "x'; DROP TABLE users; --").
+		Where("pid", ">", 100).
+		Where("path", "like", "/usr/%").
+		Limit(10).
+		SQL()
+	assert.Equal(t, `SELECT "pid", "name" FROM "processes" WHERE "name" = 'x''; DROP TABLE users; --' AND "pid" > 100 AND "path" LIKE '/usr/%' LIMIT 10`, sql)
+
+	sql = Select("t").Where("a", "=", true).Where("b", "!=", 1.5).Where("c", "=", nil).Where("d", "<>", nil).SQL()
+	assert.Equal(t, `SELECT * FROM "t" WHERE "a" = 1 AND "b" != 1.5 AND "c" IS NULL AND "d" IS NOT NULL`, sql)
+
+	assert.Panics(t, func() { Select("t").Where("a", "= 1 OR 1 =", 1) })
+}
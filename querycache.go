@@ -0,0 +1,83 @@
+package osquery
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ClientQueryCache makes QueryRows (and the helpers using it) cache the rows
+// returned for each SQL string for ttl, keeping at most maxEntries queries.
+// The oldest queries are evicted first when the cache is full. Failed queries
+// are not cached. Use QueryRowsBypassCache for queries that need fresh data.
+// The cached rows are shared between the callers, and must not be modified.
+func ClientQueryCache(ttl time.Duration, maxEntries int) ClientOption {
+	return func(c *ExtensionManagerClient) {
+		if ttl > 0 && maxEntries > 0 {
+			c.queryCache = newQueryCache(ttl, maxEntries)
+		} else {
+			c.queryCache = nil
+		}
+	}
+}
+
+type queryCacheEntry struct {
+	sql     string
+	rows    []map[string]string
+	expires time.Time
+}
+
+// queryCache holds the results of queries, in insertion order.
+type queryCache struct {
+	ttl        time.Duration
+	maxEntries int
+	mutex      sync.Mutex
+	entries    map[string]*list.Element
+	order      *list.List
+}
+
+func newQueryCache(ttl time.Duration, maxEntries int) *queryCache {
+	return &queryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+// get returns the cached rows of the query, if they have not expired.
+func (q *queryCache) get(sql string) ([]map[string]string, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	elem, ok := q.entries[sql]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*queryCacheEntry)
+	if time.Now().After(entry.expires) {
+		q.remove(elem)
+		return nil, false
+	}
+	return entry.rows, true
+}
+
+// put caches the rows of the query, evicting the oldest queries if needed.
+func (q *queryCache) put(sql string, rows []map[string]string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if elem, ok := q.entries[sql]; ok {
+		q.remove(elem)
+	}
+	for q.order.Len() >= q.maxEntries {
+		q.remove(q.order.Front())
+	}
+	entry := &queryCacheEntry{sql: sql, rows: rows, expires: time.Now().Add(q.ttl)}
+	q.entries[sql] = q.order.PushBack(entry)
+}
+
+func (q *queryCache) remove(elem *list.Element) {
+	q.order.Remove(elem)
+	delete(q.entries, elem.Value.(*queryCacheEntry).sql)
+}
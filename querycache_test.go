@@ -0,0 +1,90 @@
+package osquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCachingClient(ttl time.Duration, maxEntries int) (*ExtensionManagerClient, map[string]int) {
+	queries := map[string]int{}
+	mock := mock.NewExtensionManager()
+	mock.QueryFunc = func(ctx context.Context, sql string) (*osquery.ExtensionResponse, error) {
+		queries[sql]++
+		if sql == "bad" {
+			return &osquery.ExtensionResponse{Status: &osquery.ExtensionStatus{Code: 1, Message: "syntax error"}}, nil
+		}
+		return &osquery.ExtensionResponse{
+			Status:   &osquery.ExtensionStatus{Code: 0},
+			Response: []map[string]string{{"sql": sql}},
+		}, nil
+	}
+	client := &ExtensionManagerClient{Client: mock}
+	ClientQueryCache(ttl, maxEntries)(client)
+	return client, queries
+}
+
+func TestQueryCache(t *testing.T) {
+	client, queries := newCachingClient(time.Hour, 10)
+
+	for i := 0; i < 3; i++ {
+		rows, err := client.QueryRows("select 1")
+		require.NoError(t, err)
+		assert.Equal(t, []map[string]string{{"sql": "select 1"}}, rows)
+	}
+	assert.Equal(t, 1, queries["select 1"])
+
+	row, err := client.QueryRow("select 1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"sql": "select 1"}, row)
+	assert.Equal(t, 1, queries["select 1"])
+
+	// Bypassing the cache always queries osquery
+	_, err = client.QueryRowsBypassCache("select 1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, queries["select 1"])
+
+	// Errors are not cached
+	_, err = client.QueryRows("bad")
+	assert.Error(t, err)
+	_, err = client.QueryRows("bad")
+	assert.Error(t, err)
+	assert.Equal(t, 2, queries["bad"])
+}
+
+func TestQueryCacheExpiry(t *testing.T) {
+	client, queries := newCachingClient(20*time.Millisecond, 10)
+
+	_, err := client.QueryRows("select 1")
+	require.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+	_, err = client.QueryRows("select 1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, queries["select 1"])
+}
+
+func TestQueryCacheEviction(t *testing.T) {
+	client, queries := newCachingClient(time.Hour, 2)
+
+	for _, sql := range []string{"select 1", "select 2", "select 3", "select 2", "select 1"} {
+		_, err := client.QueryRows(sql)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, map[string]int{"select 1": 2, "select 2": 1, "select 3": 1}, queries)
+}
+
+func TestQueryCacheDisabled(t *testing.T) {
+	client, queries := newCachingClient(0, 10)
+	assert.Nil(t, client.queryCache)
+
+	_, err := client.QueryRows("select 1")
+	require.NoError(t, err)
+	_, err = client.QueryRows("select 1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, queries["select 1"])
+}
@@ -0,0 +1,80 @@
+package osquery
+
+import (
+	"context"
+	"time"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/pkg/errors"
+)
+
+// ServerWaitReady holds the plugin calls until MarkReady is called, eg. for a
+// table backed by a cache that is slow to warm up. osquery has no readiness
+// notification: Start registers the extension (which makes its tables visible
+// to queries) and then opens the extension socket, and osquery routes queries
+// as soon as it can connect. The held calls wait for MarkReady, or fail when
+// their connection is closed.
+func ServerWaitReady() ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.ready = make(chan struct{})
+	}
+}
+
+// MarkReady releases the plugin calls held since the server started, see
+// ServerWaitReady. It can be called at any time, including before Start, and
+// more than once.
+func (s *ExtensionManagerServer) MarkReady() {
+	if s.ready != nil {
+		s.readyOnce.Do(func() { close(s.ready) })
+	}
+}
+
+// waitReady waits for MarkReady, returning the failure status of the call if
+// ctx is done first.
+func (s *ExtensionManagerServer) waitReady(ctx context.Context) *osquery.ExtensionStatus {
+	if s.ready == nil {
+		return nil
+	}
+	select {
+	case <-s.ready:
+		return nil
+	case <-ctx.Done():
+		return &osquery.ExtensionStatus{
+			Code:    1,
+			Message: "Call cancelled waiting for the extension to be ready: " + ctx.Err().Error(),
+		}
+	}
+}
+
+// tablePollInterval is the delay between the queries of WaitTableReady.
+const tablePollInterval = 200 * time.Millisecond
+
+// WaitTableReady queries the table through the server's client until osquery
+// can query it, or ctx is done, eg. for integration tests starting osquery
+// with the extension. The table is queried with "SELECT 1 FROM <table> LIMIT
+// 0", which fails until osquery has registered the extension and its table.
+// The queries are not interrupted by ctx, so the wait can exceed its deadline
+// by the timeout of the client.
+func (s *ExtensionManagerServer) WaitTableReady(ctx context.Context, tableName string) error {
+	sql := "SELECT 1 FROM " + QuoteIdentifier(tableName) + " LIMIT 0"
+	ticker := time.NewTicker(tablePollInterval)
+	defer ticker.Stop()
+	for {
+		res, err := s.serverClient.Query(sql)
+		if err == nil {
+			if res.Status == nil {
+				err = errors.New("query returned nil status")
+			} else if res.Status.Code != 0 {
+				err = errors.Errorf("query returned error: %s", res.Status.Message)
+			} else {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "waiting for table %s (last error: %s)", tableName, err)
+		case <-ticker.C:
+		}
+	}
+}
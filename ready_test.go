@@ -0,0 +1,80 @@
+package osquery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerWaitReady(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerWaitReady()(server)
+	server.RegisterPlugin(table.NewPlugin("test", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return []map[string]string{{"a": "1"}}, nil
+		}))
+	request := osquery.ExtensionPluginRequest{"action": "generate"}
+
+	// Calls give up when their context is done before the server is ready
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	resp, err := server.Call(ctx, "table", "test", request)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), resp.Status.Code)
+
+	completed := make(chan *osquery.ExtensionResponse)
+	go func() {
+		resp, _ := server.Call(context.Background(), "table", "test", request)
+		completed <- resp
+	}()
+	select {
+	case <-completed:
+		t.Fatal("call completed before the server is ready")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	server.MarkReady()
+	server.MarkReady()
+	resp = <-completed
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Len(t, resp.Response, 1)
+}
+
+func TestWaitTableReady(t *testing.T) {
+	mock := NewMockExtensionManager()
+	var queries []string
+	mock.QueryFunc = func(sql string) (*osquery.ExtensionResponse, error) {
+		queries = append(queries, sql)
+		switch len(queries) {
+		case 1:
+			return nil, errors.New("connection refused")
+		case 2:
+			return &osquery.ExtensionResponse{Status: &osquery.ExtensionStatus{Code: 1, Message: "no such table: my_table"}}, nil
+		}
+		return &osquery.ExtensionResponse{Status: &osquery.ExtensionStatus{Code: 0, Message: "OK"}}, nil
+	}
+	server := newTestServer(mock, "")
+
+	require.NoError(t, server.WaitTableReady(context.Background(), "my_table"))
+	assert.Equal(t, []string{
+		`SELECT 1 FROM "my_table" LIMIT 0`,
+		`SELECT 1 FROM "my_table" LIMIT 0`,
+		`SELECT 1 FROM "my_table" LIMIT 0`,
+	}, queries)
+
+	// The last error is kept when the context is done
+	mock.QueryFunc = func(sql string) (*osquery.ExtensionResponse, error) {
+		return &osquery.ExtensionResponse{Status: &osquery.ExtensionStatus{Code: 1, Message: "no such table: my_table"}}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := server.WaitTableReady(ctx, "my_table")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Contains(t, err.Error(), "no such table: my_table")
+}
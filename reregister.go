@@ -0,0 +1,53 @@
+package osquery
+
+import (
+	"context"
+	"strings"
+)
+
+// ServerAutoReRegister makes the plugins registered after Start visible to
+// osquery right away, by re-registering the extension (see ReRegister) once
+// per RegisterPlugin call. By default, such plugins are only sent to osquery
+// by the next ReRegister, and a warning is logged if a logger is set (see
+// ServerLogger). RegisterPluginContext re-registers regardless, and reports
+// the failures.
+func ServerAutoReRegister(enabled bool) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.autoReRegister = enabled
+	}
+}
+
+// registeredLate handles the plugins registered after Start, which osquery
+// does not know about until the extension is registered again.
+func (s *ExtensionManagerServer) registeredLate(names []string) {
+	if !s.autoReRegister {
+		s.warnf("plugins %s registered after Start are not visible to osquery until ReRegister is called", strings.Join(names, ", "))
+		return
+	}
+	if err := s.ReRegister(); err != nil {
+		s.errorf("re-registering for plugins %s registered after Start: %v", strings.Join(names, ", "), err)
+		return
+	}
+	s.infof("re-registered for plugins %s registered after Start", strings.Join(names, ", "))
+}
+
+// RegisterPluginContext adds the plugins like RegisterPlugin. If the server is
+// started, the extension is then re-registered (see ReRegisterContext) for
+// osquery to see the plugins, giving up when the context is done, eg. for
+// extensions building their tables from an external service while osquery is
+// slow to accept the new registry.
+func (s *ExtensionManagerServer) RegisterPluginContext(ctx context.Context, plugins ...Plugin) error {
+	late := func() bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for _, plugin := range plugins {
+			s.addPlugin(plugin.Name(), plugin)
+		}
+		return s.started && !s.shutdown
+	}()
+
+	if !late {
+		return nil
+	}
+	return s.ReRegisterContext(ctx)
+}
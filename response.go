@@ -0,0 +1,27 @@
+package osquery
+
+import (
+	"github.com/Uptycs/basequery-go/gen/osquery"
+)
+
+// NewResponse builds the response of a plugin call, for plugins implementing
+// the Plugin interface directly. A nil err returns the rows with the OK status
+// (code 0). Otherwise the rows are dropped and the status is a failure (code 1)
+// with the error message.
+func NewResponse(rows []map[string]string, err error) osquery.ExtensionResponse {
+	status := NewStatus(err)
+	if err != nil {
+		return osquery.ExtensionResponse{Status: &status}
+	}
+	return osquery.ExtensionResponse{Status: &status, Response: rows}
+}
+
+// NewStatus builds the status of a call without rows, eg. for Plugin.Ping: OK
+// (code 0) for a nil err, and a failure (code 1) with the error message
+// otherwise.
+func NewStatus(err error) osquery.ExtensionStatus {
+	if err != nil {
+		return osquery.ExtensionStatus{Code: 1, Message: err.Error()}
+	}
+	return osquery.ExtensionStatus{Code: 0, Message: "OK"}
+}
@@ -0,0 +1,23 @@
+package osquery
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewResponse(t *testing.T) {
+	rows := []map[string]string{{"a": "1"}}
+	assert.Equal(t, osquery.ExtensionResponse{
+		Status:   &osquery.ExtensionStatus{Code: 0, Message: "OK"},
+		Response: rows,
+	}, NewResponse(rows, nil))
+	assert.Equal(t, osquery.ExtensionResponse{
+		Status: &osquery.ExtensionStatus{Code: 1, Message: "boom"},
+	}, NewResponse(rows, errors.New("boom")))
+
+	assert.Equal(t, osquery.ExtensionStatus{Code: 0, Message: "OK"}, NewStatus(nil))
+	assert.Equal(t, osquery.ExtensionStatus{Code: 1, Message: "boom"}, NewStatus(errors.New("boom")))
+}
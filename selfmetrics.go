@@ -0,0 +1,177 @@
+package osquery
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SelfMetricsTable is the name of the table registered by
+// RegisterSelfMetricsTable.
+const SelfMetricsTable = "osquery_extension_metrics"
+
+// RegisterSelfMetricsTable registers the osquery_extension_metrics table,
+// exposing the metrics of the plugin calls recorded for Prometheus, so that
+// they can be queried from osquery where Prometheus cannot scrape the
+// extension. Each row holds the metrics of a plugin action: the number of
+// calls and failed calls, the number of rows returned by the last call, and
+// the total duration of the calls. The metrics are recorded even if
+// ServerPrometheusPort is not set. The table fails the queries if the metrics
+// are recorded by a sink set with ServerMetricsSink.
+func (s *ExtensionManagerServer) RegisterSelfMetricsTable() {
+	s.mutex.Lock()
+	if s.metrics == nil {
+		// Only exposed to Prometheus if the server serves the metrics
+		var reg prometheus.Registerer = prometheus.NewRegistry()
+		if s.prometheusPort > 0 {
+			reg = prometheus.DefaultRegisterer
+		}
+		s.metrics = newPrometheusSink(reg, s.promNamespace, s.name)
+	}
+	sink, _ := s.metrics.(*prometheusSink)
+	s.mutex.Unlock()
+
+	s.RegisterPlugin(newSelfMetricsPlugin(sink, s.promNamespace))
+}
+
+// selfMetricsPlugin is the table of RegisterSelfMetricsTable.
+type selfMetricsPlugin struct {
+	gatherer  prometheus.Gatherer // Gathers the plugin metrics of the sink, nil without sink
+	namespace string
+}
+
+func newSelfMetricsPlugin(sink *prometheusSink, namespace string) *selfMetricsPlugin {
+	p := &selfMetricsPlugin{namespace: namespace}
+	if sink != nil {
+		// Collectors can be registered with several registries, the sink
+		// registry is not necessarily a Gatherer
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(sink.calls, sink.errors, sink.results, sink.duration)
+		p.gatherer = reg
+	}
+	return p
+}
+
+func (p *selfMetricsPlugin) Name() string {
+	return SelfMetricsTable
+}
+
+func (p *selfMetricsPlugin) RegistryName() string {
+	return "table"
+}
+
+func (p *selfMetricsPlugin) Routes() osquery.ExtensionPluginResponse {
+	columns := []struct{ name, typ string }{
+		{"plugin", "TEXT"},
+		{"action", "TEXT"},
+		{"calls", "BIGINT"},
+		{"errors", "BIGINT"},
+		{"rows", "BIGINT"},
+		{"duration_seconds", "DOUBLE"},
+	}
+	routes := osquery.ExtensionPluginResponse{}
+	for _, col := range columns {
+		routes = append(routes, map[string]string{"id": "column", "name": col.name, "type": col.typ, "op": "0"})
+	}
+	return routes
+}
+
+func (p *selfMetricsPlugin) Ping() osquery.ExtensionStatus {
+	return NewStatus(nil)
+}
+
+func (p *selfMetricsPlugin) Call(ctx context.Context, request osquery.ExtensionPluginRequest) osquery.ExtensionResponse {
+	switch request["action"] {
+	case "generate":
+		if p.gatherer == nil {
+			return NewResponse(nil, errors.New("error generating table: metrics are recorded by a custom MetricsSink"))
+		}
+		rows, err := p.generate()
+		if err != nil {
+			err = errors.Wrap(err, "error generating table")
+		}
+		return NewResponse(rows, err)
+	case "columns":
+		return NewResponse(p.Routes(), nil)
+	default:
+		return NewResponse(nil, errors.New("unknown action: "+request["action"]))
+	}
+}
+
+func (p *selfMetricsPlugin) Shutdown() {}
+
+// generate returns a row per plugin action from the gathered metrics.
+func (p *selfMetricsPlugin) generate() ([]map[string]string, error) {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]string{
+		prometheus.BuildFQName(p.namespace, "", "plugin_calls"):            "calls",
+		prometheus.BuildFQName(p.namespace, "", "plugin_errors"):           "errors",
+		prometheus.BuildFQName(p.namespace, "", "plugin_results"):          "rows",
+		prometheus.BuildFQName(p.namespace, "", "plugin_duration_seconds"): "duration_seconds",
+	}
+	byAction := map[[2]string]map[string]string{}
+	for _, family := range families {
+		column, ok := columns[family.GetName()]
+		if !ok {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			var key [2]string
+			for _, label := range metric.GetLabel() {
+				switch label.GetName() {
+				case "plugin_name":
+					key[0] = label.GetValue()
+				case "plugin_action":
+					key[1] = label.GetValue()
+				}
+			}
+			row, ok := byAction[key]
+			if !ok {
+				row = map[string]string{
+					"plugin":           key[0],
+					"action":           key[1],
+					"calls":            "0",
+					"errors":           "0",
+					"rows":             "0",
+					"duration_seconds": "0",
+				}
+				byAction[key] = row
+			}
+
+			var value float64
+			switch {
+			case metric.GetCounter() != nil:
+				value = metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				value = metric.GetGauge().GetValue()
+			case metric.GetHistogram() != nil:
+				value = metric.GetHistogram().GetSampleSum()
+			}
+			row[column] = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+
+	keys := make([][2]string, 0, len(byAction))
+	for key := range byAction {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	rows := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, byAction[key])
+	}
+	return rows, nil
+}
@@ -0,0 +1,65 @@
+package osquery
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfMetricsTable(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerPrometheusNamespace("myext")(server)
+	server.RegisterPlugin(table.NewPlugin("test", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return []map[string]string{{"a": "1"}, {"a": "2"}}, nil
+		}))
+	server.RegisterPlugin(table.NewPlugin("failing", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return nil, errors.New("backend down")
+		}))
+	server.RegisterSelfMetricsTable()
+	generate := osquery.ExtensionPluginRequest{"action": "generate"}
+
+	for i := 0; i < 2; i++ {
+		_, err := server.Call(context.Background(), "table", "test", generate)
+		require.NoError(t, err)
+	}
+	_, err := server.Call(context.Background(), "table", "failing", generate)
+	require.NoError(t, err)
+
+	resp, err := server.Call(context.Background(), "table", SelfMetricsTable, generate)
+	require.NoError(t, err)
+	require.Equal(t, int32(0), resp.Status.Code)
+	require.Len(t, resp.Response, 3)
+	for _, row := range resp.Response {
+		duration, err := strconv.ParseFloat(row["duration_seconds"], 64)
+		require.NoError(t, err)
+		if row["plugin"] != SelfMetricsTable {
+			assert.Greater(t, duration, float64(0))
+		}
+		delete(row, "duration_seconds")
+	}
+	// The call of the table itself is counted before it generates the rows
+	assert.Equal(t, osquery.ExtensionPluginResponse{
+		{"plugin": "failing", "action": "generate", "calls": "1", "errors": "1", "rows": "0"},
+		{"plugin": SelfMetricsTable, "action": "generate", "calls": "1", "errors": "0", "rows": "0"},
+		{"plugin": "test", "action": "generate", "calls": "2", "errors": "0", "rows": "2"},
+	}, resp.Response)
+}
+
+func TestSelfMetricsTableCustomSink(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerMetricsSink(&recordingSink{})(server)
+	server.RegisterSelfMetricsTable()
+
+	resp, err := server.Call(context.Background(), "table", SelfMetricsTable, osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "custom MetricsSink")
+}
@@ -3,9 +3,14 @@ package osquery
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"reflect"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
@@ -14,7 +19,6 @@ import (
 	"github.com/Uptycs/basequery-go/transport"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -33,12 +37,62 @@ type Plugin interface {
 	// healthy state, StatusOK should be returned.
 	Ping() osquery.ExtensionStatus
 	// Call requests the plugin to perform its defined behavior, returning
-	// a response containing the result.
+	// a response containing the result. Each connection from osquery is
+	// served by its own goroutine, so Call must be safe for concurrent use.
 	Call(context.Context, osquery.ExtensionPluginRequest) osquery.ExtensionResponse
 	// Shutdown alerts the plugin to stop.
 	Shutdown()
 }
 
+// ColumnarPlugin can optionally be implemented by plugins that are able to
+// return their results as parallel slices of column names and row values. The
+// server serializes such results directly onto the thrift transport without
+// building a map per row.
+type ColumnarPlugin interface {
+	// CallColumnar behaves like Call, but returns the rows in columnar form.
+	// Each entry in values holds one row, ordered as columns. If handled is
+	// false, the request is dispatched to Call instead.
+	CallColumnar(ctx context.Context, request osquery.ExtensionPluginRequest) (status osquery.ExtensionStatus, columns []string, values [][]string, handled bool)
+}
+
+// MultiRegistryPlugin can optionally be implemented by plugins that serve
+// several registries, eg. an object implementing both a table and a logger.
+// Such plugins are added to each of the registries returned by RegistryNames
+// instead of RegistryName. The registry a call was made for is available
+// through RegistryFromContext.
+type MultiRegistryPlugin interface {
+	RegistryNames() []string
+}
+
+// TimeoutPlugin can optionally be implemented by plugins needing a call
+// timeout other than the one set with ServerCallTimeout, eg. a table backed by
+// a slow API. A timeout <= 0 falls back to the server timeout.
+type TimeoutPlugin interface {
+	CallTimeout() time.Duration
+}
+
+// registryNames returns the registries the plugin should be added to.
+func registryNames(plugin Plugin) []string {
+	if multi, ok := plugin.(MultiRegistryPlugin); ok {
+		return multi.RegistryNames()
+	}
+	return []string{plugin.RegistryName()}
+}
+
+// ErrRegisterTimeout is returned when osquery does not respond to the
+// extension registration within the server timeout. Supervisors can retry
+// starting the extension when this happens.
+var ErrRegisterTimeout = errors.New("timed out registering extension")
+
+// ErrStartupTimeout is returned by Run when the extension did not register
+// with osquery within the startup timeout set with ServerStartupTimeout.
+var ErrStartupTimeout = errors.New("timed out starting extension")
+
+// ErrServerStopped is returned by Start (and Run) when the thrift server
+// stopped serving although the extension was not shut down. A serve error is
+// wrapped with this message instead.
+var ErrServerStopped = errors.New("extension server stopped unexpectedly")
+
 const defaultTimeout = 1 * time.Second
 const defaultPingInterval = 5 * time.Second
 
@@ -52,20 +106,49 @@ type ExtensionManagerServer struct {
 	serverClient   ExtensionManager
 	registry       map[string](map[string]Plugin)
 	promServer     *http.Server
-	pluginCounter  *prometheus.CounterVec
-	pluginGauge    *prometheus.GaugeVec
-	pluginTime     *prometheus.HistogramVec
+	metrics        MetricsSink
 	server         thrift.TServer
 	transport      thrift.TServerTransport
+	uuid           osquery.ExtensionRouteUUID // UUID assigned by osquery on registration
 	timeout        time.Duration
 	pingInterval   time.Duration // How often to ping osquery server
 	prometheusPort uint16        // Expose prometheus metrics, if > 0
+	promNamespace  string        // Prefix of the prometheus metric names
+	backoff        BackoffStrategy
+	callErrors     *callErrors // Last failed calls, if enabled
+	startupTimeout time.Duration
+	callTimeout    time.Duration
+	panicFormat    func(recovered interface{}) string
+	authorize      AuthorizeFunc
+	autoReRegister bool
+	configTarget   string        // osquery config plugin receiving the config updates
+	slowCall       time.Duration // Log the plugin calls taking longer, if > 0
+	callsMutex     sync.Mutex
+	callsCtx       context.Context // Parent of the plugin call contexts
+	registryMutex  sync.RWMutex    // Guards registry for the calls, which do not hold mutex
+	startedFlag    int32           // 1 once started, readable while Start holds mutex
+	cancelCalls    context.CancelFunc
+	logger         Logger
+	verbose        bool
+	clientOpts     []ClientOption // Options for the client used to communicate with osquery
+	traceCalls     bool           // Log every plugin call at debug level
+	validateTypes  bool           // Warn about table values not matching their column type
+	validateRows   bool           // Warn about table rows not matching the declared columns
+	compression    bool           // Compress responses of clients sending compressed requests
+	maxRequest     int            // Reject requests larger than this many bytes, if > 0
+	workers        chan struct{}  // Bounds the number of concurrent plugin calls, if not nil
+	ready          chan struct{}  // Closed by MarkReady, if ServerWaitReady is set
+	shutdownHooks  []func()       // Called once when the server shuts down
+	readyOnce      sync.Once
 	mutex          sync.Mutex
 	started        bool // Used to ensure tests wait until the server is actually started
+	connected      bool // Whether the last registration or ping of osquery succeeded
+	shutdown       bool // Whether Shutdown was called, by osquery or the extension
 }
 
 // validRegistryNames contains the allowable RegistryName() values. If a plugin
-// attempts to register with another value, the program will panic.
+// attempts to register with another value not added with ServerCustomRegistry,
+// the program will panic.
 var validRegistryNames = map[string]bool{
 	"table":       true,
 	"logger":      true,
@@ -83,13 +166,43 @@ func ServerVersion(version string) ServerOption {
 	}
 }
 
-// ServerTimeout sets timeout duration for thrift socket.
+// ServerTimeout sets timeout duration for thrift socket. It is used to connect
+// the server's client to osquery and to wait for the extension registration.
+// Use ServerClientOptions with ClientTimeouts to also bound the calls of the
+// client.
 func ServerTimeout(timeout time.Duration) ServerOption {
 	return func(s *ExtensionManagerServer) {
 		s.timeout = timeout
 	}
 }
 
+// ServerCallTimeout sets the timeout of the context of the plugin calls, for
+// the plugins not setting their own (see TimeoutPlugin). By default, calls
+// have no timeout.
+func ServerCallTimeout(timeout time.Duration) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.callTimeout = timeout
+	}
+}
+
+// ServerSlowCallThreshold logs a warning (see ServerLogger) for the plugin
+// calls taking longer than threshold, with the plugin, action and duration.
+func ServerSlowCallThreshold(threshold time.Duration) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.slowCall = threshold
+	}
+}
+
+// ServerStartupTimeout makes Run fail with ErrStartupTimeout if the extension
+// is not registered with osquery within the timeout (eg. because the
+// registration keeps being retried), so that supervisors can restart it or
+// alert. By default there is no limit.
+func ServerStartupTimeout(timeout time.Duration) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.startupTimeout = timeout
+	}
+}
+
 // ServerPingInterval can be used to configure health check ping interval/frequency.
 func ServerPingInterval(interval time.Duration) ServerOption {
 	return func(s *ExtensionManagerServer) {
@@ -105,6 +218,78 @@ func ServerPrometheusPort(port uint16) ServerOption {
 	}
 }
 
+// ServerPrometheusNamespace sets the namespace prefixed to the names of the
+// prometheus metrics (eg. "myext" exposes "myext_plugin_calls"). By default the
+// metrics have no prefix. Metrics are always labelled with the extension name.
+func ServerPrometheusNamespace(namespace string) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.promNamespace = namespace
+	}
+}
+
+// ServerWorkers limits the number of plugin calls processed in parallel to n.
+// Every connection is served by its own goroutine, so by default there is no
+// limit. Calls beyond the limit wait for a running call to complete. A n <= 0
+// removes the limit.
+func ServerWorkers(n int) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		if n > 0 {
+			s.workers = make(chan struct{}, n)
+		} else {
+			s.workers = nil
+		}
+	}
+}
+
+// ServerClientOptions sets the options of the client the server uses to
+// communicate with osquery, eg. ClientConnectRetry to wait for osquery to
+// create its socket.
+func ServerClientOptions(opts ...ClientOption) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.clientOpts = append(s.clientOpts, opts...)
+	}
+}
+
+// ServerLogger sets the logger used by the server for diagnostics. By default
+// nothing is logged.
+func ServerLogger(logger Logger) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.logger = logger
+	}
+}
+
+// ServerVerbose should be set to the value of the --verbose flag osquery
+// passes to extensions. In verbose mode, debug logging is enabled on the
+// logger set with ServerLogger if it implements SetDebug (like StdLogger), and
+// if no logger is set, the server logs to stderr.
+func ServerVerbose(verbose bool) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.verbose = verbose
+	}
+}
+
+// ServerCustomRegistry allows registering plugins in registries other than the
+// ones known to osquery, eg. for osquery forks with additional plugin types.
+// RegisterPlugin panics for unknown registries otherwise.
+func ServerCustomRegistry(names ...string) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		for _, name := range names {
+			if _, ok := s.registry[name]; !ok {
+				s.registry[name] = make(map[string]Plugin)
+			}
+		}
+	}
+}
+
+// ServerTraceCalls enables logging of every plugin call (action, request keys,
+// response status and row count) at debug level. It has no effect unless a
+// logger is set with ServerLogger.
+func ServerTraceCalls(trace bool) ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.traceCalls = trace
+	}
+}
+
 // NewExtensionManagerServer creates a new extension management server
 // communicating with osquery over the socket at the provided path. If
 // resolving the address or connecting to the socket fails, this function will
@@ -128,8 +313,9 @@ func NewExtensionManagerServer(name string, sockPath string, opts ...ServerOptio
 	for _, opt := range opts {
 		opt(manager)
 	}
+	manager.initLogger()
 
-	serverClient, err := NewClient(sockPath, manager.timeout)
+	serverClient, err := NewClient(sockPath, manager.timeout, manager.clientOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -138,20 +324,86 @@ func NewExtensionManagerServer(name string, sockPath string, opts ...ServerOptio
 	return manager, nil
 }
 
+// initLogger adjusts the logger to the verbose mode.
+func (s *ExtensionManagerServer) initLogger() {
+	if !s.verbose {
+		return
+	}
+	if s.logger == nil {
+		s.logger = NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), true)
+	} else if logger, ok := s.logger.(interface{ SetDebug(bool) }); ok {
+		logger.SetDebug(true)
+	}
+}
+
+// Verbose returns true if osquery runs the extension in verbose mode, as set
+// with ServerVerbose.
+func (s *ExtensionManagerServer) Verbose() bool {
+	return s.verbose
+}
+
 // GetClient returns the extension manager client.
 func (s *ExtensionManagerServer) GetClient() ExtensionManager {
 	return s.serverClient
 }
 
-// RegisterPlugin adds one or more OsqueryPlugins to this extension manager.
-func (s *ExtensionManagerServer) RegisterPlugin(plugins ...Plugin) {
+// OnShutdown adds a function to call when the server shuts down, whether
+// osquery requested it, Shutdown was called or osquery stopped responding.
+// The hooks are called once, after the registered plugins are shut down.
+func (s *ExtensionManagerServer) OnShutdown(hook func()) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	for _, plugin := range plugins {
-		if !validRegistryNames[plugin.RegistryName()] {
-			panic("invalid registry name: " + plugin.RegistryName())
+	s.shutdownHooks = append(s.shutdownHooks, hook)
+}
+
+// RegisterPlugin adds one or more OsqueryPlugins to this extension manager.
+// Plugins registered after Start are only visible to osquery once the
+// extension is registered again, see ReRegister and ServerAutoReRegister.
+func (s *ExtensionManagerServer) RegisterPlugin(plugins ...Plugin) {
+	names := make([]string, 0, len(plugins))
+	late := func() bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for _, plugin := range plugins {
+			s.addPlugin(plugin.Name(), plugin)
+			names = append(names, plugin.Name())
+		}
+		return s.started && !s.shutdown
+	}()
+
+	if late {
+		s.registeredLate(names)
+	}
+}
+
+// RegisterPluginAs adds the plugin to this extension manager under the
+// specified name instead of its own name. It can be called several times to
+// expose the same plugin under multiple names, eg. to keep the old name of a
+// renamed table working.
+func (s *ExtensionManagerServer) RegisterPluginAs(name string, plugin Plugin) {
+	late := func() bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.addPlugin(name, plugin)
+		return s.started && !s.shutdown
+	}()
+
+	if late {
+		s.registeredLate([]string{name})
+	}
+}
+
+func (s *ExtensionManagerServer) addPlugin(name string, plugin Plugin) {
+	regNames := registryNames(plugin)
+	for _, regName := range regNames {
+		if _, custom := s.registry[regName]; !custom && !validRegistryNames[regName] {
+			panic("invalid registry name: " + regName)
 		}
-		s.registry[plugin.RegistryName()][plugin.Name()] = plugin
+	}
+	s.registryMutex.Lock()
+	defer s.registryMutex.Unlock()
+	for _, regName := range regNames {
+		s.registry[regName][name] = plugin
 	}
 }
 
@@ -159,8 +411,8 @@ func (s *ExtensionManagerServer) genRegistry() osquery.ExtensionRegistry {
 	registry := osquery.ExtensionRegistry{}
 	for regName := range s.registry {
 		registry[regName] = osquery.ExtensionRouteTable{}
-		for _, plugin := range s.registry[regName] {
-			registry[regName][plugin.Name()] = plugin.Routes()
+		for name, plugin := range s.registry[regName] {
+			registry[regName][name] = plugin.Routes()
 		}
 	}
 	return registry
@@ -168,65 +420,65 @@ func (s *ExtensionManagerServer) genRegistry() osquery.ExtensionRegistry {
 
 // Start registers the extension plugins and begins listening on a unix socket
 // for requests from the osquery process. All plugins should be registered with
-// RegisterPlugin() before calling Start().
+// RegisterPlugin() before calling Start(), see ServerAutoReRegister otherwise.
 func (s *ExtensionManagerServer) Start() error {
 	var server thrift.TServer
 	err := func() error {
 		s.mutex.Lock()
 		defer s.mutex.Unlock()
-		registry := s.genRegistry()
-
-		stat, err := s.serverClient.RegisterExtension(
-			&osquery.InternalExtensionInfo{
-				Name:    s.name,
-				Version: s.version,
-			},
-			registry,
-		)
 
-		if err != nil {
-			return errors.Wrap(err, "registering extension")
-		}
-		if stat.Code != 0 {
-			return errors.Errorf("status %d registering extension: %s", stat.Code, stat.Message)
+		var err error
+		for attempt := 1; ; attempt++ {
+			ctx, cancel := s.registerContext()
+			server, err = s.register(ctx)
+			cancel()
+			if err == nil || s.backoff == nil || s.shutdown {
+				break
+			}
+			delay := s.backoff.Next(attempt)
+			if delay < 0 {
+				break
+			}
+			// Allow shutting down while waiting
+			s.mutex.Unlock()
+			time.Sleep(delay)
+			s.mutex.Lock()
+			if s.shutdown {
+				break
+			}
 		}
-
-		listenPath := fmt.Sprintf("%s.%d", s.sockPath, stat.UUID)
-
-		processor := osquery.NewExtensionProcessor(s)
-
-		s.transport, err = transport.OpenServer(listenPath, s.timeout)
 		if err != nil {
-			return errors.Wrapf(err, "opening server socket (%s)", listenPath)
+			return err
 		}
 
-		s.server = thrift.NewTSimpleServer2(processor, s.transport)
-		server = s.server
-
 		if s.prometheusPort > 0 {
 			mux := http.NewServeMux()
 			mux.Handle("/metrics", promhttp.Handler())
+			if s.callErrors != nil {
+				mux.HandleFunc("/errors", s.serveRecentErrors)
+			}
 
+			var handler http.Handler = mux
+			if s.logger != nil {
+				handler = s.accessLog(mux)
+			}
 			s.promServer = &http.Server{
 				Addr:    ":" + strconv.Itoa(int(s.prometheusPort)),
-				Handler: mux,
+				Handler: handler,
 			}
 
-			s.pluginCounter = promauto.NewCounterVec(prometheus.CounterOpts{
-				Name: "plugin_calls",
-				Help: "Number of calls to a plugin action",
-			}, []string{"plugin_name", "plugin_action"})
-			s.pluginGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
-				Name: "plugin_results",
-				Help: "Number of results returns by plugin action",
-			}, []string{"plugin_name", "plugin_action"})
-			s.pluginTime = promauto.NewHistogramVec(prometheus.HistogramOpts{
-				Name: "plugin_duration_seconds",
-				Help: "Histogram for plugin action duration in seconds",
-			}, []string{"plugin_name", "plugin_action"})
+			if s.metrics == nil {
+				s.metrics = newPrometheusSink(prometheus.DefaultRegisterer, s.promNamespace, s.name)
+			}
+			client, isClient := s.serverClient.(*ExtensionManagerClient)
+			if sink, ok := s.metrics.(EventMetricsSink); ok && isClient {
+				client.setEventMetrics(sink)
+			}
 		}
 
 		s.started = true
+		atomic.StoreInt32(&s.startedFlag, 1)
+		s.connected = true
 
 		return nil
 	}()
@@ -241,45 +493,344 @@ func (s *ExtensionManagerServer) Start() error {
 		}()
 	}
 
-	return server.Serve()
+	for {
+		err = server.Serve()
+
+		// Keep serving if the server was replaced by ReRegister
+		s.mutex.Lock()
+		next := s.server
+		shutdown := s.shutdown
+		s.mutex.Unlock()
+		if next == nil || next == server {
+			if shutdown {
+				s.debugf("extension server stopped")
+				return err
+			}
+			if err != nil {
+				err = errors.Wrap(err, ErrServerStopped.Error())
+			} else {
+				err = ErrServerStopped
+			}
+			s.errorf("%s", err)
+			return err
+		}
+		server = next
+	}
+}
+
+// register registers the extension plugins with osquery and creates the
+// thrift server listening on the socket for the returned UUID. The caller
+// must hold the mutex.
+func (s *ExtensionManagerServer) register(ctx context.Context) (thrift.TServer, error) {
+	registry := s.genRegistry()
+
+	stat, err := s.registerExtension(
+		ctx,
+		&osquery.InternalExtensionInfo{
+			Name:    s.name,
+			Version: s.version,
+		},
+		registry,
+	)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "registering extension")
+	}
+	if stat.Code != 0 {
+		return nil, errors.Wrapf(errRegisterRefused, "status %d registering extension: %s", stat.Code, stat.Message)
+	}
+
+	listenPath := fmt.Sprintf("%s.%d", s.sockPath, stat.UUID)
+
+	processor := osquery.NewExtensionProcessor(s)
+	processor.AddToProcessorMap("call", &callProcessor{server: s})
+
+	// Listening right away, so that osquery can connect to a re-registered
+	// extension before the previous server stops (see ReRegister)
+	var trans thrift.TServerTransport
+	trans, err = transport.OpenServer(listenPath, s.timeout)
+	if err == nil {
+		if err = trans.Listen(); err != nil {
+			trans.Close()
+		}
+	}
+	if err != nil {
+		// Not left registered without a socket
+		if err := s.deregister(stat.UUID); err != nil {
+			s.warnf("removing registration %d: %v", stat.UUID, err)
+		}
+		return nil, errors.Wrapf(err, "opening server socket (%s)", listenPath)
+	}
+	if s.compression {
+		trans = &compressionServerTransport{trans}
+	}
+	if s.maxRequest > 0 {
+		trans = &limitServerTransport{trans, s.maxRequest}
+	}
+
+	s.transport = trans
+	s.uuid = stat.UUID
+	s.server = thrift.NewTSimpleServer2(processor, s.transport)
+	return s.server, nil
+}
+
+// errRegisterRefused is wrapped by the errors of registrations osquery
+// answered with a failure status.
+var errRegisterRefused = errors.New("registration refused")
+
+// deregister removes the registration with the UUID from osquery, if the
+// client supports it (see ExtensionDeregisterer).
+func (s *ExtensionManagerServer) deregister(uuid osquery.ExtensionRouteUUID) error {
+	deregisterer, ok := s.serverClient.(ExtensionDeregisterer)
+	if !ok {
+		return errors.New("client does not support deregistering extensions")
+	}
+	stat, err := deregisterer.DeregisterExtension(uuid)
+	if err != nil {
+		return errors.Wrap(err, "deregistering extension")
+	}
+	if stat.Code != 0 {
+		return errors.Errorf("status %d deregistering extension: %s", stat.Code, stat.Message)
+	}
+	return nil
+}
+
+// registerContext returns the context bounding a registration by the server
+// timeout, if set.
+func (s *ExtensionManagerServer) registerContext() (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.Background(), func() {}
+	}
+	return context.WithTimeout(context.Background(), s.timeout)
+}
+
+// registerExtension calls RegisterExtension, giving up when the context is
+// done so that a slow or unresponsive osquery does not block startup. A
+// registration succeeding after that is removed.
+func (s *ExtensionManagerServer) registerExtension(ctx context.Context, info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+	if ctx.Done() == nil {
+		return s.serverClient.RegisterExtension(info, registry)
+	}
+
+	type result struct {
+		stat *osquery.ExtensionStatus
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stat, err := s.serverClient.RegisterExtension(info, registry)
+		done <- result{stat, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.stat, r.err
+	case <-ctx.Done():
+		// Nobody listens on the socket of a late registration
+		go func() {
+			if r := <-done; r.err == nil && r.stat != nil && r.stat.Code == 0 {
+				if err := s.deregister(r.stat.UUID); err != nil {
+					s.warnf("removing late registration %d: %v", r.stat.UUID, err)
+				}
+			}
+		}()
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrRegisterTimeout
+		}
+		return nil, errors.Wrap(ctx.Err(), "registering extension")
+	}
+}
+
+// ReRegister re-sends the current plugin registry to osquery, so that plugins
+// added or removed after Start become visible without restarting the
+// extension. osquery does not allow updating the registry of a registered
+// extension, so the extension is registered again and the previous
+// registration removed, which requires a client implementing
+// ExtensionDeregisterer. If osquery refuses the new registration while the
+// previous one exists, the previous one is removed first. osquery assigns a
+// new UUID on registration, so the server starts listening on the
+// corresponding new socket before the old one is closed. The registration is
+// bounded by the server timeout, see ServerTimeout.
+func (s *ExtensionManagerServer) ReRegister() error {
+	ctx, cancel := s.registerContext()
+	defer cancel()
+	return s.ReRegisterContext(ctx)
+}
+
+// ReRegisterContext is ReRegister with the registration bounded by the
+// context instead of the server timeout.
+func (s *ExtensionManagerServer) ReRegisterContext(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.started || s.server == nil {
+		return errors.New("extension manager server is not started")
+	}
+	if _, ok := s.serverClient.(ExtensionDeregisterer); !ok {
+		return errors.New("client does not support deregistering extensions")
+	}
+
+	// The new registration is made first, so that the extension stays
+	// registered if it fails. osquery refuses a second registration under
+	// the same name though, in which case the previous one has to go first.
+	old, oldUUID := s.server, s.uuid
+	_, err := s.register(ctx)
+	if errors.Is(err, errRegisterRefused) {
+		s.debugf("re-registration refused, deregistering first: %v", err)
+		if err := s.deregister(oldUUID); err != nil {
+			return err
+		}
+		if _, err := s.register(ctx); err != nil {
+			return errors.Wrap(err, "extension deregistered")
+		}
+	} else if err != nil {
+		return err
+	} else if err := s.deregister(oldUUID); err != nil {
+		s.warnf("removing previous registration %d: %v", oldUUID, err)
+	}
+
+	// Stop the old server asynchronously, as ReRegister could be called
+	// while a request is being processed by it.
+	go func() {
+		old.Stop()
+	}()
+
+	return nil
 }
 
 // Run starts the extension manager and runs until osquery calls for a shutdown
 // or the osquery instance goes away.
 func (s *ExtensionManagerServer) Run() error {
-	errc := make(chan error)
+	// Start returns once Serve stops
+	served := make(chan error, 1)
 	go func() {
-		errc <- s.Start()
+		served <- s.Start()
 	}()
 
+	// The watchers report why the server should stop on errc, unless Run is
+	// already stopping it (stop is closed)
+	errc := make(chan error)
+	stop := make(chan struct{})
+	report := func(err error) {
+		select {
+		case errc <- err:
+		case <-stop:
+		}
+	}
+
+	if s.startupTimeout > 0 {
+		go func() {
+			timer := time.NewTimer(s.startupTimeout)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				if atomic.LoadInt32(&s.startedFlag) == 0 {
+					report(ErrStartupTimeout)
+				}
+			case <-stop:
+			}
+		}()
+	}
+
 	// Watch for the osquery process going away. If so, initiate shutdown.
+	// The watch ends when the server stops for another reason.
 	go func() {
+		timer := time.NewTimer(s.pingInterval)
+		defer timer.Stop()
 		for {
-			time.Sleep(s.pingInterval)
+			select {
+			case <-timer.C:
+			case <-stop:
+				return
+			}
 
 			status, err := s.serverClient.Ping()
 			if err != nil {
-				errc <- errors.Wrap(err, "extension ping failed")
+				s.setConnected(false)
+				s.cancelInflight()
+				report(errors.Wrap(err, "extension ping failed"))
 				break
 			}
 			if status.Code != 0 {
-				errc <- errors.Errorf("ping returned status %d", status.Code)
+				s.setConnected(false)
+				s.cancelInflight()
+				report(errors.Errorf("ping returned status %d", status.Code))
 				break
 			}
+			s.setConnected(true)
+			timer.Reset(s.pingInterval)
 		}
 	}()
 
-	err := <-errc
+	var err error
+	serving := true
+	select {
+	case err = <-served:
+		serving = false
+	case err = <-errc:
+	}
+	close(stop)
+
+	// Start may still be waiting for a hung osquery to answer the
+	// registration, holding the mutex, so the extension is shut down once
+	// it gives up (or registers) without waiting for it
+	if errors.Is(err, ErrStartupTimeout) {
+		go func() {
+			s.Shutdown(context.Background())
+			s.mutex.Lock()
+			promServer := s.promServer
+			s.mutex.Unlock()
+			if promServer != nil {
+				promServer.Shutdown(context.Background())
+			}
+		}()
+		return err
+	}
+
+	// A shutdown requested by osquery (or the extension) is a clean exit, even
+	// if osquery went away before the server stopped.
+	s.mutex.Lock()
+	requested := s.shutdown
+	s.mutex.Unlock()
+	if requested {
+		err = nil
+	}
+
 	if s.promServer != nil {
 		// Ignore promtheus shutdown errors
 		s.promServer.Shutdown(context.Background())
 	}
-	if err := s.Shutdown(context.Background()); err != nil {
-		return err
+	shutdownErr := s.Shutdown(context.Background())
+
+	// Shutdown stopped Serve, wait for it to return. Start gives up instead
+	// if it was still registering.
+	s.mutex.Lock()
+	started := s.started
+	s.mutex.Unlock()
+	if serving && started {
+		<-served
+	}
+
+	if shutdownErr != nil {
+		return shutdownErr
 	}
 	return err
 }
 
+// Connected returns true if the extension is connected to a live osquery,
+// ie. the registration or the last ping of osquery succeeded. Unlike a started
+// server, this reflects the actual osquery liveness.
+func (s *ExtensionManagerServer) Connected() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connected
+}
+
+func (s *ExtensionManagerServer) setConnected(connected bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.connected = connected
+}
+
 // Ping implements the basic health check.
 func (s *ExtensionManagerServer) Ping(ctx context.Context) (*osquery.ExtensionStatus, error) {
 	return &osquery.ExtensionStatus{Code: 0, Message: "OK"}, nil
@@ -288,45 +839,203 @@ func (s *ExtensionManagerServer) Ping(ctx context.Context) (*osquery.ExtensionSt
 // Call routes a call from the osquery process to the appropriate registered
 // plugin.
 func (s *ExtensionManagerServer) Call(ctx context.Context, registry string, item string, request osquery.ExtensionPluginRequest) (*osquery.ExtensionResponse, error) {
+	return s.call(ctx, registry, item, request).extensionResponse(ctx), nil
+}
+
+// call dispatches the request to the plugin, recording the failed calls
+// (including the ones rejected before reaching the plugin) for RecentErrors.
+func (s *ExtensionManagerServer) call(ctx context.Context, registry string, item string, request osquery.ExtensionPluginRequest) *callResult {
+	result := s.dispatch(ctx, registry, item, request)
+	if s.callErrors != nil {
+		s.callErrors.add(registry, item, request, result.status)
+	}
+	return result
+}
+
+// dispatch calls the plugin. Results of columnar plugins are kept in columnar
+// form so that they can be serialized without building maps.
+func (s *ExtensionManagerServer) dispatch(ctx context.Context, registry string, item string, request osquery.ExtensionPluginRequest) *callResult {
+	s.registryMutex.RLock()
 	subreg, ok := s.registry[registry]
+	plugin, found := subreg[item]
+	s.registryMutex.RUnlock()
 	if !ok {
-		return &osquery.ExtensionResponse{
-			Status: &osquery.ExtensionStatus{
+		return &callResult{
+			status: &osquery.ExtensionStatus{
 				Code:    1,
 				Message: "Unknown registry: " + registry,
 			},
-		}, nil
+		}
 	}
 
-	plugin, ok := subreg[item]
-	if !ok {
-		return &osquery.ExtensionResponse{
-			Status: &osquery.ExtensionStatus{
+	if !found {
+		return &callResult{
+			status: &osquery.ExtensionStatus{
 				Code:    1,
 				Message: "Unknown registry item: " + item,
 			},
-		}, nil
+		}
+	}
+
+	if status := s.checkAuthorized(registry, item, request); status != nil {
+		return &callResult{status: status}
+	}
+
+	if status := s.waitReady(ctx); status != nil {
+		return &callResult{status: status}
+	}
+
+	if s.workers != nil {
+		select {
+		case s.workers <- struct{}{}:
+			defer func() { <-s.workers }()
+		case <-ctx.Done():
+			return &callResult{
+				status: &osquery.ExtensionStatus{
+					Code:    1,
+					Message: "Call cancelled waiting for a worker: " + ctx.Err().Error(),
+				},
+			}
+		}
+	}
+
+	if s.metrics != nil {
+		s.metrics.IncCall(item, request["action"])
+	}
+	// Observed directly rather than with a prometheus.Timer, which allocates
+	// on every call
+	timed := s.metrics != nil || s.slowCall > 0
+	var start time.Time
+	if timed {
+		start = time.Now()
+	}
+
+	// The plugin is cancelled if the connection of the call or osquery goes
+	// away, so that it does not keep working for nobody
+	callCtx := s.callsContext()
+	if ctx.Done() != nil {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithCancel(callCtx)
+		defer cancel()
+		go func() {
+			select {
+			case <-ctx.Done():
+				cancel()
+			case <-callCtx.Done():
+			}
+		}()
+	}
+
+	timeout := s.callTimeout
+	if p, ok := plugin.(TimeoutPlugin); ok && p.CallTimeout() > 0 {
+		timeout = p.CallTimeout()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(callCtx, timeout)
+		defer cancel()
+	}
+
+	pluginCtx := withRegistry(callCtx, registry)
+	if client, ok := s.serverClient.(*ExtensionManagerClient); ok {
+		pluginCtx = WithClient(pluginCtx, client)
+	}
+
+	result := s.invoke(pluginCtx, registry, item, plugin, request)
+
+	if s.metrics != nil {
+		s.metrics.SetRows(item, request["action"], result.rowCount())
+		if result.status != nil && result.status.Code != 0 {
+			s.metrics.IncError(item, request["action"])
+		}
+	}
+	if s.traceCalls {
+		s.traceCall(registry, item, request, result)
 	}
+	if registry == "table" && request["action"] == "generate" && result.status != nil && result.status.Code == 0 {
+		if s.validateRows {
+			s.checkRows(item, plugin, result)
+		}
+		if s.validateTypes {
+			s.checkTypes(item, plugin, result)
+		}
+	}
+	if timed {
+		elapsed := time.Since(start)
+		if s.metrics != nil {
+			s.metrics.ObserveDuration(item, request["action"], elapsed)
+		}
+		if s.slowCall > 0 && elapsed > s.slowCall {
+			s.warnf("slow call %s/%s action=%q duration=%s", registry, item, request["action"], elapsed)
+		}
+	}
+
+	return result
+}
 
-	if s.pluginCounter != nil {
-		s.pluginCounter.WithLabelValues(item, request["action"]).Inc()
+// callsContext returns the context the plugin call contexts derive from.
+func (s *ExtensionManagerServer) callsContext() context.Context {
+	s.callsMutex.Lock()
+	defer s.callsMutex.Unlock()
+	if s.callsCtx == nil {
+		s.callsCtx, s.cancelCalls = context.WithCancel(context.Background())
 	}
-	if s.pluginTime != nil {
-		timer := prometheus.NewTimer(s.pluginTime.WithLabelValues(item, request["action"]))
-		defer timer.ObserveDuration()
+	return s.callsCtx
+}
+
+// cancelInflight cancels the contexts of the running plugin calls. Later calls
+// get a new context.
+func (s *ExtensionManagerServer) cancelInflight() {
+	s.callsMutex.Lock()
+	defer s.callsMutex.Unlock()
+	if s.cancelCalls != nil {
+		s.cancelCalls()
+		s.callsCtx = nil
+		s.cancelCalls = nil
 	}
-	response := plugin.Call(context.Background(), request)
-	if s.pluginGauge != nil {
-		s.pluginGauge.WithLabelValues(item, request["action"]).Set(float64(len(response.Response)))
+}
+
+// traceCall logs the details of a plugin call at debug level.
+func (s *ExtensionManagerServer) traceCall(registry string, item string, request osquery.ExtensionPluginRequest, result *callResult) {
+	keys := make([]string, 0, len(request))
+	for key := range request {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	return &response, nil
+	var code int32
+	var message string
+	if result.status != nil {
+		code = result.status.Code
+		message = result.status.Message
+	}
+	s.debugf("call %s/%s action=%q keys=%v status=%d message=%q rows=%d",
+		registry, item, request["action"], keys, code, message, result.rowCount())
 }
 
-// Shutdown stops the server and closes the listening socket.
+// Shutdown stops the server and closes the listening socket. osquery calls it
+// when requesting the extension to stop, in which case Run returns nil. Events
+// buffered by the client of the server (see ClientEventBuffer) are sent to
+// osquery first. The first call also shuts down the registered plugins and
+// calls the OnShutdown hooks.
 func (s *ExtensionManagerServer) Shutdown(ctx context.Context) error {
+	start := time.Now()
+
+	// Send the events buffered by the server's client before stopping
+	var err error
+	if flusher, ok := s.serverClient.(eventFlusher); ok {
+		if err = flusher.FlushEvents(ctx); err != nil {
+			err = errors.Wrap(err, "flushing events")
+		}
+	}
+
+	// Plugin calls still running have nobody to answer to anymore
+	s.cancelInflight()
+
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	first := !s.shutdown
+	s.shutdown = true
+	s.connected = false
 	if s.server != nil {
 		server := s.server
 		s.server = nil
@@ -339,7 +1048,56 @@ func (s *ExtensionManagerServer) Shutdown(ctx context.Context) error {
 		}()
 	}
 
-	return nil
+	var plugins []Plugin
+	var hooks []func()
+	if first {
+		// Plugins registered under several names or registries are shut
+		// down once. Plugins of types that are not comparable cannot be told
+		// apart, so they are shut down for each name.
+		seen := map[Plugin]bool{}
+		for _, subreg := range s.registry {
+			for _, plugin := range subreg {
+				if reflect.TypeOf(plugin).Comparable() {
+					if seen[plugin] {
+						continue
+					}
+					seen[plugin] = true
+				}
+				plugins = append(plugins, plugin)
+			}
+		}
+		hooks = s.shutdownHooks
+	}
+	s.mutex.Unlock()
+
+	// Called without the mutex, so that they can use the server
+	observer, _ := s.metrics.(ShutdownMetricsSink)
+	for _, plugin := range plugins {
+		pluginStart := time.Now()
+		plugin.Shutdown()
+		elapsed := time.Since(pluginStart)
+		s.infof("plugin %s shut down in %s", plugin.Name(), elapsed)
+		if observer != nil {
+			observer.ObservePluginShutdown(plugin.Name(), elapsed)
+		}
+	}
+	for _, hook := range hooks {
+		hook()
+	}
+
+	if first {
+		elapsed := time.Since(start)
+		s.infof("extension %s shut down in %s", s.name, elapsed)
+		if observer != nil {
+			observer.ObserveShutdown(elapsed)
+		}
+	}
+	return err
+}
+
+// eventFlusher is implemented by clients buffering streamed events.
+type eventFlusher interface {
+	FlushEvents(ctx context.Context) error
 }
 
 // Useful for testing
@@ -1,13 +1,18 @@
 package osquery
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net"
 	"os"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -16,6 +21,9 @@ import (
 
 	"github.com/Uptycs/basequery-go/gen/osquery"
 	"github.com/Uptycs/basequery-go/plugin/logger"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/Uptycs/basequery-go/transport"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -58,6 +66,10 @@ func TestNoDeadlockOnError(t *testing.T) {
 // Ensure that the extension server will shutdown and return if the osquery
 // instance it is talking to stops responding to pings.
 func TestShutdownWhenPingFails(t *testing.T) {
+	tempPath, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer os.Remove(tempPath.Name())
+
 	registry := make(map[string](map[string]Plugin))
 	for reg := range validRegistryNames {
 		registry[reg] = make(map[string]Plugin)
@@ -74,11 +86,96 @@ func TestShutdownWhenPingFails(t *testing.T) {
 	server := &ExtensionManagerServer{
 		serverClient: mock,
 		registry:     registry,
+		sockPath:     tempPath.Name(),
 	}
 
-	err := server.Run()
+	err = server.Run()
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "broken pipe")
+	assert.False(t, server.Connected())
+}
+
+// Ensure that Run returns only once Serve stopped when pings fail, leaving no
+// goroutine behind.
+func TestRunPingFailureTeardown(t *testing.T) {
+	tempPath, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer os.Remove(tempPath.Name())
+
+	var disconnected int32
+	mock := NewMockExtensionManager()
+	mock.PingFunc = func() (*osquery.ExtensionStatus, error) {
+		if atomic.LoadInt32(&disconnected) != 0 {
+			return nil, syscall.EPIPE
+		}
+		return &osquery.ExtensionStatus{Code: 0}, nil
+	}
+	server := newTestServer(mock, tempPath.Name())
+	server.pingInterval = 10 * time.Millisecond
+	before := runtime.NumGoroutine()
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Run()
+	}()
+	server.waitStarted()
+	atomic.StoreInt32(&disconnected, 1)
+
+	select {
+	case err := <-completed:
+		assert.Contains(t, err.Error(), "extension ping failed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung on ping failure")
+	}
+
+	// Serve stopped listening before Run returned
+	_, err = net.Dial("unix", tempPath.Name()+".0")
+	assert.Error(t, err)
+	// Polled without assert.Eventually, which runs the condition in another
+	// goroutine
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+// Ensure that the ping loop ends when the server stops, so that restarting
+// extensions in a long-lived process does not leak goroutines.
+func TestRunRepeatedlyNoLeak(t *testing.T) {
+	tempPath, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer os.Remove(tempPath.Name())
+
+	mock := NewMockExtensionManager()
+	mock.PingFunc = func() (*osquery.ExtensionStatus, error) {
+		return &osquery.ExtensionStatus{Code: 0}, nil
+	}
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 5; i++ {
+		server := newTestServer(mock, tempPath.Name())
+		server.pingInterval = 10 * time.Millisecond
+		completed := make(chan error)
+		go func() {
+			completed <- server.Run()
+		}()
+		server.waitStarted()
+		require.NoError(t, server.Shutdown(context.Background()))
+
+		select {
+		case err := <-completed:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("hung on shutdown")
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
 }
 
 // How many parallel tests to run (because sync issues do not occur on every
@@ -186,6 +283,7 @@ func TestShutdownBasic(t *testing.T) {
 	}()
 
 	server.waitStarted()
+	assert.True(t, server.Connected())
 	err = server.Shutdown(context.Background())
 	require.NoError(t, err)
 
@@ -198,3 +296,902 @@ func TestShutdownBasic(t *testing.T) {
 		t.Fatal("hung on shutdown")
 	}
 }
+
+// Ensure that Start reports the thrift server stopping without a shutdown.
+func TestStartServeStoppedUnexpectedly(t *testing.T) {
+	tempPath, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer os.Remove(tempPath.Name())
+
+	var buf bytes.Buffer
+	server := newTestServer(NewMockExtensionManager(), tempPath.Name())
+	ServerLogger(NewStdLogger(log.New(&buf, "", 0), false))(server)
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Start()
+	}()
+	server.waitStarted()
+
+	server.mutex.Lock()
+	thriftServer := server.server
+	server.mutex.Unlock()
+	require.NoError(t, thriftServer.Stop())
+
+	select {
+	case err := <-completed:
+		assert.Equal(t, ErrServerStopped, err)
+		assert.Contains(t, buf.String(), "ERROR extension server stopped unexpectedly")
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung on stop")
+	}
+}
+
+// Verify that a registration failure surfaces from Start using the default mock.
+func TestStartRegistrationStatusError(t *testing.T) {
+	mock := NewMockExtensionManager()
+	mock.RegisterExtensionFunc = func(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+		return &osquery.ExtensionStatus{Code: 1, Message: "denied"}, nil
+	}
+	server := &ExtensionManagerServer{serverClient: mock}
+
+	err := server.Start()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "denied")
+}
+
+// testLogger records the log messages written by the server.
+type testLogger struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (l *testLogger) log(level string, format string, v ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.messages = append(l.messages, level+" "+fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) Debugf(format string, v ...interface{}) { l.log("DEBUG", format, v...) }
+func (l *testLogger) Infof(format string, v ...interface{})  { l.log("INFO", format, v...) }
+func (l *testLogger) Warnf(format string, v ...interface{})  { l.log("WARN", format, v...) }
+func (l *testLogger) Errorf(format string, v ...interface{}) { l.log("ERROR", format, v...) }
+
+func (l *testLogger) Messages() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]string{}, l.messages...)
+}
+
+func TestTraceCalls(t *testing.T) {
+	log := &testLogger{}
+	server := &ExtensionManagerServer{registry: map[string]map[string]Plugin{"logger": {}}}
+	ServerLogger(log)(server)
+	server.RegisterPlugin(logger.NewPlugin("testLogger", func(ctx context.Context, typ logger.LogType, logText string) error {
+		return nil
+	}))
+
+	// Tracing disabled by default
+	_, err := server.Call(context.Background(), "logger", "testLogger", osquery.ExtensionPluginRequest{"string": "hello"})
+	require.NoError(t, err)
+	assert.Empty(t, log.Messages())
+
+	ServerTraceCalls(true)(server)
+	_, err = server.Call(context.Background(), "logger", "testLogger", osquery.ExtensionPluginRequest{"string": "hello"})
+	require.NoError(t, err)
+	_, err = server.Call(context.Background(), "logger", "testLogger", osquery.ExtensionPluginRequest{"action": "bad"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`DEBUG call logger/testLogger action="" keys=[string] status=0 message="OK" rows=0`,
+		`DEBUG call logger/testLogger action="bad" keys=[action] status=1 message="unknown log request" rows=0`,
+	}, log.Messages())
+}
+
+func TestServerVerbose(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	server.initLogger()
+	assert.False(t, server.Verbose())
+	assert.Nil(t, server.logger)
+
+	// Logs to stderr by default
+	ServerVerbose(true)(server)
+	server.initLogger()
+	assert.True(t, server.Verbose())
+	assert.NotNil(t, server.logger)
+
+	// Enables debug on the configured logger
+	var buf bytes.Buffer
+	server = newTestServer(NewMockExtensionManager(), "")
+	ServerLogger(NewStdLogger(log.New(&buf, "", 0), false))(server)
+	ServerVerbose(true)(server)
+	server.initLogger()
+	server.debugf("hello")
+	assert.Equal(t, "DEBUG hello\n", buf.String())
+}
+
+func TestReRegister(t *testing.T) {
+	tempPath, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer os.Remove(tempPath.Name())
+
+	var mut sync.Mutex
+	var registries []osquery.ExtensionRegistry
+	var deregistered []osquery.ExtensionRouteUUID
+	mock := NewMockDeregisteringExtensionManager()
+	mock.RegisterExtensionFunc = func(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+		mut.Lock()
+		defer mut.Unlock()
+		registries = append(registries, registry)
+		return &osquery.ExtensionStatus{Code: 0, UUID: osquery.ExtensionRouteUUID(len(registries))}, nil
+	}
+	mock.DeregisterExtensionFunc = func(uuid osquery.ExtensionRouteUUID) (*osquery.ExtensionStatus, error) {
+		mut.Lock()
+		defer mut.Unlock()
+		deregistered = append(deregistered, uuid)
+		return &osquery.ExtensionStatus{Code: 0}, nil
+	}
+	server := newTestServer(mock, tempPath.Name())
+
+	// Not started yet
+	assert.Error(t, server.ReRegister())
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Start()
+	}()
+	server.waitStarted()
+
+	server.RegisterPlugin(logger.NewPlugin("testLogger", func(ctx context.Context, typ logger.LogType, logText string) error {
+		return nil
+	}))
+	require.NoError(t, server.ReRegister())
+
+	mut.Lock()
+	require.Len(t, registries, 2)
+	assert.Empty(t, registries[0]["logger"])
+	assert.Contains(t, registries[1]["logger"], "testLogger")
+	assert.Equal(t, []osquery.ExtensionRouteUUID{1}, deregistered)
+	mut.Unlock()
+
+	// The server keeps serving on the socket for the new UUID
+	client, err := NewClient(fmt.Sprintf("%s.%d", tempPath.Name(), 2), time.Second)
+	require.NoError(t, err)
+	status, err := client.Ping()
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), status.Code)
+	client.Close()
+
+	select {
+	case err := <-completed:
+		t.Fatalf("server stopped after re-registration: %v", err)
+	default:
+	}
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	select {
+	case err := <-completed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung on shutdown")
+	}
+}
+
+func TestReRegisterFailure(t *testing.T) {
+	tempPath, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer os.Remove(tempPath.Name())
+
+	var mut sync.Mutex
+	var registered []osquery.ExtensionRouteUUID
+	var deregistered []osquery.ExtensionRouteUUID
+	var failure error
+	uuid := osquery.ExtensionRouteUUID(0)
+	mock := NewMockDeregisteringExtensionManager()
+	mock.RegisterExtensionFunc = func(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+		mut.Lock()
+		defer mut.Unlock()
+		if failure != nil {
+			return nil, failure
+		}
+		// Like osquery, refuse a second extension with the same name
+		if len(registered) > 0 {
+			return &osquery.ExtensionStatus{Code: 1, Message: "Duplicate extension registered"}, nil
+		}
+		uuid++
+		registered = append(registered, uuid)
+		return &osquery.ExtensionStatus{Code: 0, UUID: uuid}, nil
+	}
+	mock.DeregisterExtensionFunc = func(uuid osquery.ExtensionRouteUUID) (*osquery.ExtensionStatus, error) {
+		mut.Lock()
+		defer mut.Unlock()
+		deregistered = append(deregistered, uuid)
+		for i, id := range registered {
+			if id == uuid {
+				registered = append(registered[:i], registered[i+1:]...)
+				break
+			}
+		}
+		return &osquery.ExtensionStatus{Code: 0}, nil
+	}
+	server := newTestServer(mock, tempPath.Name())
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Start()
+	}()
+	server.waitStarted()
+
+	// A failed registration keeps the previous one
+	mut.Lock()
+	failure = errors.New("broken pipe")
+	mut.Unlock()
+	assert.Error(t, server.ReRegister())
+	mut.Lock()
+	assert.Equal(t, []osquery.ExtensionRouteUUID{1}, registered)
+	assert.Empty(t, deregistered)
+	failure = nil
+	mut.Unlock()
+	client, err := NewClient(fmt.Sprintf("%s.%d", tempPath.Name(), 1), time.Second)
+	require.NoError(t, err)
+	_, err = client.Ping()
+	require.NoError(t, err)
+	client.Close()
+
+	// A refused registration is retried once the previous one is removed
+	require.NoError(t, server.ReRegister())
+	mut.Lock()
+	assert.Equal(t, []osquery.ExtensionRouteUUID{2}, registered)
+	assert.Equal(t, []osquery.ExtensionRouteUUID{1}, deregistered)
+	mut.Unlock()
+
+	// Clients unable to deregister cannot re-register
+	server.serverClient = struct{ ExtensionManager }{mock}
+	assert.EqualError(t, server.ReRegister(), "client does not support deregistering extensions")
+	server.serverClient = mock
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	select {
+	case err := <-completed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung on shutdown")
+	}
+}
+
+func TestRegisterAfterStart(t *testing.T) {
+	tempPath, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer os.Remove(tempPath.Name())
+
+	var mut sync.Mutex
+	var registries []osquery.ExtensionRegistry
+	mock := NewMockDeregisteringExtensionManager()
+	mock.RegisterExtensionFunc = func(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+		mut.Lock()
+		defer mut.Unlock()
+		registries = append(registries, registry)
+		return &osquery.ExtensionStatus{Code: 0, UUID: osquery.ExtensionRouteUUID(len(registries))}, nil
+	}
+	mock.DeregisterExtensionFunc = func(uuid osquery.ExtensionRouteUUID) (*osquery.ExtensionStatus, error) {
+		return &osquery.ExtensionStatus{Code: 0}, nil
+	}
+	// The standard logger is left alone without a server logger
+	var buf bytes.Buffer
+	flags := log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	}()
+	server := newTestServer(mock, tempPath.Name())
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Start()
+	}()
+	server.waitStarted()
+
+	noop := func(ctx context.Context, typ logger.LogType, logText string) error {
+		return nil
+	}
+
+	// By default, late plugins are only reported
+	server.RegisterPlugin(logger.NewPlugin("silent", noop))
+	assert.Empty(t, buf.String())
+	var logged bytes.Buffer
+	ServerLogger(NewStdLogger(log.New(&logged, "", 0), false))(server)
+	server.RegisterPlugin(logger.NewPlugin("late", noop))
+	assert.Contains(t, logged.String(), "WARN plugins late registered after Start are not visible to osquery until ReRegister is called")
+	mut.Lock()
+	assert.Len(t, registries, 1)
+	mut.Unlock()
+
+	ServerAutoReRegister(true)(server)
+	server.RegisterPluginAs("alias", logger.NewPlugin("other", noop))
+	mut.Lock()
+	require.Len(t, registries, 2)
+	assert.Contains(t, registries[1]["logger"], "late")
+	assert.Contains(t, registries[1]["logger"], "alias")
+	mut.Unlock()
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	select {
+	case err := <-completed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung on shutdown")
+	}
+
+	// Nothing to re-register once shut down
+	server.RegisterPlugin(logger.NewPlugin("after", noop))
+	mut.Lock()
+	assert.Len(t, registries, 2)
+	mut.Unlock()
+}
+
+func TestRegisterPluginContext(t *testing.T) {
+	tempPath, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer os.Remove(tempPath.Name())
+
+	var mut sync.Mutex
+	var registries []osquery.ExtensionRegistry
+	block := make(chan struct{})
+	mock := NewMockDeregisteringExtensionManager()
+	mock.RegisterExtensionFunc = func(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+		mut.Lock()
+		registries = append(registries, registry)
+		n := len(registries)
+		mut.Unlock()
+		if _, ok := registry["logger"]["slow"]; ok {
+			<-block
+		}
+		return &osquery.ExtensionStatus{Code: 0, UUID: osquery.ExtensionRouteUUID(n)}, nil
+	}
+	mock.DeregisterExtensionFunc = func(uuid osquery.ExtensionRouteUUID) (*osquery.ExtensionStatus, error) {
+		return &osquery.ExtensionStatus{Code: 0}, nil
+	}
+	server := newTestServer(mock, tempPath.Name())
+	noop := func(ctx context.Context, typ logger.LogType, logText string) error {
+		return nil
+	}
+
+	// Only added before Start
+	require.NoError(t, server.RegisterPluginContext(context.Background(), logger.NewPlugin("early", noop)))
+	mut.Lock()
+	assert.Empty(t, registries)
+	mut.Unlock()
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Start()
+	}()
+	server.waitStarted()
+
+	require.NoError(t, server.RegisterPluginContext(context.Background(), logger.NewPlugin("late", noop)))
+	mut.Lock()
+	require.Len(t, registries, 2)
+	assert.Contains(t, registries[0]["logger"], "early")
+	assert.Contains(t, registries[1]["logger"], "late")
+	mut.Unlock()
+
+	// Gives up with the context when osquery does not answer
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = server.RegisterPluginContext(ctx, logger.NewPlugin("slow", noop))
+	assert.True(t, errors.Is(err, ErrRegisterTimeout))
+	close(block)
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	select {
+	case <-completed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung on shutdown")
+	}
+}
+
+func TestRegisterPluginDuringCalls(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	columns := []table.ColumnDefinition{table.TextColumn("a")}
+	gen := func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+		return []map[string]string{{"a": "1"}}, nil
+	}
+	server.RegisterPlugin(table.NewPlugin("first", columns, gen))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			server.RegisterPlugin(table.NewPlugin(fmt.Sprintf("table%d", i), columns, gen))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		resp, err := server.Call(context.Background(), "table", "first", osquery.ExtensionPluginRequest{"action": "generate"})
+		require.NoError(t, err)
+		assert.Equal(t, int32(0), resp.Status.Code)
+	}
+	<-done
+}
+
+// newTestServer creates an extension manager server using the specified client.
+func newTestServer(client ExtensionManager, sockPath string) *ExtensionManagerServer {
+	registry := make(map[string](map[string]Plugin))
+	for reg := range validRegistryNames {
+		registry[reg] = make(map[string]Plugin)
+	}
+	return &ExtensionManagerServer{
+		name:         "test",
+		serverClient: client,
+		sockPath:     sockPath,
+		registry:     registry,
+		timeout:      defaultTimeout,
+		pingInterval: defaultPingInterval,
+	}
+}
+
+func TestStartRegistrationTimeout(t *testing.T) {
+	mock := NewMockDeregisteringExtensionManager()
+	mock.RegisterExtensionFunc = func(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+		time.Sleep(time.Second)
+		return &osquery.ExtensionStatus{Code: 0, UUID: 7}, nil
+	}
+	deregistered := make(chan osquery.ExtensionRouteUUID, 1)
+	mock.DeregisterExtensionFunc = func(uuid osquery.ExtensionRouteUUID) (*osquery.ExtensionStatus, error) {
+		deregistered <- uuid
+		return &osquery.ExtensionStatus{Code: 0}, nil
+	}
+	server := newTestServer(mock, "")
+	server.timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	err := server.Start()
+	assert.True(t, errors.Is(err, ErrRegisterTimeout))
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+
+	// The late registration is removed
+	select {
+	case uuid := <-deregistered:
+		assert.Equal(t, osquery.ExtensionRouteUUID(7), uuid)
+	case <-time.After(5 * time.Second):
+		t.Fatal("late registration not removed")
+	}
+}
+
+func TestRunStartupTimeout(t *testing.T) {
+	mock := NewMockExtensionManager()
+	mock.RegisterExtensionFunc = func(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+		return nil, errors.New("connection refused")
+	}
+	server := newTestServer(mock, "")
+	ServerReconnectBackoff(ConstantBackoff{Delay: 10 * time.Millisecond})(server)
+	ServerStartupTimeout(100 * time.Millisecond)(server)
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Run()
+	}()
+	select {
+	case err := <-completed:
+		assert.True(t, errors.Is(err, ErrStartupTimeout))
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung on startup")
+	}
+}
+
+func TestRunStartupTimeoutHungRegistration(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	mock := NewMockExtensionManager()
+	mock.RegisterExtensionFunc = func(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+		<-release
+		return nil, errors.New("connection refused")
+	}
+	server := newTestServer(mock, "")
+	server.timeout = 0
+	ServerStartupTimeout(100 * time.Millisecond)(server)
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Run()
+	}()
+	select {
+	case err := <-completed:
+		assert.True(t, errors.Is(err, ErrStartupTimeout))
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung on startup")
+	}
+}
+
+// Ensure that a running generate is cancelled when osquery goes away.
+func TestCallCancelledOnDisconnect(t *testing.T) {
+	tempPath, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer os.Remove(tempPath.Name())
+
+	disconnect := make(chan struct{})
+	mock := NewMockExtensionManager()
+	mock.PingFunc = func() (*osquery.ExtensionStatus, error) {
+		select {
+		case <-disconnect:
+			return nil, syscall.EPIPE
+		default:
+			return &osquery.ExtensionStatus{}, nil
+		}
+	}
+	server := newTestServer(mock, tempPath.Name())
+	server.pingInterval = 10 * time.Millisecond
+
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	server.RegisterPlugin(table.NewPlugin("slow", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			close(started)
+			select {
+			case <-ctx.Done():
+				cancelled <- ctx.Err()
+			case <-time.After(5 * time.Second):
+				cancelled <- errors.New("not cancelled")
+			}
+			return nil, ctx.Err()
+		}))
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Run()
+	}()
+	go server.Call(context.Background(), "table", "slow", osquery.ExtensionPluginRequest{"action": "generate"})
+
+	<-started
+	close(disconnect)
+	assert.Equal(t, context.Canceled, <-cancelled)
+	assert.Error(t, <-completed)
+}
+
+// Ensure that a plugin call is cancelled when the connection it came in on is
+// closed.
+func TestCallCancelledWithConnection(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	cancelled := make(chan error, 1)
+	server.RegisterPlugin(table.NewPlugin("slow", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			<-ctx.Done()
+			cancelled <- ctx.Err()
+			return nil, ctx.Err()
+		}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go server.Call(ctx, "table", "slow", osquery.ExtensionPluginRequest{"action": "generate"})
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-cancelled:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("generate not cancelled")
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerCallTimeout(time.Hour)(server)
+
+	deadlines := map[string]time.Duration{}
+	newPlugin := func(name string, opts ...table.Option) *table.Plugin {
+		return table.NewPlugin(name, []table.ColumnDefinition{table.TextColumn("a")},
+			func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+				deadline, ok := ctx.Deadline()
+				require.True(t, ok)
+				deadlines[name] = time.Until(deadline)
+				return nil, nil
+			}, opts...)
+	}
+	server.RegisterPlugin(newPlugin("default"), newPlugin("fast", table.CallTimeout(time.Second)))
+
+	for _, name := range []string{"default", "fast"} {
+		_, err := server.Call(context.Background(), "table", name, osquery.ExtensionPluginRequest{"action": "generate"})
+		require.NoError(t, err)
+	}
+	assert.Greater(t, int64(deadlines["default"]), int64(time.Minute))
+	assert.LessOrEqual(t, int64(deadlines["fast"]), int64(time.Second))
+}
+
+func TestServerSlowCallThreshold(t *testing.T) {
+	var buf bytes.Buffer
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerLogger(NewStdLogger(log.New(&buf, "", 0), false))(server)
+	ServerSlowCallThreshold(20 * time.Millisecond)(server)
+
+	delay := time.Duration(0)
+	server.RegisterPlugin(table.NewPlugin("slow", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			time.Sleep(delay)
+			return nil, nil
+		}))
+
+	_, err := server.Call(context.Background(), "table", "slow", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+
+	delay = 30 * time.Millisecond
+	_, err = server.Call(context.Background(), "table", "slow", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(buf.String(), `WARN slow call table/slow action="generate" duration=`), buf.String())
+}
+
+func TestServerWorkers(t *testing.T) {
+	var running, maxRunning int32
+	release := make(chan struct{})
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerWorkers(2)(server)
+	server.RegisterPlugin(table.NewPlugin("slow", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			current := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+					break
+				}
+			}
+			<-release
+			return nil, nil
+		}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := server.Call(context.Background(), "table", "slow", osquery.ExtensionPluginRequest{"action": "generate"})
+			assert.NoError(t, err)
+			assert.Equal(t, int32(0), resp.Status.Code)
+		}()
+	}
+
+	// Calls waiting for a worker give up when their context is done
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	resp, err := server.Call(ctx, "table", "slow", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), resp.Status.Code)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxRunning))
+}
+
+func TestStartSocketPathTooLong(t *testing.T) {
+	mock := NewMockExtensionManager()
+	mock.RegisterExtensionFunc = func(info *osquery.InternalExtensionInfo, registry osquery.ExtensionRegistry) (*osquery.ExtensionStatus, error) {
+		return &osquery.ExtensionStatus{Code: 0, UUID: 12345}, nil
+	}
+	sockPath := "/tmp/" + strings.Repeat("nested/", 14) + "osquery.em"
+	server := newTestServer(mock, sockPath)
+
+	err := server.Start()
+	var pathErr *transport.SocketPathTooLongError
+	require.True(t, errors.As(err, &pathErr), "unexpected error: %v", err)
+	assert.Equal(t, sockPath+".12345", pathErr.Path)
+	assert.Contains(t, err.Error(), "maximum is")
+}
+
+// shutdownPlugin is a table plugin counting the calls to Shutdown.
+type shutdownPlugin struct {
+	*table.Plugin
+	shutdowns int32
+}
+
+func (p *shutdownPlugin) Shutdown() {
+	atomic.AddInt32(&p.shutdowns, 1)
+}
+
+func TestRunShutdownRequested(t *testing.T) {
+	tempPath, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer os.Remove(tempPath.Name())
+
+	// osquery goes away right after requesting the shutdown
+	var stopped int32
+	mock := NewMockExtensionManager()
+	mock.PingFunc = func() (*osquery.ExtensionStatus, error) {
+		if atomic.LoadInt32(&stopped) != 0 {
+			return nil, syscall.EPIPE
+		}
+		return &osquery.ExtensionStatus{Code: 0}, nil
+	}
+	server := newTestServer(mock, tempPath.Name())
+	server.pingInterval = 10 * time.Millisecond
+
+	plugin := &shutdownPlugin{Plugin: table.NewPlugin("test", []table.ColumnDefinition{table.TextColumn("a")}, nil)}
+	server.RegisterPlugin(plugin)
+	var hooks int32
+	server.OnShutdown(func() {
+		assert.False(t, server.Connected())
+		atomic.AddInt32(&hooks, 1)
+	})
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Run()
+	}()
+	server.waitStarted()
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	atomic.StoreInt32(&stopped, 1)
+
+	select {
+	case err := <-completed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung on shutdown")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&plugin.shutdowns))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hooks))
+}
+
+func TestPrometheusMetricLabels(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerPrometheusNamespace("myext")(server)
+	server.RegisterPlugin(table.NewPlugin("test", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return []map[string]string{{"a": "1"}}, nil
+		}))
+
+	registry := prometheus.NewRegistry()
+	server.metrics = newPrometheusSink(registry, server.promNamespace, server.name)
+	_, err := server.Call(context.Background(), "table", "test", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	names := []string{}
+	for _, family := range families {
+		names = append(names, family.GetName())
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			assert.Equal(t, map[string]string{"extension": "test", "plugin_name": "test", "plugin_action": "generate"}, labels)
+			if histogram := metric.GetHistogram(); histogram != nil {
+				assert.Equal(t, uint64(1), histogram.GetSampleCount())
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{"myext_plugin_calls", "myext_plugin_results", "myext_plugin_duration_seconds"}, names)
+}
+
+func BenchmarkCallMetrics(b *testing.B) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	server.RegisterPlugin(table.NewPlugin("test", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return nil, nil
+		}))
+	server.metrics = newPrometheusSink(prometheus.NewRegistry(), "", server.name)
+	request := osquery.ExtensionPluginRequest{"action": "generate"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		server.call(context.Background(), "table", "test", request)
+	}
+}
+
+func TestRegisterPluginAs(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	plugin := &shutdownPlugin{Plugin: table.NewPlugin("new_name", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return []map[string]string{{"a": "1"}}, nil
+		})}
+	server.RegisterPlugin(plugin)
+	server.RegisterPluginAs("old_name", plugin)
+
+	registry := server.genRegistry()
+	assert.Len(t, registry["table"], 2)
+	assert.Equal(t, plugin.Routes(), registry["table"]["new_name"])
+	assert.Equal(t, plugin.Routes(), registry["table"]["old_name"])
+
+	for _, name := range []string{"new_name", "old_name"} {
+		resp, err := server.Call(context.Background(), "table", name, osquery.ExtensionPluginRequest{"action": "generate"})
+		require.NoError(t, err)
+		assert.Equal(t, osquery.ExtensionPluginResponse{{"a": "1"}}, resp.Response)
+	}
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&plugin.shutdowns))
+
+	// Only registered under aliases
+	server = newTestServer(NewMockExtensionManager(), "")
+	plugin = &shutdownPlugin{Plugin: plugin.Plugin}
+	server.RegisterPluginAs("a", plugin)
+	server.RegisterPluginAs("b", plugin)
+	require.NoError(t, server.Shutdown(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&plugin.shutdowns))
+}
+
+// tableLogger serves both a table and a logger
+type tableLogger struct {
+	*shutdownPlugin
+	logged []string
+}
+
+func (p *tableLogger) RegistryNames() []string {
+	return []string{"table", "logger"}
+}
+
+func (p *tableLogger) Call(ctx context.Context, request osquery.ExtensionPluginRequest) osquery.ExtensionResponse {
+	if RegistryFromContext(ctx) == "logger" {
+		p.logged = append(p.logged, request["string"])
+		return osquery.ExtensionResponse{Status: &osquery.ExtensionStatus{Code: 0}}
+	}
+	return p.shutdownPlugin.Call(ctx, request)
+}
+
+func TestRegisterMultiRegistryPlugin(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	plugin := &tableLogger{shutdownPlugin: &shutdownPlugin{Plugin: table.NewPlugin("audit", []table.ColumnDefinition{table.TextColumn("a")},
+		func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return []map[string]string{{"a": "1"}}, nil
+		})}}
+	server.RegisterPlugin(plugin)
+
+	registry := server.genRegistry()
+	assert.Contains(t, registry["table"], "audit")
+	assert.Contains(t, registry["logger"], "audit")
+
+	resp, err := server.Call(context.Background(), "table", "audit", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"a": "1"}}, resp.Response)
+
+	resp, err = server.Call(context.Background(), "logger", "audit", osquery.ExtensionPluginRequest{"string": "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, []string{"hello"}, plugin.logged)
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&plugin.shutdowns))
+}
+
+type customPlugin struct {
+	*table.Plugin
+}
+
+func (p *customPlugin) RegistryName() string {
+	return "custom"
+}
+
+func TestServerCustomRegistry(t *testing.T) {
+	plugin := &customPlugin{table.NewPlugin("test", []table.ColumnDefinition{table.TextColumn("a")}, nil)}
+
+	server := newTestServer(NewMockExtensionManager(), "")
+	assert.Panics(t, func() { server.RegisterPlugin(plugin) })
+
+	ServerCustomRegistry("custom")(server)
+	server.RegisterPlugin(plugin)
+	registry := server.genRegistry()
+	assert.Contains(t, registry["custom"], "test")
+	assert.Contains(t, registry, "table")
+}
+
+func TestStartAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract sockets are specific to Linux")
+	}
+	sockPath := fmt.Sprintf("@basequery-test-%d.em", os.Getpid())
+	server := newTestServer(NewMockExtensionManager(), sockPath)
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.Start()
+	}()
+	server.waitStarted()
+
+	conn, err := net.Dial("unix", sockPath+".0")
+	require.NoError(t, err)
+	conn.Close()
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	require.NoError(t, <-completed)
+}
@@ -0,0 +1,35 @@
+package osquery
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// RunWithSignals runs the extension manager like Run, but also shuts it down
+// cleanly (calling the plugin Shutdown and the OnShutdown hooks) when the
+// process receives one of the signals. SIGINT and SIGTERM are used if no
+// signal is specified. Signal handling is opt-in, since programs embedding
+// the server may handle signals themselves; use Run to leave it alone.
+func (s *ExtensionManagerServer) RunWithSignals(signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, signals...)
+	defer signal.Stop(sigc)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case sig := <-sigc:
+			s.debugf("received %s, shutting down", sig)
+			s.Shutdown(context.Background())
+		case <-done:
+		}
+	}()
+
+	return s.Run()
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package osquery
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunWithSignals(t *testing.T) {
+	tempPath, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer os.Remove(tempPath.Name())
+
+	server := newTestServer(NewMockExtensionManager(), tempPath.Name())
+	hooks := make(chan struct{}, 1)
+	server.OnShutdown(func() {
+		hooks <- struct{}{}
+	})
+
+	completed := make(chan error)
+	go func() {
+		completed <- server.RunWithSignals(syscall.SIGHUP)
+	}()
+	server.waitStarted()
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+
+	select {
+	case err := <-completed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung on signal")
+	}
+	select {
+	case <-hooks:
+	default:
+		t.Fatal("shutdown hooks not called")
+	}
+}
@@ -0,0 +1,75 @@
+package osquery
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// columnSpecOptions are the column route "op" bits, in the order they are
+// written as keyword arguments of the spec columns.
+var columnSpecOptions = []struct {
+	bit  int
+	name string
+}{
+	{1, "index"},
+	{2, "required"},
+	{4, "additional"},
+	{8, "optimized"},
+	{16, "hidden"},
+}
+
+// GenerateTableSpecs returns the osquery .table spec (the Python DSL used by
+// the osquery schema) of every registered table, keyed by table name. The
+// specs are built from the column routes of the tables, so that the schema of
+// the extension can be documented and diffed in CI like osquery core tables.
+// The output is deterministic.
+func (s *ExtensionManagerServer) GenerateTableSpecs() (map[string][]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	specs := map[string][]byte{}
+	for name, plugin := range s.registry["table"] {
+		spec, err := tableSpec(name, plugin)
+		if err != nil {
+			return nil, errors.Wrapf(err, "generating spec of table %s", name)
+		}
+		specs[name] = spec
+	}
+	return specs, nil
+}
+
+func tableSpec(name string, plugin Plugin) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "table_name(%s)\n", strconv.Quote(name))
+	fmt.Fprintf(&buf, "description(%s)\n", strconv.Quote(""))
+	buf.WriteString("schema([\n")
+	for _, route := range plugin.Routes() {
+		if route["id"] != "column" {
+			continue
+		}
+		fmt.Fprintf(&buf, "    Column(%s, %s, %s", strconv.Quote(route["name"]), route["type"], strconv.Quote(route["description"]))
+
+		op := 0
+		if route["op"] != "" {
+			var err error
+			if op, err = strconv.Atoi(route["op"]); err != nil {
+				return nil, errors.Wrapf(err, "parsing options of column %s", route["name"])
+			}
+		}
+		for _, option := range columnSpecOptions {
+			if op&option.bit != 0 {
+				fmt.Fprintf(&buf, ", %s=True", option.name)
+			}
+		}
+		if route["collate"] != "" {
+			fmt.Fprintf(&buf, ", collate=%s", strconv.Quote(strings.ToLower(route["collate"])))
+		}
+		buf.WriteString("),\n")
+	}
+	buf.WriteString("])\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,32 @@
+package osquery
+
+import (
+	"testing"
+
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateTableSpecs(t *testing.T) {
+	server := newTestServer(NewMockExtensionManager(), "")
+	server.RegisterPlugin(table.NewPlugin("processes", []table.ColumnDefinition{
+		table.BigIntColumnWithDescription("pid", "Process ID", table.INDEX),
+		table.TextColumnWithDescription("name", `The "process" name`).Collate(table.CollationNoCase),
+		table.TextColumn("path", table.REQUIRED|table.HIDDEN),
+	}, nil))
+	server.RegisterPlugin(table.NewPlugin("empty", nil, nil))
+
+	specs, err := server.GenerateTableSpecs()
+	require.NoError(t, err)
+	assert.Len(t, specs, 2)
+	assert.Equal(t, `table_name("processes")
+description("")
+schema([
+    Column("pid", BIGINT, "Process ID", index=True),
+    Column("name", TEXT, "The \"process\" name", collate="nocase"),
+    Column("path", TEXT, "", required=True, hidden=True),
+])
+`, string(specs["processes"]))
+	assert.Equal(t, "table_name(\"empty\")\ndescription(\"\")\nschema([\n])\n", string(specs["empty"]))
+}
@@ -0,0 +1,132 @@
+package osquery
+
+import (
+	"context"
+
+	"github.com/apache/thrift/lib/go/thrift"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/internal/stream"
+	"github.com/pkg/errors"
+)
+
+// StreamingPlugin can optionally be implemented by plugins returning results
+// too large to be held in memory. The rows are written by the plugin directly
+// onto the thrift transport as they are produced, so that neither the rows nor
+// their serialized form are held by the extension.
+//
+// Thrift encodes the number of rows before the rows, so the plugin declares
+// the count up front. If write fails (or writes fewer rows than declared), the
+// remaining rows are sent empty and the call fails with the error, so osquery
+// drops the rows. The call timeout (see ServerCallTimeout), the worker limit
+// and the call duration metrics only apply to the preparation of the stream,
+// ie. CallStreaming, not to write.
+type StreamingPlugin interface {
+	// CallStreaming behaves like Call, but returns the number of rows and the
+	// function writing them instead of the rows. write is called with
+	// writeRow once the response is being sent. Each call to writeRow sends
+	// one row, its values ordered as columns; it returns an error if the row
+	// cannot be sent, in which case write should stop and return it. If
+	// handled is false, the request is dispatched to Call instead.
+	CallStreaming(ctx context.Context, request osquery.ExtensionPluginRequest) (status osquery.ExtensionStatus, columns []string, count int, write func(ctx context.Context, writeRow func(values []string) error) error, handled bool)
+}
+
+// rowStream is the result of a streaming plugin, written when the response is
+// sent.
+type rowStream struct {
+	count int
+	write stream.Func
+}
+
+// writeStream serializes a streamed result as the thrift "call" result struct.
+// The rows are written before the status, which is only known once they have
+// been written; thrift struct fields can be written in any order.
+func (r *callResult) writeStream(ctx context.Context, oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin(ctx, "call_result"); err != nil {
+		return thrift.PrependError("write struct begin error: ", err)
+	}
+	if err := oprot.WriteFieldBegin(ctx, "success", thrift.STRUCT, 0); err != nil {
+		return thrift.PrependError("write field begin error 0:success: ", err)
+	}
+	if err := oprot.WriteStructBegin(ctx, "ExtensionResponse"); err != nil {
+		return thrift.PrependError("write struct begin error: ", err)
+	}
+
+	if err := oprot.WriteFieldBegin(ctx, "response", thrift.LIST, 2); err != nil {
+		return thrift.PrependError("write field begin error 2:response: ", err)
+	}
+	if err := oprot.WriteListBegin(ctx, thrift.MAP, r.stream.count); err != nil {
+		return thrift.PrependError("error writing list begin: ", err)
+	}
+
+	// Errors of the transport abort the call, while errors of the plugin are
+	// reported in the status
+	var transportErr error
+	written := 0
+	writeRow := func(values []string) error {
+		if len(values) != len(r.columns) {
+			return errors.Errorf("row %d has %d values, expected %d", written, len(values), len(r.columns))
+		}
+		if written == r.stream.count {
+			return errors.Errorf("more than the %d declared rows", r.stream.count)
+		}
+		if err := writeRowMap(ctx, oprot, r.columns, values); err != nil {
+			transportErr = err
+			return err
+		}
+		written++
+		return nil
+	}
+	err := r.stream.write(ctx, writeRow)
+	if transportErr != nil {
+		return transportErr
+	}
+	if err == nil && written < r.stream.count {
+		err = errors.Errorf("%d rows written, %d declared", written, r.stream.count)
+	}
+	for ; written < r.stream.count; written++ {
+		if err := writeRowMap(ctx, oprot, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := oprot.WriteListEnd(ctx); err != nil {
+		return thrift.PrependError("error writing list end: ", err)
+	}
+	if err := oprot.WriteFieldEnd(ctx); err != nil {
+		return thrift.PrependError("write field end error 2:response: ", err)
+	}
+
+	status := r.status
+	if err != nil {
+		status = &osquery.ExtensionStatus{Code: 1, Message: "error streaming table: " + err.Error()}
+	}
+	if status != nil {
+		if err := oprot.WriteFieldBegin(ctx, "status", thrift.STRUCT, 1); err != nil {
+			return thrift.PrependError("write field begin error 1:status: ", err)
+		}
+		if err := status.Write(ctx, oprot); err != nil {
+			return thrift.PrependError("error writing status: ", err)
+		}
+		if err := oprot.WriteFieldEnd(ctx); err != nil {
+			return thrift.PrependError("write field end error 1:status: ", err)
+		}
+	}
+
+	if err := oprot.WriteFieldStop(ctx); err != nil {
+		return thrift.PrependError("write field stop error: ", err)
+	}
+	if err := oprot.WriteStructEnd(ctx); err != nil {
+		return thrift.PrependError("write struct end error: ", err)
+	}
+	if err := oprot.WriteFieldEnd(ctx); err != nil {
+		return thrift.PrependError("write field end error 0:success: ", err)
+	}
+	if err := oprot.WriteFieldStop(ctx); err != nil {
+		return thrift.PrependError("write field stop error: ", err)
+	}
+	if err := oprot.WriteStructEnd(ctx); err != nil {
+		return thrift.PrependError("write struct end error: ", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package osquery
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamCallResultErrors(t *testing.T) {
+	columns := []table.ColumnDefinition{table.TextColumn("name"), table.IntegerColumn("pid")}
+	stream := func(name string, count int, rows [][]string, err error) Plugin {
+		return table.NewStreamingPlugin(name, columns, func(ctx context.Context, queryContext table.QueryContext) (int, table.StreamFunc, error) {
+			return count, func(ctx context.Context, writeRow func([]string) error) error {
+				for _, row := range rows {
+					if err := writeRow(row); err != nil {
+						return err
+					}
+				}
+				return err
+			}, nil
+		})
+	}
+	server := &ExtensionManagerServer{registry: map[string]map[string]Plugin{"table": {}}}
+	server.RegisterPlugin(
+		stream("ok", 2, [][]string{{"a", "1"}, {table.Null, "2"}}, nil),
+		stream("failed", 3, [][]string{{"a", "1"}}, errors.New("backend gone")),
+		stream("short", 2, [][]string{{"a", "1"}}, nil),
+		stream("long", 1, [][]string{{"a", "1"}, {"b", "2"}}, nil),
+		stream("width", 1, [][]string{{"a"}}, nil),
+		table.NewStreamingPlugin("panic", columns, func(ctx context.Context, queryContext table.QueryContext) (int, table.StreamFunc, error) {
+			return 1, func(ctx context.Context, writeRow func([]string) error) error {
+				panic("boom")
+			}, nil
+		}),
+		table.NewStreamingPlugin("prepare", columns, func(ctx context.Context, queryContext table.QueryContext) (int, table.StreamFunc, error) {
+			return 0, nil, errors.New("no count")
+		}),
+	)
+
+	readBack := func(item string) *osquery.ExtensionResponse {
+		trans := thrift.NewTMemoryBuffer()
+		require.NoError(t, writeCall(server, item, trans))
+		result := osquery.NewExtensionCallResult()
+		require.NoError(t, result.Read(context.Background(), thrift.NewTBinaryProtocolConf(trans, &thrift.TConfiguration{})))
+		return result.Success
+	}
+
+	resp := readBack("ok")
+	assert.Equal(t, int32(0), resp.Status.Code)
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"name": "a", "pid": "1"}, {"pid": "2"}}, resp.Response)
+
+	// The declared number of rows is always sent, padded with empty rows
+	resp = readBack("failed")
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "backend gone")
+	assert.Equal(t, osquery.ExtensionPluginResponse{{"name": "a", "pid": "1"}, {}, {}}, resp.Response)
+
+	resp = readBack("short")
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "1 rows written, 2 declared")
+	assert.Len(t, resp.Response, 2)
+
+	resp = readBack("long")
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "more than the 1 declared rows")
+	assert.Len(t, resp.Response, 1)
+
+	resp = readBack("width")
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "row 0 has 1 values, expected 2")
+
+	resp = readBack("panic")
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "Plugin panicked: boom")
+	assert.Len(t, resp.Response, 1)
+
+	resp = readBack("prepare")
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "no count")
+	assert.Empty(t, resp.Response)
+
+	// In-process calls collect the rows
+	resp, err := server.Call(context.Background(), "table", "failed", osquery.ExtensionPluginRequest{"action": "generate"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), resp.Status.Code)
+	assert.Contains(t, resp.Status.Message, "backend gone")
+	assert.Empty(t, resp.Response)
+}
+
+// peakHeap returns the peak growth of the heap while fn runs, sampled every
+// millisecond.
+func peakHeap(fn func()) uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	base := stats.HeapAlloc
+
+	var peak uint64
+	sample := func() {
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > base && stats.HeapAlloc-base > atomic.LoadUint64(&peak) {
+			atomic.StoreUint64(&peak, stats.HeapAlloc-base)
+		}
+	}
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				sample()
+			}
+		}
+	}()
+	fn()
+	close(done)
+	<-sampled
+	sample()
+	return peak
+}
+
+// benchmarkPeakHeap sends the result of a multi-million row table to a
+// transport discarding it, as osquery would read it off the socket, and
+// reports the peak heap growth of the call.
+func benchmarkPeakHeap(b *testing.B, item string) {
+	server := newBenchmarkServer(2000000)
+	oprot := thrift.NewTBinaryProtocolConf(thrift.NewStreamTransportW(io.Discard), &thrift.TConfiguration{})
+	var peak uint64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		heap := peakHeap(func() {
+			result := server.call(context.Background(), "table", item, osquery.ExtensionPluginRequest{"action": "generate"})
+			err = result.write(context.Background(), oprot)
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if heap > peak {
+			peak = heap
+		}
+	}
+	b.ReportMetric(float64(peak), "peak-heap-B")
+}
+
+func BenchmarkPeakHeapMapRows(b *testing.B) {
+	benchmarkPeakHeap(b, "maps")
+}
+
+func BenchmarkPeakHeapStreamRows(b *testing.B) {
+	benchmarkPeakHeap(b, "stream")
+}
@@ -0,0 +1,66 @@
+//go:build linux
+// +build linux
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsAbstract(t *testing.T) {
+	assert.True(t, isAbstract("@osquery.em"))
+	assert.False(t, isAbstract("/var/osquery/osquery.em"))
+	assert.False(t, isAbstract("osquery@host.em"))
+}
+
+func TestAbstractSocket(t *testing.T) {
+	sockPath := fmt.Sprintf("@basequery-transport-test-%d.em", os.Getpid())
+	server, err := OpenServer(sockPath, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, server.Listen())
+	defer server.Close()
+
+	// Open dials the socket to wait for it, so the first connection is closed
+	// right away
+	received := make(chan string, 1)
+	go func() {
+		for {
+			trans, err := server.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 4)
+			n, _ := io.ReadFull(trans, buf)
+			trans.Close()
+			if n == len(buf) {
+				received <- string(buf)
+				return
+			}
+		}
+	}()
+
+	client, err := Open(sockPath, time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("ping"))
+	require.NoError(t, err)
+	require.NoError(t, client.Flush(context.Background()))
+	select {
+	case msg := <-received:
+		assert.Equal(t, "ping", msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing received on the abstract socket")
+	}
+
+	// No file is created
+	_, err = os.Stat(sockPath)
+	assert.True(t, os.IsNotExist(err))
+}
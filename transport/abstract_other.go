@@ -0,0 +1,25 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package transport
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// isAbstract returns false, abstract sockets are specific to Linux.
+func isAbstract(sockPath string) bool {
+	return false
+}
+
+// checkAbstract returns an error for the socket paths starting with @, which
+// name abstract sockets on Linux, rather than creating a file named after the
+// path in the working directory.
+func checkAbstract(sockPath string) error {
+	if strings.HasPrefix(sockPath, "@") {
+		return errors.Errorf("socket path '%s' names an abstract socket, which are only supported on Linux", sockPath)
+	}
+	return nil
+}
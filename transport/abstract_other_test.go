@@ -0,0 +1,23 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAbstractSocketRejected(t *testing.T) {
+	assert.False(t, isAbstract("@osquery.em"))
+
+	_, err := OpenServer("@osquery.em", time.Second)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "only supported on Linux")
+
+	_, err = Open("@osquery.em", time.Second)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "only supported on Linux")
+}
@@ -1,4 +1,11 @@
 // Package transport provides Thrift TTransport and TServerTransport
 // implementations for use on mac/linux (TSocket/TServerSocket) and Windows
 // (custom named pipe implementation).
+//
+// On Linux, a socket path starting with @ (eg. "@osquery.em") names a socket
+// in the abstract namespace instead of a file, which needs no writable file
+// system and no cleanup. The extension sockets derived from the path are
+// abstract too. osquery's --extensions_socket does not accept abstract names,
+// so such paths only work with an extension manager binding abstract sockets
+// itself. On other systems, these paths are rejected.
 package transport
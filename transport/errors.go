@@ -0,0 +1,15 @@
+package transport
+
+import "fmt"
+
+// SocketPathTooLongError is returned when a socket path is longer than the
+// operating system supports (about 104 bytes). osquery appends the UUID of the
+// extension to its socket path, so a deep base path can exceed the limit.
+type SocketPathTooLongError struct {
+	Path string
+	Max  int
+}
+
+func (e *SocketPathTooLongError) Error() string {
+	return fmt.Sprintf("socket path '%s' is %d bytes long, the maximum is %d bytes: use a shorter osquery extensions socket path", e.Path, len(e.Path), e.Max)
+}
@@ -7,15 +7,46 @@ import (
 	"context"
 	"net"
 	"os"
+	"runtime"
 	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
 	"github.com/pkg/errors"
 )
 
+// maxSocketPathLen is the maximum length of a unix socket path, excluding the
+// terminating NUL of sun_path.
+var maxSocketPathLen = func() int {
+	if runtime.GOOS == "linux" {
+		return 107
+	}
+	return 103
+}()
+
+// checkSocketPath returns a SocketPathTooLongError if the path is too long.
+func checkSocketPath(sockPath string) error {
+	if len(sockPath) > maxSocketPathLen {
+		return &SocketPathTooLongError{Path: sockPath, Max: maxSocketPathLen}
+	}
+	return nil
+}
+
 // Open opens the unix domain socket with the provided path and timeout,
 // returning a TTransport.
 func Open(sockPath string, timeout time.Duration) (*thrift.TSocket, error) {
+	return OpenTimeouts(sockPath, timeout, timeout)
+}
+
+// OpenTimeouts behaves like Open, but with separate timeouts for waiting for
+// the socket and connecting to it, and for the reads and writes on the socket.
+func OpenTimeouts(sockPath string, connectTimeout, socketTimeout time.Duration) (*thrift.TSocket, error) {
+	if err := checkSocketPath(sockPath); err != nil {
+		return nil, err
+	}
+	if err := checkAbstract(sockPath); err != nil {
+		return nil, err
+	}
+
 	addr, err := net.ResolveUnixAddr("unix", sockPath)
 	if err != nil {
 		return nil, errors.Wrapf(err, "resolving socket path '%s'", sockPath)
@@ -25,13 +56,13 @@ func Open(sockPath string, timeout time.Duration) (*thrift.TSocket, error) {
 	// but it looks like net.DialTimeout ignores timeouts for unix socket and immediately returns an error
 	// waitForSocket will loop every 200ms to stat the socket path,
 	// or until the timeout value passes, similar to the C++ and python implementations.
-	if err := waitForSocket(sockPath, timeout); err != nil {
+	if err := waitForSocket(sockPath, connectTimeout); err != nil {
 		return nil, errors.Wrapf(err, "waiting for unix socket to be available: %s", sockPath)
 	}
 
 	trans := thrift.NewTSocketFromAddrConf(addr, &thrift.TConfiguration{
-		ConnectTimeout: timeout,
-		SocketTimeout:  timeout,
+		ConnectTimeout: connectTimeout,
+		SocketTimeout:  socketTimeout,
 	})
 	if err := trans.Open(); err != nil {
 		return nil, errors.Wrap(err, "opening socket transport")
@@ -41,7 +72,15 @@ func Open(sockPath string, timeout time.Duration) (*thrift.TSocket, error) {
 }
 
 // OpenServer resolves the specified listenPath and creates new thrift server socket on specified listen path.
+// A SocketPathTooLongError is returned if the path is too long for a unix socket.
 func OpenServer(listenPath string, timeout time.Duration) (*thrift.TServerSocket, error) {
+	if err := checkSocketPath(listenPath); err != nil {
+		return nil, err
+	}
+	if err := checkAbstract(listenPath); err != nil {
+		return nil, err
+	}
+
 	addr, err := net.ResolveUnixAddr("unix", listenPath)
 	if err != nil {
 		return nil, errors.Wrapf(err, "resolving addr (%s)", addr)
@@ -60,9 +99,24 @@ func waitForSocket(sockPath string, timeout time.Duration) error {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-ticker.C:
-			if _, err := os.Stat(sockPath); err == nil {
+			if socketExists(sockPath) {
 				return nil
 			}
 		}
 	}
 }
+
+// socketExists returns true if the socket can be connected to. Abstract
+// sockets have no file, so they are dialed.
+func socketExists(sockPath string) bool {
+	if !isAbstract(sockPath) {
+		_, err := os.Stat(sockPath)
+		return err == nil
+	}
+	conn, err := net.Dial("unix", sockPath)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,65 @@
+//go:build !windows
+// +build !windows
+
+package transport
+
+import (
+	"errors"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSocketPath(t *testing.T) {
+	max := 103
+	if runtime.GOOS == "linux" {
+		max = 107
+	}
+	require.Equal(t, max, maxSocketPathLen)
+
+	path := func(n int) string {
+		return "/" + strings.Repeat("a", n-1)
+	}
+	for _, test := range []struct {
+		name    string
+		path    string
+		tooLong bool
+	}{
+		{"short", "/var/osquery/osquery.em", false},
+		{"one below the limit", path(max - 1), false},
+		{"at the limit", path(max), false},
+		{"one over the limit", path(max + 1), true},
+		{"over the limit with the extension UUID", path(max-5) + ".12345", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkSocketPath(test.path)
+			if !test.tooLong {
+				assert.NoError(t, err)
+				return
+			}
+			var pathErr *SocketPathTooLongError
+			require.True(t, errors.As(err, &pathErr), "unexpected error: %v", err)
+			assert.Equal(t, test.path, pathErr.Path)
+			assert.Equal(t, max, pathErr.Max)
+		})
+	}
+}
+
+func TestSocketPathTooLong(t *testing.T) {
+	sockPath := "/tmp/" + strings.Repeat("nested/", 15) + "osquery.em"
+
+	_, err := OpenServer(sockPath, time.Second)
+	var pathErr *SocketPathTooLongError
+	require.True(t, errors.As(err, &pathErr), "unexpected error: %v", err)
+	assert.Equal(t, sockPath, pathErr.Path)
+	assert.EqualError(t, err, "socket path '"+sockPath+"' is 120 bytes long, the maximum is "+
+		strconv.Itoa(maxSocketPathLen)+" bytes: use a shorter osquery extensions socket path")
+
+	_, err = Open(sockPath, time.Second)
+	assert.True(t, errors.As(err, &pathErr), "unexpected error: %v", err)
+}
@@ -14,11 +14,17 @@ import (
 // Open opens the named pipe with the provided path and timeout,
 // returning a TTransport.
 func Open(path string, timeout time.Duration) (*thrift.TSocket, error) {
-	conn, err := winio.DialPipe(path, &timeout)
+	return OpenTimeouts(path, timeout, timeout)
+}
+
+// OpenTimeouts behaves like Open, but with separate timeouts for connecting to
+// the named pipe, and for the reads and writes on the pipe.
+func OpenTimeouts(path string, connectTimeout, socketTimeout time.Duration) (*thrift.TSocket, error) {
+	conn, err := winio.DialPipe(path, &connectTimeout)
 	if err != nil {
 		return nil, errors.Wrapf(err, "dialing pipe '%s'", path)
 	}
-	return thrift.NewTSocketFromConnTimeout(conn, timeout), nil
+	return thrift.NewTSocketFromConnTimeout(conn, socketTimeout), nil
 }
 
 func OpenServer(pipePath string, timeout time.Duration) (*TServerPipe, error) {
@@ -0,0 +1,126 @@
+package osquery
+
+import (
+	"sort"
+	"strconv"
+)
+
+// ServerValidateTypes checks that the values generated by the tables parse as
+// the type of their column, logging a warning (see ServerLogger) for every
+// mismatch, eg. text in an INTEGER column that osquery would silently turn
+// into NULL. It is meant for development, as it parses every returned value.
+func ServerValidateTypes() ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.validateTypes = true
+	}
+}
+
+// ServerValidateRows checks that the rows generated by the tables have exactly
+// the declared columns, logging a warning (see ServerLogger) with the index of
+// every row missing a column or having an undeclared one, eg. when a
+// conditional assignment forgets a column on some rows. osquery makes the
+// missing columns NULL, so the columns left out on purpose (or set to
+// table.Null) are reported too. It is meant for development, as it checks every
+// returned row.
+func ServerValidateRows() ServerOption {
+	return func(s *ExtensionManagerServer) {
+		s.validateRows = true
+	}
+}
+
+// columnTypes returns the types of the columns of the table, by name.
+func columnTypes(plugin Plugin) map[string]string {
+	types := map[string]string{}
+	for _, route := range plugin.Routes() {
+		if route["id"] == "column" {
+			types[route["name"]] = route["type"]
+		}
+	}
+	return types
+}
+
+// checkRows logs the rows of the generate result of the table whose columns
+// differ from the declared ones. The columns of columnar results are the same
+// for every row, so they are only checked once.
+func (s *ExtensionManagerServer) checkRows(item string, plugin Plugin, result *callResult) {
+	types := columnTypes(plugin)
+	check := func(index string, row map[string]bool) {
+		var missing, undeclared []string
+		for column := range types {
+			if !row[column] {
+				missing = append(missing, column)
+			}
+		}
+		for column := range row {
+			if _, ok := types[column]; !ok {
+				undeclared = append(undeclared, column)
+			}
+		}
+		sort.Strings(missing)
+		sort.Strings(undeclared)
+		if len(missing) > 0 {
+			s.warnf("table %s %s is missing columns %v", item, index, missing)
+		}
+		if len(undeclared) > 0 {
+			s.warnf("table %s %s has undeclared columns %v", item, index, undeclared)
+		}
+	}
+
+	if result.columnar {
+		columns := make(map[string]bool, len(result.columns))
+		for _, column := range result.columns {
+			columns[column] = true
+		}
+		check("rows", columns)
+		return
+	}
+	for i, row := range result.rows {
+		columns := make(map[string]bool, len(row))
+		for column := range row {
+			columns[column] = true
+		}
+		check("row "+strconv.Itoa(i), columns)
+	}
+}
+
+// checkTypes logs the values of the generate result of the table that do
+// not parse as the type of their column. Empty values are NULL for osquery,
+// so they are valid for every type.
+func (s *ExtensionManagerServer) checkTypes(item string, plugin Plugin, result *callResult) {
+	types := columnTypes(plugin)
+
+	check := func(column, value string) {
+		if value == "" || value == nullValue || validValue(types[column], value) {
+			return
+		}
+		s.warnf("table %s returned %q for %s column %s", item, value, types[column], column)
+	}
+	if result.columnar {
+		for _, values := range result.values {
+			for i, column := range result.columns {
+				check(column, values[i])
+			}
+		}
+		return
+	}
+	for _, row := range result.rows {
+		for column, value := range row {
+			check(column, value)
+		}
+	}
+}
+
+// validValue returns whether value parses as the column type. Values of
+// unknown types (or columns) are considered valid.
+func validValue(columnType, value string) bool {
+	var err error
+	switch columnType {
+	case "INTEGER", "BIGINT":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "UNSIGNED BIGINT":
+		_, err = strconv.ParseUint(value, 10, 64)
+	case "DOUBLE":
+		_, err = strconv.ParseFloat(value, 64)
+	}
+	return err == nil
+}
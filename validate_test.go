@@ -0,0 +1,69 @@
+package osquery
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"testing"
+
+	"github.com/Uptycs/basequery-go/gen/osquery"
+	"github.com/Uptycs/basequery-go/plugin/table"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerValidateTypes(t *testing.T) {
+	var buf bytes.Buffer
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerValidateTypes()(server)
+	ServerLogger(NewStdLogger(log.New(&buf, "", 0), false))(server)
+
+	columns := []table.ColumnDefinition{table.IntegerColumn("pid"), table.DoubleColumn("cpu"), table.TextColumn("name")}
+	server.RegisterPlugin(
+		table.NewPlugin("rows", columns, func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return []map[string]string{
+				{"pid": "1", "cpu": "0.5", "name": "init"},
+				{"pid": "n/a", "cpu": "", "name": "42"},
+			}, nil
+		}),
+		table.NewColumnarPlugin("columnar", columns, func(ctx context.Context, queryContext table.QueryContext) ([]string, [][]string, error) {
+			return []string{"pid", "cpu", "name"}, [][]string{{"2", "high", "kthreadd"}, {table.Null, "1e3", ""}}, nil
+		}),
+	)
+
+	for _, name := range []string{"rows", "columnar"} {
+		_, err := server.Call(context.Background(), "table", name, osquery.ExtensionPluginRequest{"action": "generate"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "WARN table rows returned \"n/a\" for INTEGER column pid\n"+
+		"WARN table columnar returned \"high\" for DOUBLE column cpu\n", buf.String())
+}
+
+func TestServerValidateRows(t *testing.T) {
+	var buf bytes.Buffer
+	server := newTestServer(NewMockExtensionManager(), "")
+	ServerValidateRows()(server)
+	ServerLogger(NewStdLogger(log.New(&buf, "", 0), false))(server)
+
+	columns := []table.ColumnDefinition{table.IntegerColumn("pid"), table.TextColumn("name")}
+	server.RegisterPlugin(
+		table.NewPlugin("rows", columns, func(ctx context.Context, queryContext table.QueryContext) ([]map[string]string, error) {
+			return []map[string]string{
+				{"pid": "1", "name": "init"},
+				{"pid": "2"},
+				{"pid": "3", "name": "bash", "path": "/bin/bash"},
+			}, nil
+		}),
+		table.NewColumnarPlugin("columnar", columns, func(ctx context.Context, queryContext table.QueryContext) ([]string, [][]string, error) {
+			return []string{"pid"}, [][]string{{"1"}}, nil
+		}),
+	)
+
+	for _, name := range []string{"rows", "columnar"} {
+		_, err := server.Call(context.Background(), "table", name, osquery.ExtensionPluginRequest{"action": "generate"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "WARN table rows row 1 is missing columns [name]\n"+
+		"WARN table rows row 2 has undeclared columns [path]\n"+
+		"WARN table columnar rows is missing columns [name]\n", buf.String())
+}